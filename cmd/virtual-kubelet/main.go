@@ -8,14 +8,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/mitchellh/go-homedir"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
 	"github.com/stackpath/vk-stackpath-provider/internal/auth"
 	"github.com/stackpath/vk-stackpath-provider/internal/config"
 	spprovider "github.com/stackpath/vk-stackpath-provider/internal/provider"
@@ -23,8 +27,13 @@ import (
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	logruslogger "github.com/virtual-kubelet/virtual-kubelet/log/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/node"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
 	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 type inputVars struct {
@@ -120,7 +129,7 @@ var virtualKubeletCommand = &cobra.Command{
 	},
 }
 
-// runNode creates and runs a virtual-kubelet node
+// runNode creates and runs a virtual-kubelet node in each of the configured locations
 func runNode(ctx context.Context) error {
 	// Create API config and runtime
 	apiConfig, err := config.NewConfig(ctx)
@@ -128,63 +137,116 @@ func runNode(ctx context.Context) error {
 		log.G(ctx).Fatal(err)
 	}
 
-	// Add edge location to the node name
-	inputs.nodeName = fmt.Sprintf("%s-%s", inputs.nodeName, strings.ToLower(apiConfig.CityCode))
-
 	runtime, err := auth.NewRuntime(ctx, apiConfig.ClientID, apiConfig.ClientSecret, apiConfig.ApiHost, buildVersion)
 	if err != nil {
 		log.G(ctx).Fatal(err)
 	}
 
-	// Create StackPath client
+	// Create StackPath client, shared by the nodes
 	stackpathClient := workload_client.New(runtime, nil)
 
-	// Create and run node
-	node, err := nodeutil.NewNode(inputs.nodeName,
+	// Validate the city codes against the catalogue of the StackPath locations
+	locations, err := apiConfig.LoadLocations(ctx, stackpathClient.Workloads)
+	if err != nil {
+		return err
+	}
+	if err := apiConfig.ValidateLocations(locations); err != nil {
+		return err
+	}
+
+	// Create the Kubernetes client, shared by the nodes and the providers
+	client, err := nodeutil.ClientsetFromEnv(inputs.kubeConfig)
+	if err != nil {
+		return err
+	}
+
+	// Create the broadcaster of the events of the pods, which each node records its events to
+	eventBroadcaster := record.NewBroadcaster()
+	defer eventBroadcaster.Shutdown()
+	eventBroadcaster.StartLogging(log.G(ctx).Infof)
+	eventBroadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: client.CoreV1().Events(v1.NamespaceAll)})
+
+	// Create a node per location, each listening on its own port
+	nodes := make([]*nodeutil.Node, 0, len(apiConfig.CityCodes))
+	for i, cityCode := range apiConfig.CityCodes {
+		locationNode, err := newNode(ctx, apiConfig.ForLocation(cityCode), locations, stackpathClient, client, eventBroadcaster, listenPort+i)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, locationNode)
+	}
+
+	// Run the nodes, the process stops as soon as one of them stops
+	done := make(chan *nodeutil.Node, len(nodes))
+	for _, locationNode := range nodes {
+		go func(locationNode *nodeutil.Node) {
+			if err := locationNode.Run(ctx); err != nil {
+				log.G(ctx).WithError(err).Error("error running the node")
+			}
+			done <- locationNode
+		}(locationNode)
+	}
+
+	for _, locationNode := range nodes {
+		if err := locationNode.WaitReady(ctx, inputs.startupTimeout); err != nil {
+			return fmt.Errorf("error waiting for node to be ready: %w", err)
+		}
+	}
+
+	stoppedNode := <-done
+	return stoppedNode.Err()
+}
+
+// newNode creates the virtual-kubelet node of a location, named after the node name and the location's city code,
+// whose provider is scoped to the location
+func newNode(ctx context.Context, apiConfig *config.Config, locations []*workload_models.Workloadv1Location, stackpathClient *workload_client.EdgeCompute, client kubernetes.Interface, eventBroadcaster record.EventBroadcaster, port int) (*nodeutil.Node, error) {
+	// Add edge location to the node name
+	nodeName := fmt.Sprintf("%s-%s", inputs.nodeName, strings.ToLower(apiConfig.CityCode))
+
+	// Create the recorder of the events of the pods, shared by the node and the provider
+	eventRecorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: path.Join(nodeName, "pod-controller")})
+
+	var provider *spprovider.StackpathProvider
+	return nodeutil.NewNode(nodeName,
 		func(cfg nodeutil.ProviderConfig) (nodeutil.Provider, node.NodeProvider, error) {
-			p, err := spprovider.NewStackpathProvider(ctx, stackpathClient, apiConfig, cfg, os.Getenv("VKUBELET_POD_IP"))
+			p, err := spprovider.NewStackpathProvider(ctx, stackpathClient, apiConfig, cfg, client.CoreV1(), eventRecorder, os.Getenv("VKUBELET_POD_IP"))
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := p.SetLocation(locations); err != nil {
+				return nil, nil, err
+			}
 			p.ConfigureNode(ctx, cfg.Node)
-			return p, nil, err
+			provider = p
+			return p, nil, nil
 		},
-		withClient,
+		nodeutil.WithClient(client),
+		withEventRecorder(eventRecorder),
 		withTaint,
 		withVersion,
 		withTLSConfig,
-		configureRoutes,
+		configureRoutes(func(ctx context.Context) ([]*dto.MetricFamily, error) {
+			// The provider is created by the time the node serves any request
+			return provider.GetMetricsResource(ctx)
+		}),
 		func(cfg *nodeutil.NodeConfig) error {
 			cfg.InformerResyncPeriod = inputs.fullResyncPeriod
 			cfg.NumWorkers = inputs.podSyncWorkers
-			cfg.HTTPListenAddr = fmt.Sprintf(":%d", listenPort)
+			cfg.HTTPListenAddr = fmt.Sprintf(":%d", port)
+			// the API server reaches the kubelet API of each node on the port it listens on
+			cfg.NodeSpec.Status.DaemonEndpoints.KubeletEndpoint.Port = int32(port)
 			return nil
 		},
 	)
-	if err != nil {
-		return err
-	}
-
-	go func() error {
-		err = node.Run(ctx)
-		if err != nil {
-			return fmt.Errorf("error running the node: %w", err)
-		}
-		return nil
-	}()
-
-	if err := node.WaitReady(ctx, inputs.startupTimeout); err != nil {
-		return fmt.Errorf("error waiting for node to be ready: %w", err)
-	}
-
-	<-node.Done()
-	return node.Err()
 }
 
-// withClient sets up the Kubernetes client for the node
-func withClient(cfg *nodeutil.NodeConfig) error {
-	client, err := nodeutil.ClientsetFromEnv(inputs.kubeConfig)
-	if err != nil {
-		return err
+// withEventRecorder sets up the recorder of the events of the pods. The broadcaster of the recorder already
+// records the events, which the node would otherwise only start doing when it creates its own recorder.
+func withEventRecorder(eventRecorder record.EventRecorder) nodeutil.NodeOpt {
+	return func(cfg *nodeutil.NodeConfig) error {
+		cfg.EventRecorder = eventRecorder
+		return nil
 	}
-	return nodeutil.WithClient(client)(cfg)
 }
 
 // withVersion sets the Kubelet Version reported by the node
@@ -215,10 +277,48 @@ func withCA(cfg *tls.Config) error {
 }
 
 // configureRoutes sets up the HTTP routes for the virtual kubelet
-func configureRoutes(cfg *nodeutil.NodeConfig) error {
-	mux := http.NewServeMux()
-	cfg.Handler = mux
-	return nodeutil.AttachProviderRoutes(mux)(cfg)
+func configureRoutes(getMetricsResource metricsResourceFunc) nodeutil.NodeOpt {
+	return func(cfg *nodeutil.NodeConfig) error {
+		mux := http.NewServeMux()
+		cfg.Handler = mux
+		mux.Handle("/metrics/resource", api.InstrumentHandler(handleMetricsResource(getMetricsResource)))
+		return nodeutil.AttachProviderRoutes(mux)(cfg)
+	}
+}
+
+// metricsResourceFunc returns the resource usage metrics of the node and its pods
+type metricsResourceFunc func(context.Context) ([]*dto.MetricFamily, error)
+
+// handleMetricsResource serves the resource usage metrics in the Prometheus exposition
+// format negotiated with the client, as the kubelet does on its /metrics/resource endpoint
+func handleMetricsResource(getMetricsResource metricsResourceFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		families, err := getMetricsResource(r.Context())
+		if err != nil {
+			log.G(r.Context()).WithError(err).Error("error getting the resource metrics")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		encoder := expfmt.NewEncoder(w, format)
+		for _, family := range families {
+			// The text format can't encode a family without samples, e.g. the pod metrics of a node without pods
+			if len(family.Metric) == 0 {
+				continue
+			}
+			if err := encoder.Encode(family); err != nil {
+				log.G(r.Context()).WithError(err).Error("error encoding the resource metrics")
+				return
+			}
+		}
+	}
 }
 
 // withTaint sets up the taint for the node
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGaugeFamily(name string, values ...float64) *dto.MetricFamily {
+	metricType := dto.MetricType_GAUGE
+	family := &dto.MetricFamily{Name: &name, Help: &name, Type: &metricType}
+	for i := range values {
+		family.Metric = append(family.Metric, &dto.Metric{Gauge: &dto.Gauge{Value: &values[i]}})
+	}
+	return family
+}
+
+func TestHandleMetricsResource(t *testing.T) {
+	testCases := []struct {
+		description  string
+		families     []*dto.MetricFamily
+		expectedBody string
+	}{
+		{
+			description: "serves the node metrics of a node without pods",
+			families: []*dto.MetricFamily{
+				newGaugeFamily("node_memory_working_set_bytes", 1024),
+				newGaugeFamily("pod_memory_working_set_bytes"),
+				newGaugeFamily("container_memory_working_set_bytes"),
+				newGaugeFamily("scrape_error", 0),
+			},
+			expectedBody: "# HELP node_memory_working_set_bytes node_memory_working_set_bytes\n" +
+				"# TYPE node_memory_working_set_bytes gauge\n" +
+				"node_memory_working_set_bytes 1024\n" +
+				"# HELP scrape_error scrape_error\n" +
+				"# TYPE scrape_error gauge\n" +
+				"scrape_error 0\n",
+		},
+		{
+			description: "serves the scrape error when the stats summary fails",
+			families: []*dto.MetricFamily{
+				newGaugeFamily("node_memory_working_set_bytes"),
+				newGaugeFamily("pod_memory_working_set_bytes"),
+				newGaugeFamily("scrape_error", 1),
+			},
+			expectedBody: "# HELP scrape_error scrape_error\n" +
+				"# TYPE scrape_error gauge\n" +
+				"scrape_error 1\n",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			handler := handleMetricsResource(func(context.Context) ([]*dto.MetricFamily, error) {
+				return c.families, nil
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/metrics/resource", nil)
+			request.Header.Set("Accept", string(expfmt.FmtText))
+			recorder := httptest.NewRecorder()
+			handler(recorder, request)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			body, err := io.ReadAll(recorder.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedBody, string(body))
+		})
+	}
+}
@@ -3,18 +3,128 @@ package config
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
 	// default to the official StackPath API
 	defaultAPIHost = "gateway.stackpath.com"
+
+	// ExecBackendNone disables running commands in containers
+	ExecBackendNone = "none"
+
+	// ExecBackendAgent runs commands in containers through a helper agent
+	// that serves the kubelet exec API inside the workload instance
+	ExecBackendAgent = "agent"
+
+	// the port the exec helper agent listens on by default
+	defaultExecAgentPort = 10250
+
+	// ExecProbeStrategyIgnore drops exec probes, the containers run without them
+	ExecProbeStrategyIgnore = "ignore"
+
+	// ExecProbeStrategyReject refuses to create pods with exec probes
+	ExecProbeStrategyReject = "reject"
+
+	// ExecProbeStrategyAnnotation replaces exec probes with the HTTP or TCP
+	// probes described in the annotations of the pod
+	ExecProbeStrategyAnnotation = "annotation"
+
+	// ExecProbeStrategyShim runs exec probes in a sidecar health shim, which
+	// exposes their results as HTTP endpoints the containers are probed on
+	ExecProbeStrategyShim = "shim"
+
+	// the port the exec probe shim listens on by default
+	defaultExecProbeShimPort = 8081
+
+	// GRPCProbeStrategyTCP replaces gRPC probes with TCP probes on the gRPC port,
+	// which only check that the port accepts connections
+	GRPCProbeStrategyTCP = "tcp"
+
+	// GRPCProbeStrategyGateway replaces gRPC probes with HTTP probes against a sidecar
+	// health gateway, which calls the grpc.health.v1 health service of the containers
+	GRPCProbeStrategyGateway = "gateway"
+
+	// the port the gRPC health gateway listens on by default
+	defaultGRPCProbeGatewayPort = 8082
+
+	// the size of the volume claims backing emptyDir volumes without a size limit by default
+	defaultEmptyDirSize = "1Gi"
+
+	// the port the init gate listens on by default
+	defaultInitGatePort = 8083
+
+	// TerminatedWorkloadPolicyDelete deletes the workloads of the pods run to completion once they terminated
+	TerminatedWorkloadPolicyDelete = "delete"
+
+	// TerminatedWorkloadPolicyRetain keeps the workloads of the pods run to completion once they terminated,
+	// until the pods are deleted, e.g. to read the logs of their instances
+	TerminatedWorkloadPolicyRetain = "retain"
+
+	// InstanceSizePolicyAlwaysRoundUp allocates the resources of the containers with the smallest instance size
+	// they fit in, or with the largest instance size when they exceed it
+	InstanceSizePolicyAlwaysRoundUp = "always-round-up"
+
+	// InstanceSizePolicyNearestFit allocates the resources of the containers with the instance size
+	// whose CPU and memory are the nearest to theirs, even if it's smaller
+	InstanceSizePolicyNearestFit = "nearest-fit"
+
+	// InstanceSizePolicyRejectIfOversize rounds the resources of the containers up to the smallest instance size
+	// they fit in, and refuses to create pods whose containers exceed the largest instance size
+	InstanceSizePolicyRejectIfOversize = "reject-if-oversize"
+
+	// InstanceSizePolicyFailIfRatioMismatch rounds the resources of the containers up to the smallest instance size
+	// they fit in, and refuses to create pods whose containers request memory and CPU in a ratio too far from the
+	// ratio of their instance size
+	InstanceSizePolicyFailIfRatioMismatch = "fail-if-memory-cpu-ratio-mismatch"
+
+	// the factor the memory to CPU ratio of the containers may differ from the ratio of their instance size by
+	defaultInstanceSizeRatioTolerance = 2
+
+	// ReadyQuorumAll reports the pods running in several locations ready once all their instances are ready
+	ReadyQuorumAll = "all"
+
+	// ReadyQuorumMajority reports the pods running in several locations ready once most of their instances are ready
+	ReadyQuorumMajority = "majority"
+
+	// ReadyQuorumAny reports the pods running in several locations ready once one of their instances is ready
+	ReadyQuorumAny = "any"
+
+	// the file the catalogue of the StackPath locations is cached in by default, in the data directory of the
+	// provider, which the deployment mounts a volume at so the cache survives the restarts of the container
+	defaultLocationsCachePath = "/var/lib/vk-stackpath-provider/locations.json"
+
+	// the seconds the stats summary is cached for by default, longer than the 15s metrics-server scrapes the
+	// nodes every by default, and as long as the StackPath instance metrics take to be sampled again
+	defaultStatsCacheTTLSeconds = 60
 )
 
+// the instance sizes StackPath provides by default
+var defaultInstanceSizes = []InstanceSize{
+	{Name: "SP-1", CPU: "1", Memory: "2Gi"},
+	{Name: "SP-2", CPU: "2", Memory: "4Gi"},
+	{Name: "SP-3", CPU: "2", Memory: "8Gi"},
+	{Name: "SP-4", CPU: "4", Memory: "16Gi"},
+	{Name: "SP-5", CPU: "8", Memory: "32Gi"},
+}
+
+// InstanceSize is one of the sizes the resources of the containers are allocated with
+type InstanceSize struct {
+	// A string that specifies the name of the size, e.g. "SP-1".
+	Name string `yaml:"name"`
+
+	// Strings that specify the CPU and memory of the size, e.g. "1" and "2Gi".
+	CPU    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+}
+
 // Config is the provider's configuration
 type Config struct {
 	// A string specifies the unique identifier of your StackPath account.
@@ -46,7 +156,130 @@ type Config struct {
 	// closer to end-users and reduce latency. The value of this field should correspond
 	// to the code name or identifier of a specific StackPath edge location, such as
 	// "lax", "dfw", "ord", "iad", "atl", "mia", "ams", "fra", "cdg", "sin", "nrt", etc
+	// When the city codes are set, this field is the one of the location a provider is scoped to.
 	CityCode string `yaml:"city_code"`
+
+	// A list of the StackPath Points of Presence (PoP) to run a virtual node in, one per city code,
+	// within the same process. This field is optional and defaults to the city code.
+	CityCodes []string `yaml:"city_codes"`
+
+	// A string that specifies how commands are run in containers (kubectl exec).
+	// Supported values are "none", which rejects such requests, and "agent", which
+	// runs the commands through a helper agent running in the workload instance.
+	// This field is optional and defaults to "none".
+	ExecBackend string `yaml:"exec_backend"`
+
+	// An integer that specifies the port the exec helper agent listens on in the
+	// workload instances. This field is optional and defaults to 10250.
+	ExecAgentPort int `yaml:"exec_agent_port"`
+
+	// A string that specifies the bearer token presented to the exec helper agent.
+	// This field is optional.
+	ExecAgentToken string `yaml:"exec_agent_token"`
+
+	// A boolean that specifies whether the exec helper agent is reached over plain HTTP,
+	// which sends the bearer token in cleartext. This field is optional and defaults to false.
+	ExecAgentDisableTLS bool `yaml:"exec_agent_disable_tls"`
+
+	// A string that specifies the path of the PEM file with the certificates of the CAs
+	// the certificate of the exec helper agent is verified with. This field is optional
+	// and defaults to the CAs of the system.
+	ExecAgentCAFile string `yaml:"exec_agent_ca_file"`
+
+	// A string that specifies the name the certificate of the exec helper agent is verified for.
+	// This field is optional and defaults to the IP address of the workload instance.
+	ExecAgentServerName string `yaml:"exec_agent_server_name"`
+
+	// A string that specifies what happens to exec liveness and readiness probes,
+	// which StackPath doesn't support. Supported values are "ignore", which drops them,
+	// "reject", which refuses to create the pod, "annotation", which replaces them with
+	// the HTTP or TCP probes described in the pod's annotations, and "shim", which runs
+	// them in a sidecar health shim. This field is optional and defaults to "ignore".
+	ExecProbeStrategy string `yaml:"exec_probe_strategy"`
+
+	// A string that specifies the image of the sidecar health shim running exec probes.
+	// This field is required when the exec probe strategy is "shim".
+	ExecProbeShimImage string `yaml:"exec_probe_shim_image"`
+
+	// An integer that specifies the port the sidecar health shim listens on.
+	// This field is optional and defaults to 8081.
+	ExecProbeShimPort int32 `yaml:"exec_probe_shim_port"`
+
+	// A string that specifies how gRPC liveness and readiness probes, which StackPath doesn't support,
+	// are translated. Supported values are "tcp", which checks that the gRPC port accepts connections,
+	// and "gateway", which queries the gRPC health service through a sidecar health gateway.
+	// This field is optional and defaults to "tcp".
+	GRPCProbeStrategy string `yaml:"grpc_probe_strategy"`
+
+	// A string that specifies the image of the sidecar health gateway running gRPC probes.
+	// This field is required when the gRPC probe strategy is "gateway".
+	GRPCProbeGatewayImage string `yaml:"grpc_probe_gateway_image"`
+
+	// An integer that specifies the port the sidecar health gateway listens on.
+	// This field is optional and defaults to 8082.
+	GRPCProbeGatewayPort int32 `yaml:"grpc_probe_gateway_port"`
+
+	// A string that specifies the image of the sidecar writing the files of the ConfigMap, Secret,
+	// projected and downward API volumes of the pods into the volumes of their instances.
+	// This field is optional, those volumes are skipped when it isn't set.
+	VolumeWriterImage string `yaml:"volume_writer_image"`
+
+	// A string that specifies the size of the volume claims backing the emptyDir volumes without a size limit,
+	// e.g. "10Gi". This field is optional and defaults to "1Gi".
+	EmptyDirDefaultSize string `yaml:"empty_dir_default_size"`
+
+	// A string that specifies the image of the sidecar init gate, which reports the init containers of the pods that
+	// completed. This field is optional, pods with init containers fail to be created when it isn't set, and the
+	// containers of the pods whose restart policy is Never or OnFailure are restarted whenever they exit.
+	InitGateImage string `yaml:"init_gate_image"`
+
+	// An integer that specifies the port the sidecar init gate listens on.
+	// This field is optional and defaults to 8083.
+	InitGatePort int32 `yaml:"init_gate_port"`
+
+	// A string that specifies what happens to the workloads of the pods whose restart policy is Never or OnFailure
+	// once they succeeded or failed. Supported values are "delete", which deletes the workloads so they stop using
+	// resources, and "retain", which keeps them until the pods are deleted. This field is optional and defaults
+	// to "delete".
+	TerminatedWorkloadPolicy string `yaml:"terminated_workload_policy"`
+
+	// A list of the instance sizes the resources of the containers are allocated with, each with a name, a CPU
+	// and a memory. This field is optional and defaults to the StackPath sizes SP-1 to SP-5.
+	InstanceSizes []InstanceSize `yaml:"instance_sizes"`
+
+	// A string that specifies how the instance size of a container is chosen. Supported values are
+	// "always-round-up", which picks the smallest size the container fits in, "nearest-fit", which picks the size
+	// the nearest to the resources of the container, "reject-if-oversize", which rounds up but rejects the pods whose
+	// containers exceed the largest size, and "fail-if-memory-cpu-ratio-mismatch", which rounds up but rejects the
+	// pods whose containers request memory and CPU in a ratio too far from the ratio of their size. Containers
+	// exceeding the largest size are otherwise allocated with it. This field is optional and defaults to
+	// "always-round-up".
+	InstanceSizePolicy string `yaml:"instance_size_policy"`
+
+	// A number that specifies the factor the memory to CPU ratio of a container may differ from the ratio of its
+	// instance size by when the instance size policy is "fail-if-memory-cpu-ratio-mismatch". This field is optional
+	// and defaults to 2.
+	InstanceSizeRatioTolerance float64 `yaml:"instance_size_ratio_tolerance"`
+
+	// A string that specifies the name of the instance size the sidecar containers the provider adds to the
+	// workloads, such as the probe sidecars, are allocated with. This field is optional and defaults to the
+	// smallest of the instance sizes.
+	SidecarInstanceSize string `yaml:"sidecar_instance_size"`
+
+	// A string that specifies the file the catalogue of the StackPath locations, which the city codes are validated
+	// against, is cached in. The cached catalogue is used when the StackPath API is unavailable at startup.
+	// This field is optional and defaults to "/var/lib/vk-stackpath-provider/locations.json".
+	LocationsCachePath string `yaml:"locations_cache_path"`
+
+	// A string that specifies how many instances of a pod running in several locations must be ready for the pod
+	// to be reported ready. Supported values are "all", "majority", "any", or a number of instances.
+	// This field is optional and defaults to "all".
+	ReadyQuorum string `yaml:"ready_quorum"`
+
+	// A number that specifies how many seconds the stats summary of the node, which the /stats/summary and
+	// /metrics/resource endpoints are served from, is cached for before the StackPath metrics are queried again.
+	// It should be longer than the interval the node is scraped at. This field is optional and defaults to 60.
+	StatsCacheTTLSeconds int32 `yaml:"stats_cache_ttl_seconds"`
 }
 
 // NewConfig creates and loads configuration from either a YAML file or environment variables
@@ -67,6 +300,100 @@ func NewConfig(ctx context.Context) (*Config, error) {
 	c.ApiHost = os.Getenv("SP_API_HOST")
 	c.CityCode = strings.ToUpper(os.Getenv("SP_CITY_CODE"))
 
+	if cityCodes := os.Getenv("SP_CITY_CODES"); cityCodes != "" {
+		// e.g. DFW,ATL,AMS
+		for _, cityCode := range strings.Split(cityCodes, ",") {
+			c.CityCodes = append(c.CityCodes, strings.ToUpper(strings.TrimSpace(cityCode)))
+		}
+	}
+	c.ExecBackend = os.Getenv("SP_EXEC_BACKEND")
+	c.ExecAgentToken = os.Getenv("SP_EXEC_AGENT_TOKEN")
+
+	if port := os.Getenv("SP_EXEC_AGENT_PORT"); port != "" {
+		var err error
+		if c.ExecAgentPort, err = strconv.Atoi(port); err != nil {
+			return nil, errors.New("exec agent port must be a number")
+		}
+	}
+
+	c.ExecProbeStrategy = os.Getenv("SP_EXEC_PROBE_STRATEGY")
+	c.ExecProbeShimImage = os.Getenv("SP_EXEC_PROBE_SHIM_IMAGE")
+
+	if port := os.Getenv("SP_EXEC_PROBE_SHIM_PORT"); port != "" {
+		shimPort, err := strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			return nil, errors.New("exec probe shim port must be a number")
+		}
+		c.ExecProbeShimPort = int32(shimPort)
+	}
+
+	c.GRPCProbeStrategy = os.Getenv("SP_GRPC_PROBE_STRATEGY")
+	c.GRPCProbeGatewayImage = os.Getenv("SP_GRPC_PROBE_GATEWAY_IMAGE")
+
+	if port := os.Getenv("SP_GRPC_PROBE_GATEWAY_PORT"); port != "" {
+		gatewayPort, err := strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			return nil, errors.New("gRPC probe gateway port must be a number")
+		}
+		c.GRPCProbeGatewayPort = int32(gatewayPort)
+	}
+
+	c.VolumeWriterImage = os.Getenv("SP_VOLUME_WRITER_IMAGE")
+	c.EmptyDirDefaultSize = os.Getenv("SP_EMPTY_DIR_DEFAULT_SIZE")
+	c.InitGateImage = os.Getenv("SP_INIT_GATE_IMAGE")
+
+	if port := os.Getenv("SP_INIT_GATE_PORT"); port != "" {
+		initGatePort, err := strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			return nil, errors.New("init gate port must be a number")
+		}
+		c.InitGatePort = int32(initGatePort)
+	}
+
+	c.TerminatedWorkloadPolicy = os.Getenv("SP_TERMINATED_WORKLOAD_POLICY")
+
+	if sizes := os.Getenv("SP_INSTANCE_SIZES"); sizes != "" {
+		// e.g. SP-1:1:2Gi,SP-2:2:4Gi
+		for _, size := range strings.Split(sizes, ",") {
+			fields := strings.Split(strings.TrimSpace(size), ":")
+			if len(fields) != 3 {
+				return nil, errors.New("instance sizes must be formatted as name:cpu:memory")
+			}
+			c.InstanceSizes = append(c.InstanceSizes, InstanceSize{Name: fields[0], CPU: fields[1], Memory: fields[2]})
+		}
+	}
+
+	c.InstanceSizePolicy = os.Getenv("SP_INSTANCE_SIZE_POLICY")
+	c.SidecarInstanceSize = os.Getenv("SP_SIDECAR_INSTANCE_SIZE")
+
+	if tolerance := os.Getenv("SP_INSTANCE_SIZE_RATIO_TOLERANCE"); tolerance != "" {
+		var err error
+		if c.InstanceSizeRatioTolerance, err = strconv.ParseFloat(tolerance, 64); err != nil {
+			return nil, errors.New("instance size ratio tolerance must be a number")
+		}
+	}
+
+	c.LocationsCachePath = os.Getenv("SP_LOCATIONS_CACHE_PATH")
+	c.ReadyQuorum = os.Getenv("SP_READY_QUORUM")
+
+	if ttl := os.Getenv("SP_STATS_CACHE_TTL_SECONDS"); ttl != "" {
+		seconds, err := strconv.ParseInt(ttl, 10, 32)
+		if err != nil {
+			return nil, errors.New("stats cache TTL must be a number of seconds")
+		}
+		c.StatsCacheTTLSeconds = int32(seconds)
+	}
+
+	c.ExecAgentCAFile = os.Getenv("SP_EXEC_AGENT_CA_FILE")
+	c.ExecAgentServerName = os.Getenv("SP_EXEC_AGENT_SERVER_NAME")
+
+	if disableTLS := os.Getenv("SP_EXEC_AGENT_DISABLE_TLS"); disableTLS != "" {
+		var err error
+		if c.ExecAgentDisableTLS, err = strconv.ParseBool(disableTLS); err != nil {
+			return nil, errors.New("exec agent disable TLS must be either true or false")
+		}
+	}
+
 	if err := c.Validate(); err != nil {
 		return nil, err
 	}
@@ -91,6 +418,15 @@ func (c *Config) newConfigFromFile(filepath string) error {
 	return nil
 }
 
+// ForLocation returns a copy of the configuration scoped to one of its city codes,
+// which the provider of the virtual node running in that location is created with
+func (config *Config) ForLocation(cityCode string) *Config {
+	location := *config
+	location.CityCode = cityCode
+	location.CityCodes = []string{cityCode}
+	return &location
+}
+
 // Validate validates the configuration parameters
 func (config *Config) Validate() error {
 	if config.StackID == "" {
@@ -102,10 +438,31 @@ func (config *Config) Validate() error {
 		return errors.New("must provide a client ID and client secret")
 	}
 
-	if config.CityCode == "" {
+	// the city codes are compared with the ones of the StackPath locations, which are upper case
+	config.CityCode = strings.ToUpper(strings.TrimSpace(config.CityCode))
+	for i, cityCode := range config.CityCodes {
+		config.CityCodes[i] = strings.ToUpper(strings.TrimSpace(cityCode))
+	}
+	if len(config.CityCodes) == 0 && config.CityCode != "" {
+		config.CityCodes = []string{config.CityCode}
+	}
+	if len(config.CityCodes) == 0 {
 		return errors.New("must provide a city code")
-	} else if !isValidLocation(config.CityCode) {
-		return errors.New("must provide a valid city code")
+	}
+	cityCodes := map[string]bool{}
+	for _, cityCode := range config.CityCodes {
+		if !isValidLocation(cityCode) {
+			return errors.New("must provide a valid city code")
+		}
+		if cityCodes[cityCode] {
+			return fmt.Errorf("city code %s is listed more than once", cityCode)
+		}
+		cityCodes[cityCode] = true
+	}
+	if config.CityCode == "" && len(config.CityCodes) == 1 {
+		config.CityCode = config.CityCodes[0]
+	} else if config.CityCode != "" && !cityCodes[config.CityCode] {
+		return fmt.Errorf("city code %s is not in the list of city codes", config.CityCode)
 	}
 
 	if config.ApiHost == "" {
@@ -118,5 +475,186 @@ func (config *Config) Validate() error {
 		}
 	}
 
+	switch config.ExecBackend {
+	case "":
+		config.ExecBackend = ExecBackendNone
+	case ExecBackendNone, ExecBackendAgent:
+	default:
+		return fmt.Errorf("exec backend %q is not supported", config.ExecBackend)
+	}
+
+	if config.ExecAgentPort == 0 {
+		config.ExecAgentPort = defaultExecAgentPort
+	} else if config.ExecAgentPort < 0 || config.ExecAgentPort > 65535 {
+		return errors.New("must provide a valid exec agent port")
+	}
+
+	if config.ExecAgentDisableTLS && (config.ExecAgentCAFile != "" || config.ExecAgentServerName != "") {
+		return errors.New("exec agent CA file and server name can't be set when TLS is disabled")
+	}
+
+	switch config.ExecProbeStrategy {
+	case "":
+		config.ExecProbeStrategy = ExecProbeStrategyIgnore
+	case ExecProbeStrategyIgnore, ExecProbeStrategyReject, ExecProbeStrategyAnnotation:
+	case ExecProbeStrategyShim:
+		if config.ExecProbeShimImage == "" {
+			return errors.New("must provide an exec probe shim image")
+		}
+	default:
+		return fmt.Errorf("exec probe strategy %q is not supported", config.ExecProbeStrategy)
+	}
+
+	if config.ExecProbeShimPort == 0 {
+		config.ExecProbeShimPort = defaultExecProbeShimPort
+	} else if config.ExecProbeShimPort < 0 || config.ExecProbeShimPort > 65535 {
+		return errors.New("must provide a valid exec probe shim port")
+	}
+
+	switch config.GRPCProbeStrategy {
+	case "":
+		config.GRPCProbeStrategy = GRPCProbeStrategyTCP
+	case GRPCProbeStrategyTCP:
+	case GRPCProbeStrategyGateway:
+		if config.GRPCProbeGatewayImage == "" {
+			return errors.New("must provide a gRPC probe gateway image")
+		}
+	default:
+		return fmt.Errorf("gRPC probe strategy %q is not supported", config.GRPCProbeStrategy)
+	}
+
+	if config.GRPCProbeGatewayPort == 0 {
+		config.GRPCProbeGatewayPort = defaultGRPCProbeGatewayPort
+	} else if config.GRPCProbeGatewayPort < 0 || config.GRPCProbeGatewayPort > 65535 {
+		return errors.New("must provide a valid gRPC probe gateway port")
+	}
+
+	if config.EmptyDirDefaultSize == "" {
+		config.EmptyDirDefaultSize = defaultEmptyDirSize
+	} else if size, err := resource.ParseQuantity(config.EmptyDirDefaultSize); err != nil || size.Sign() <= 0 {
+		return fmt.Errorf("empty dir default size %q is not a valid size", config.EmptyDirDefaultSize)
+	}
+
+	if config.InitGatePort == 0 {
+		config.InitGatePort = defaultInitGatePort
+	} else if config.InitGatePort < 0 || config.InitGatePort > 65535 {
+		return errors.New("must provide a valid init gate port")
+	}
+
+	switch config.TerminatedWorkloadPolicy {
+	case "":
+		config.TerminatedWorkloadPolicy = TerminatedWorkloadPolicyDelete
+	case TerminatedWorkloadPolicyDelete, TerminatedWorkloadPolicyRetain:
+	default:
+		return fmt.Errorf("terminated workload policy %q is not supported", config.TerminatedWorkloadPolicy)
+	}
+
+	if len(config.InstanceSizes) == 0 {
+		config.InstanceSizes = defaultInstanceSizes
+	}
+	names := map[string]bool{}
+	for _, size := range config.InstanceSizes {
+		if size.Name == "" {
+			return errors.New("must provide the name of every instance size")
+		}
+		if names[size.Name] {
+			return fmt.Errorf("instance size %s is defined more than once", size.Name)
+		}
+		names[size.Name] = true
+		if cpu, err := resource.ParseQuantity(size.CPU); err != nil || cpu.Sign() <= 0 {
+			return fmt.Errorf("instance size %s has an invalid CPU %q", size.Name, size.CPU)
+		}
+		if memory, err := resource.ParseQuantity(size.Memory); err != nil || memory.Sign() <= 0 {
+			return fmt.Errorf("instance size %s has an invalid memory %q", size.Name, size.Memory)
+		}
+	}
+
+	switch config.InstanceSizePolicy {
+	case "":
+		config.InstanceSizePolicy = InstanceSizePolicyAlwaysRoundUp
+	case InstanceSizePolicyAlwaysRoundUp, InstanceSizePolicyNearestFit, InstanceSizePolicyRejectIfOversize, InstanceSizePolicyFailIfRatioMismatch:
+	default:
+		return fmt.Errorf("instance size policy %q is not supported", config.InstanceSizePolicy)
+	}
+
+	if config.InstanceSizeRatioTolerance == 0 {
+		config.InstanceSizeRatioTolerance = defaultInstanceSizeRatioTolerance
+	} else if config.InstanceSizeRatioTolerance < 1 {
+		return errors.New("instance size ratio tolerance must be at least 1")
+	}
+
+	if config.SidecarInstanceSize == "" {
+		config.SidecarInstanceSize = getSmallestInstanceSize(config.InstanceSizes).Name
+	} else if !names[config.SidecarInstanceSize] {
+		return fmt.Errorf("sidecar instance size %s is not one of the instance sizes", config.SidecarInstanceSize)
+	}
+
+	if config.LocationsCachePath == "" {
+		config.LocationsCachePath = defaultLocationsCachePath
+	}
+
+	if config.ReadyQuorum == "" {
+		config.ReadyQuorum = ReadyQuorumAll
+	} else if _, err := GetReadyQuorum(config.ReadyQuorum, 1); err != nil {
+		return err
+	}
+
+	if config.StatsCacheTTLSeconds == 0 {
+		config.StatsCacheTTLSeconds = defaultStatsCacheTTLSeconds
+	} else if config.StatsCacheTTLSeconds < 0 {
+		return errors.New("stats cache TTL must be a positive number of seconds")
+	}
+
 	return nil
 }
+
+// GetReadyQuorum returns the number of instances that must be ready, out of the instances of a pod, for the pod to be
+// reported ready. The quorum is either "all", "majority", "any" or a number of instances, which is capped at the
+// number of instances of the pod.
+func GetReadyQuorum(quorum string, instances int) (int, error) {
+	switch quorum {
+	case ReadyQuorumAll:
+		return instances, nil
+	case ReadyQuorumMajority:
+		return instances/2 + 1, nil
+	case ReadyQuorumAny:
+		return 1, nil
+	}
+
+	count, err := strconv.Atoi(quorum)
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("ready quorum %q is not supported", quorum)
+	}
+	if count > instances {
+		return instances, nil
+	}
+	return count, nil
+}
+
+// GetSidecarInstanceSize returns the instance size the sidecar containers the provider adds to the workloads are
+// allocated with, which is the smallest of the instance sizes unless another one is configured.
+func (config *Config) GetSidecarInstanceSize() InstanceSize {
+	for _, size := range config.InstanceSizes {
+		if size.Name == config.SidecarInstanceSize {
+			return size
+		}
+	}
+	return getSmallestInstanceSize(config.InstanceSizes)
+}
+
+// getSmallestInstanceSize returns the instance size with the least CPU, then the least memory,
+// among the instance sizes given or else the default ones
+func getSmallestInstanceSize(sizes []InstanceSize) InstanceSize {
+	if len(sizes) == 0 {
+		sizes = defaultInstanceSizes
+	}
+	smallest := sizes[0]
+	for _, size := range sizes[1:] {
+		cpu, smallestCPU := resource.MustParse(size.CPU), resource.MustParse(smallest.CPU)
+		memory, smallestMemory := resource.MustParse(size.Memory), resource.MustParse(smallest.Memory)
+		if c := cpu.Cmp(smallestCPU); c < 0 || (c == 0 && memory.Cmp(smallestMemory) < 0) {
+			smallest = size
+		}
+	}
+	return smallest
+}
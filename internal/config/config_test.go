@@ -63,7 +63,7 @@ func TestNewConfigFromFile(t *testing.T) {
 			expectedError:  fmt.Errorf("must provide a stack ID"),
 		},
 		{
-			description:    "successfully loads config from a file.",
+			description:    "successfully loads config from a file, whose city code is upper cased.",
 			configFilename: "valid_config.yaml",
 			init: func(configFilename string) {
 				os.Setenv("SP_CONFIG_LOCATION", configFilename)
@@ -73,7 +73,7 @@ func TestNewConfigFromFile(t *testing.T) {
 					ClientID:     "123",
 					ApiHost:      "",
 					ClientSecret: "123",
-					CityCode:     "DFW",
+					CityCode:     "dfw",
 				}
 				data, err := yaml.Marshal(&config)
 				if err != nil {
@@ -85,12 +85,180 @@ func TestNewConfigFromFile(t *testing.T) {
 				}
 			},
 			expectedConfig: &Config{
-				AccountID:    "a7188caa-e29b-11ed-b5ea-0242ac120002",
-				StackID:      "a7188caa-e29b-11ed-b5ea-0242ac120003",
-				ClientID:     "123",
-				ApiHost:      "gateway.stackpath.com",
-				ClientSecret: "123",
-				CityCode:     "DFW",
+				AccountID:                  "a7188caa-e29b-11ed-b5ea-0242ac120002",
+				StackID:                    "a7188caa-e29b-11ed-b5ea-0242ac120003",
+				ClientID:                   "123",
+				ApiHost:                    "gateway.stackpath.com",
+				ClientSecret:               "123",
+				CityCode:                   "DFW",
+				CityCodes:                  []string{"DFW"},
+				ExecBackend:                "none",
+				ExecAgentPort:              10250,
+				ExecProbeStrategy:          "ignore",
+				ExecProbeShimPort:          8081,
+				GRPCProbeStrategy:          "tcp",
+				GRPCProbeGatewayPort:       8082,
+				EmptyDirDefaultSize:        "1Gi",
+				InitGatePort:               8083,
+				TerminatedWorkloadPolicy:   "delete",
+				InstanceSizes:              defaultInstanceSizes,
+				InstanceSizePolicy:         "always-round-up",
+				InstanceSizeRatioTolerance: 2,
+				SidecarInstanceSize:        "SP-1",
+				LocationsCachePath:         "/var/lib/vk-stackpath-provider/locations.json",
+				ReadyQuorum:                "all",
+				StatsCacheTTLSeconds:       60,
+			},
+			expectedError: nil,
+		},
+		{
+			description:    "successfully loads the exec backend config from a file.",
+			configFilename: "exec_config.yaml",
+			init: func(configFilename string) {
+				os.Setenv("SP_CONFIG_LOCATION", configFilename)
+				config := Config{
+					StackID:         "a7188caa-e29b-11ed-b5ea-0242ac120003",
+					ClientID:        "123",
+					ClientSecret:    "123",
+					CityCode:        "DFW",
+					ExecBackend:     "agent",
+					ExecAgentPort:   8022,
+					ExecAgentToken:  "token",
+					ExecAgentCAFile: "/etc/vk-stackpath-provider/exec-agent-ca.pem",
+				}
+				data, err := yaml.Marshal(&config)
+				if err != nil {
+					t.Fatal("couldn't serialize the config")
+				}
+				err = os.WriteFile(configFilename, data, 0777)
+				if err != nil {
+					t.Fatalf("couldn't write the config to the file %s", configFilename)
+				}
+			},
+			expectedConfig: &Config{
+				StackID:                    "a7188caa-e29b-11ed-b5ea-0242ac120003",
+				ClientID:                   "123",
+				ApiHost:                    "gateway.stackpath.com",
+				ClientSecret:               "123",
+				CityCode:                   "DFW",
+				CityCodes:                  []string{"DFW"},
+				ExecBackend:                "agent",
+				ExecAgentPort:              8022,
+				ExecAgentToken:             "token",
+				ExecAgentCAFile:            "/etc/vk-stackpath-provider/exec-agent-ca.pem",
+				ExecProbeStrategy:          "ignore",
+				ExecProbeShimPort:          8081,
+				GRPCProbeStrategy:          "tcp",
+				GRPCProbeGatewayPort:       8082,
+				EmptyDirDefaultSize:        "1Gi",
+				InitGatePort:               8083,
+				TerminatedWorkloadPolicy:   "delete",
+				InstanceSizes:              defaultInstanceSizes,
+				InstanceSizePolicy:         "always-round-up",
+				InstanceSizeRatioTolerance: 2,
+				SidecarInstanceSize:        "SP-1",
+				LocationsCachePath:         "/var/lib/vk-stackpath-provider/locations.json",
+				ReadyQuorum:                "all",
+				StatsCacheTTLSeconds:       60,
+			},
+			expectedError: nil,
+		},
+		{
+			description:    "successfully loads the exec probe shim config from a file.",
+			configFilename: "exec_probe_config.yaml",
+			init: func(configFilename string) {
+				os.Setenv("SP_CONFIG_LOCATION", configFilename)
+				config := Config{
+					StackID:            "a7188caa-e29b-11ed-b5ea-0242ac120003",
+					ClientID:           "123",
+					ClientSecret:       "123",
+					CityCode:           "DFW",
+					ExecProbeStrategy:  "shim",
+					ExecProbeShimImage: "stackpath/exec-probe-shim:latest",
+				}
+				data, err := yaml.Marshal(&config)
+				if err != nil {
+					t.Fatal("couldn't serialize the config")
+				}
+				err = os.WriteFile(configFilename, data, 0777)
+				if err != nil {
+					t.Fatalf("couldn't write the config to the file %s", configFilename)
+				}
+			},
+			expectedConfig: &Config{
+				StackID:                    "a7188caa-e29b-11ed-b5ea-0242ac120003",
+				ClientID:                   "123",
+				ApiHost:                    "gateway.stackpath.com",
+				ClientSecret:               "123",
+				CityCode:                   "DFW",
+				CityCodes:                  []string{"DFW"},
+				ExecBackend:                "none",
+				ExecAgentPort:              10250,
+				ExecProbeStrategy:          "shim",
+				ExecProbeShimImage:         "stackpath/exec-probe-shim:latest",
+				ExecProbeShimPort:          8081,
+				GRPCProbeStrategy:          "tcp",
+				GRPCProbeGatewayPort:       8082,
+				EmptyDirDefaultSize:        "1Gi",
+				InitGatePort:               8083,
+				TerminatedWorkloadPolicy:   "delete",
+				InstanceSizes:              defaultInstanceSizes,
+				InstanceSizePolicy:         "always-round-up",
+				InstanceSizeRatioTolerance: 2,
+				SidecarInstanceSize:        "SP-1",
+				LocationsCachePath:         "/var/lib/vk-stackpath-provider/locations.json",
+				ReadyQuorum:                "all",
+				StatsCacheTTLSeconds:       60,
+			},
+			expectedError: nil,
+		},
+		{
+			description:    "successfully loads the gRPC probe gateway config from a file.",
+			configFilename: "grpc_probe_config.yaml",
+			init: func(configFilename string) {
+				os.Setenv("SP_CONFIG_LOCATION", configFilename)
+				config := Config{
+					StackID:               "a7188caa-e29b-11ed-b5ea-0242ac120003",
+					ClientID:              "123",
+					ClientSecret:          "123",
+					CityCode:              "DFW",
+					GRPCProbeStrategy:     "gateway",
+					GRPCProbeGatewayImage: "stackpath/grpc-health-gateway:latest",
+					GRPCProbeGatewayPort:  9090,
+				}
+				data, err := yaml.Marshal(&config)
+				if err != nil {
+					t.Fatal("couldn't serialize the config")
+				}
+				err = os.WriteFile(configFilename, data, 0777)
+				if err != nil {
+					t.Fatalf("couldn't write the config to the file %s", configFilename)
+				}
+			},
+			expectedConfig: &Config{
+				StackID:                    "a7188caa-e29b-11ed-b5ea-0242ac120003",
+				ClientID:                   "123",
+				ApiHost:                    "gateway.stackpath.com",
+				ClientSecret:               "123",
+				CityCode:                   "DFW",
+				CityCodes:                  []string{"DFW"},
+				ExecBackend:                "none",
+				ExecAgentPort:              10250,
+				ExecProbeStrategy:          "ignore",
+				ExecProbeShimPort:          8081,
+				GRPCProbeStrategy:          "gateway",
+				GRPCProbeGatewayImage:      "stackpath/grpc-health-gateway:latest",
+				GRPCProbeGatewayPort:       9090,
+				EmptyDirDefaultSize:        "1Gi",
+				InitGatePort:               8083,
+				TerminatedWorkloadPolicy:   "delete",
+				InstanceSizes:              defaultInstanceSizes,
+				InstanceSizePolicy:         "always-round-up",
+				InstanceSizeRatioTolerance: 2,
+				SidecarInstanceSize:        "SP-1",
+				LocationsCachePath:         "/var/lib/vk-stackpath-provider/locations.json",
+				ReadyQuorum:                "all",
+				StatsCacheTTLSeconds:       60,
 			},
 			expectedError: nil,
 		},
@@ -118,12 +286,31 @@ func TestNewConfigFromFile(t *testing.T) {
 func TestNewConfigFromEnvVars(t *testing.T) {
 
 	testCases := []struct {
-		stackID       string
-		clientID      string
-		apiHost       string
-		clientSecret  string
-		cityCode      string
-		expectedError error
+		stackID             string
+		clientID            string
+		apiHost             string
+		clientSecret        string
+		cityCode            string
+		cityCodes           string
+		execBackend         string
+		execAgentPort       string
+		execAgentDisableTLS string
+		execAgentCAFile     string
+		probeStrategy       string
+		shimImage           string
+		shimPort            string
+		grpcStrategy        string
+		gatewayImage        string
+		gatewayPort         string
+		emptyDirSize        string
+		initGatePort        string
+		terminated          string
+		sizes               string
+		sizePolicy          string
+		sidecarSize         string
+		readyQuorum         string
+		statsCacheTTL       string
+		expectedError       error
 	}{
 		{
 			stackID:       "",
@@ -189,6 +376,365 @@ func TestNewConfigFromEnvVars(t *testing.T) {
 			cityCode:      "dfw",
 			expectedError: nil,
 		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			execBackend:   "ssh",
+			expectedError: fmt.Errorf("exec backend \"ssh\" is not supported"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			execBackend:   "agent",
+			execAgentPort: "port",
+			expectedError: fmt.Errorf("exec agent port must be a number"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			execBackend:   "agent",
+			execAgentPort: "70000",
+			expectedError: fmt.Errorf("must provide a valid exec agent port"),
+		},
+		{
+			stackID:             "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:            "123",
+			apiHost:             "",
+			clientSecret:        "1234",
+			cityCode:            "dfw",
+			execBackend:         "agent",
+			execAgentDisableTLS: "maybe",
+			expectedError:       fmt.Errorf("exec agent disable TLS must be either true or false"),
+		},
+		{
+			stackID:             "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:            "123",
+			apiHost:             "",
+			clientSecret:        "1234",
+			cityCode:            "dfw",
+			execBackend:         "agent",
+			execAgentPort:       "8022",
+			execAgentDisableTLS: "true",
+			expectedError:       nil,
+		},
+		{
+			stackID:             "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:            "123",
+			apiHost:             "",
+			clientSecret:        "1234",
+			cityCode:            "dfw",
+			execBackend:         "agent",
+			execAgentDisableTLS: "true",
+			execAgentCAFile:     "/etc/vk-stackpath-provider/exec-agent-ca.pem",
+			expectedError:       fmt.Errorf("exec agent CA file and server name can't be set when TLS is disabled"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			probeStrategy: "retry",
+			expectedError: fmt.Errorf("exec probe strategy \"retry\" is not supported"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			probeStrategy: "shim",
+			expectedError: fmt.Errorf("must provide an exec probe shim image"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			probeStrategy: "shim",
+			shimImage:     "stackpath/exec-probe-shim:latest",
+			shimPort:      "port",
+			expectedError: fmt.Errorf("exec probe shim port must be a number"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			probeStrategy: "shim",
+			shimImage:     "stackpath/exec-probe-shim:latest",
+			shimPort:      "70000",
+			expectedError: fmt.Errorf("must provide a valid exec probe shim port"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			probeStrategy: "shim",
+			shimImage:     "stackpath/exec-probe-shim:latest",
+			shimPort:      "8081",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			grpcStrategy:  "http",
+			expectedError: fmt.Errorf("gRPC probe strategy \"http\" is not supported"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			grpcStrategy:  "gateway",
+			expectedError: fmt.Errorf("must provide a gRPC probe gateway image"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			grpcStrategy:  "gateway",
+			gatewayImage:  "stackpath/grpc-health-gateway:latest",
+			gatewayPort:   "port",
+			expectedError: fmt.Errorf("gRPC probe gateway port must be a number"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			grpcStrategy:  "gateway",
+			gatewayImage:  "stackpath/grpc-health-gateway:latest",
+			gatewayPort:   "70000",
+			expectedError: fmt.Errorf("must provide a valid gRPC probe gateway port"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			grpcStrategy:  "gateway",
+			gatewayImage:  "stackpath/grpc-health-gateway:latest",
+			gatewayPort:   "9090",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			emptyDirSize:  "big",
+			expectedError: fmt.Errorf("empty dir default size \"big\" is not a valid size"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			emptyDirSize:  "10Gi",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			initGatePort:  "port",
+			expectedError: fmt.Errorf("init gate port must be a number"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			initGatePort:  "-1",
+			expectedError: fmt.Errorf("must provide a valid init gate port"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			terminated:    "keep",
+			expectedError: fmt.Errorf("terminated workload policy \"keep\" is not supported"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			terminated:    "retain",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			sizes:         "SP-1:1:2Gi,SP-2",
+			expectedError: fmt.Errorf("instance sizes must be formatted as name:cpu:memory"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			sizes:         "small:1:2Gi,small:2:4Gi",
+			expectedError: fmt.Errorf("instance size small is defined more than once"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			sizes:         "small:one:2Gi",
+			expectedError: fmt.Errorf("instance size small has an invalid CPU \"one\""),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			sizes:         "small:500m:1Gi, large:16:64Gi",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			sizes:         "small:500m:1Gi, large:16:64Gi",
+			sidecarSize:   "large",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			sidecarSize:   "SP-0",
+			expectedError: fmt.Errorf("sidecar instance size SP-0 is not one of the instance sizes"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			sizePolicy:    "round-down",
+			expectedError: fmt.Errorf("instance size policy \"round-down\" is not supported"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			sizePolicy:    "nearest-fit",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCodes:     "dfw, atl,ams",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			cityCodes:     "atl,ams",
+			expectedError: fmt.Errorf("city code DFW is not in the list of city codes"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCodes:     "dfw,dfw",
+			expectedError: fmt.Errorf("city code DFW is listed more than once"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCodes:     "dfw,dallas",
+			expectedError: fmt.Errorf("must provide a valid city code"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCodes:     "dfw,atl,ams",
+			readyQuorum:   "2",
+			expectedError: nil,
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			readyQuorum:   "most",
+			expectedError: fmt.Errorf("ready quorum \"most\" is not supported"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			statsCacheTTL: "-15",
+			expectedError: fmt.Errorf("stats cache TTL must be a positive number of seconds"),
+		},
+		{
+			stackID:       "a7188caa-e29b-11ed-b5ea-0242ac120003",
+			clientID:      "123",
+			apiHost:       "",
+			clientSecret:  "1234",
+			cityCode:      "dfw",
+			statsCacheTTL: "1m",
+			expectedError: fmt.Errorf("stats cache TTL must be a number of seconds"),
+		},
 	}
 
 	ctx := context.TODO()
@@ -199,6 +745,25 @@ func TestNewConfigFromEnvVars(t *testing.T) {
 		os.Setenv("SP_CLIENT_SECRET", c.clientSecret)
 		os.Setenv("SP_API_HOST", c.apiHost)
 		os.Setenv("SP_CITY_CODE", c.cityCode)
+		os.Setenv("SP_CITY_CODES", c.cityCodes)
+		os.Setenv("SP_EXEC_BACKEND", c.execBackend)
+		os.Setenv("SP_EXEC_AGENT_PORT", c.execAgentPort)
+		os.Setenv("SP_EXEC_AGENT_DISABLE_TLS", c.execAgentDisableTLS)
+		os.Setenv("SP_EXEC_AGENT_CA_FILE", c.execAgentCAFile)
+		os.Setenv("SP_EXEC_PROBE_STRATEGY", c.probeStrategy)
+		os.Setenv("SP_EXEC_PROBE_SHIM_IMAGE", c.shimImage)
+		os.Setenv("SP_EXEC_PROBE_SHIM_PORT", c.shimPort)
+		os.Setenv("SP_GRPC_PROBE_STRATEGY", c.grpcStrategy)
+		os.Setenv("SP_GRPC_PROBE_GATEWAY_IMAGE", c.gatewayImage)
+		os.Setenv("SP_GRPC_PROBE_GATEWAY_PORT", c.gatewayPort)
+		os.Setenv("SP_EMPTY_DIR_DEFAULT_SIZE", c.emptyDirSize)
+		os.Setenv("SP_INIT_GATE_PORT", c.initGatePort)
+		os.Setenv("SP_TERMINATED_WORKLOAD_POLICY", c.terminated)
+		os.Setenv("SP_INSTANCE_SIZES", c.sizes)
+		os.Setenv("SP_INSTANCE_SIZE_POLICY", c.sizePolicy)
+		os.Setenv("SP_SIDECAR_INSTANCE_SIZE", c.sidecarSize)
+		os.Setenv("SP_READY_QUORUM", c.readyQuorum)
+		os.Setenv("SP_STATS_CACHE_TTL_SECONDS", c.statsCacheTTL)
 
 		_, err := NewConfig(ctx)
 		if c.expectedError != nil || err != nil {
@@ -206,3 +771,51 @@ func TestNewConfigFromEnvVars(t *testing.T) {
 		}
 	}
 }
+
+func TestGetReadyQuorum(t *testing.T) {
+	testCases := []struct {
+		quorum        string
+		instances     int
+		expected      int
+		expectedError error
+	}{
+		{quorum: "all", instances: 3, expected: 3},
+		{quorum: "majority", instances: 3, expected: 2},
+		{quorum: "majority", instances: 4, expected: 3},
+		{quorum: "any", instances: 3, expected: 1},
+		{quorum: "2", instances: 3, expected: 2},
+		{quorum: "5", instances: 3, expected: 3},
+		{quorum: "0", instances: 3, expectedError: fmt.Errorf("ready quorum \"0\" is not supported")},
+	}
+
+	for _, c := range testCases {
+		quorum, err := GetReadyQuorum(c.quorum, c.instances)
+		if c.expectedError != nil {
+			assert.Equal(t, c.expectedError, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, quorum)
+	}
+}
+
+func TestGetSidecarInstanceSize(t *testing.T) {
+	sizes := []InstanceSize{
+		{Name: "large", CPU: "16", Memory: "64Gi"},
+		{Name: "small", CPU: "500m", Memory: "2Gi"},
+		{Name: "tiny", CPU: "500m", Memory: "1Gi"},
+	}
+
+	testCases := []struct {
+		sidecarSize string
+		expected    string
+	}{
+		{sidecarSize: "", expected: "tiny"},
+		{sidecarSize: "large", expected: "large"},
+	}
+
+	for _, c := range testCases {
+		config := Config{InstanceSizes: sizes, SidecarInstanceSize: c.sidecarSize}
+		assert.Equal(t, c.expected, config.GetSidecarInstanceSize().Name)
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// the number of edits a city code of the catalogue may differ by from a mistyped one to be suggested in its place
+const maxLocationSuggestionDistance = 1
+
+// locationsCache is the content of the file the catalogue of the StackPath locations is cached in
+type locationsCache struct {
+	UpdatedAt time.Time                             `json:"updatedAt"`
+	Locations []*workload_models.Workloadv1Location `json:"locations"`
+}
+
+// LoadLocations returns the catalogue of the locations StackPath workloads can be created in, reading every page of
+// it from the StackPath API. The catalogue is then cached on disk, and read from the cache instead when the API is
+// unavailable, so the provider still starts during short outages of the API.
+func (config *Config) LoadLocations(ctx context.Context, client workloads.ClientService) ([]*workload_models.Workloadv1Location, error) {
+	locations, err := getLocations(ctx, client)
+	if err == nil {
+		if err := writeLocationsCache(config.LocationsCachePath, locations); err != nil {
+			log.G(ctx).WithError(err).Warnf("failed to cache the StackPath locations in %s", config.LocationsCachePath)
+		}
+		return locations, nil
+	}
+
+	cache, cacheErr := readLocationsCache(config.LocationsCachePath)
+	if cacheErr != nil {
+		return nil, fmt.Errorf("failed to get the StackPath locations: %w", err)
+	}
+	log.G(ctx).WithError(err).Warnf("failed to get the StackPath locations, using the ones cached in %s on %s",
+		config.LocationsCachePath, cache.UpdatedAt.Format(time.RFC3339))
+	return cache.Locations, nil
+}
+
+// ValidateLocations checks that every city code is one of the locations of the catalogue. The city codes of
+// the catalogue that are the closest to the ones which aren't are suggested in the error.
+func (config *Config) ValidateLocations(locations []*workload_models.Workloadv1Location) error {
+	for _, cityCode := range config.CityCodes {
+		if FindLocation(locations, cityCode) != nil {
+			continue
+		}
+		if suggestions := getLocationSuggestions(locations, cityCode); len(suggestions) > 0 {
+			return fmt.Errorf("city code %s is not a StackPath location, did you mean %s?", cityCode, strings.Join(suggestions, " or "))
+		}
+		return fmt.Errorf("city code %s is not a StackPath location", cityCode)
+	}
+	return nil
+}
+
+// FindLocation returns the location of the city code, or nil when it isn't in the catalogue
+func FindLocation(locations []*workload_models.Workloadv1Location, cityCode string) *workload_models.Workloadv1Location {
+	for _, location := range locations {
+		if strings.EqualFold(location.CityCode, cityCode) {
+			return location
+		}
+	}
+	return nil
+}
+
+// getLocations reads the catalogue of the locations from the StackPath API, following the pages of the catalogue
+// until the last one
+func getLocations(ctx context.Context, client workloads.ClientService) ([]*workload_models.Workloadv1Location, error) {
+	var locations []*workload_models.Workloadv1Location
+	var after *string
+	for {
+		params := &workloads.GetLocationsParams{
+			Context:          ctx,
+			PageRequestAfter: after,
+		}
+		response, err := client.GetLocations(params, nil)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, response.Payload.Results...)
+
+		pageInfo := response.Payload.PageInfo
+		if pageInfo == nil || !pageInfo.HasNextPage {
+			return locations, nil
+		}
+		if pageInfo.EndCursor == "" || (after != nil && *after == pageInfo.EndCursor) {
+			return nil, errors.New("the pages of the StackPath locations don't advance")
+		}
+		endCursor := pageInfo.EndCursor
+		after = &endCursor
+	}
+}
+
+// getLocationSuggestions returns the sorted city codes of the catalogue that are a few edits away from the city code
+func getLocationSuggestions(locations []*workload_models.Workloadv1Location, cityCode string) []string {
+	var suggestions []string
+	for _, location := range locations {
+		if getEditDistance(strings.ToUpper(location.CityCode), strings.ToUpper(cityCode)) <= maxLocationSuggestionDistance {
+			suggestions = append(suggestions, location.CityCode)
+		}
+	}
+	sort.Strings(suggestions)
+	return suggestions
+}
+
+// writeLocationsCache writes the catalogue to the cache file, replacing it as a whole
+func writeLocationsCache(path string, locations []*workload_models.Workloadv1Location) error {
+	data, err := json.Marshal(locationsCache{UpdatedAt: time.Now(), Locations: locations})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// the catalogue is written to a temporary file first, so the cache file is never partially written
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// readLocationsCache reads the catalogue from the cache file
+func readLocationsCache(path string) (*locationsCache, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cache := &locationsCache{}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, err
+	}
+	if len(cache.Locations) == 0 {
+		return nil, fmt.Errorf("the cache %s has no locations", path)
+	}
+	return cache, nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadLocations(t *testing.T) {
+	ctx := context.Background()
+
+	dfw := &workload_models.Workloadv1Location{City: "Dallas", CityCode: "DFW"}
+	jfk := &workload_models.Workloadv1Location{City: "New York", CityCode: "JFK"}
+
+	response := func(pageInfo *workload_models.PaginationPageInfo, locations ...*workload_models.Workloadv1Location) *workloads.GetLocationsOK {
+		return &workloads.GetLocationsOK{Payload: &workload_models.V1GetLocationsResponse{PageInfo: pageInfo, Results: locations}}
+	}
+
+	t.Run("reads every page of the catalogue and caches it", func(t *testing.T) {
+		config := &Config{LocationsCachePath: filepath.Join(t.TempDir(), "cache", "locations.json")}
+
+		wsc := mocks.NewWorkloadsClientService(gomock.NewController(t))
+		wsc.EXPECT().GetLocations(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(params *workloads.GetLocationsParams, _ interface{}, _ ...workloads.ClientOption) (*workloads.GetLocationsOK, error) {
+				if params.PageRequestAfter == nil {
+					return response(&workload_models.PaginationPageInfo{HasNextPage: true, EndCursor: "1"}, dfw), nil
+				}
+				assert.Equal(t, "1", *params.PageRequestAfter)
+				return response(&workload_models.PaginationPageInfo{EndCursor: "2"}, jfk), nil
+			}).Times(2)
+
+		locations, err := config.LoadLocations(ctx, wsc)
+		assert.NoError(t, err)
+		assert.Equal(t, []*workload_models.Workloadv1Location{dfw, jfk}, locations)
+
+		cache, err := readLocationsCache(config.LocationsCachePath)
+		assert.NoError(t, err)
+		assert.Equal(t, locations, cache.Locations)
+	})
+
+	t.Run("reads the catalogue from the cache when the API is unavailable", func(t *testing.T) {
+		config := &Config{LocationsCachePath: filepath.Join(t.TempDir(), "locations.json")}
+		assert.NoError(t, writeLocationsCache(config.LocationsCachePath, []*workload_models.Workloadv1Location{dfw}))
+
+		wsc := mocks.NewWorkloadsClientService(gomock.NewController(t))
+		wsc.EXPECT().GetLocations(gomock.Any(), gomock.Any()).Return(nil, errors.New("service unavailable"))
+
+		locations, err := config.LoadLocations(ctx, wsc)
+		assert.NoError(t, err)
+		assert.Equal(t, []*workload_models.Workloadv1Location{dfw}, locations)
+	})
+
+	t.Run("fails when the API is unavailable and the catalogue isn't cached", func(t *testing.T) {
+		config := &Config{LocationsCachePath: filepath.Join(t.TempDir(), "locations.json")}
+
+		wsc := mocks.NewWorkloadsClientService(gomock.NewController(t))
+		wsc.EXPECT().GetLocations(gomock.Any(), gomock.Any()).Return(nil, errors.New("service unavailable"))
+
+		_, err := config.LoadLocations(ctx, wsc)
+		assert.EqualError(t, err, "failed to get the StackPath locations: service unavailable")
+	})
+
+	t.Run("fails when the pages of the catalogue don't advance", func(t *testing.T) {
+		config := &Config{LocationsCachePath: filepath.Join(t.TempDir(), "locations.json")}
+
+		wsc := mocks.NewWorkloadsClientService(gomock.NewController(t))
+		wsc.EXPECT().GetLocations(gomock.Any(), gomock.Any()).Return(response(&workload_models.PaginationPageInfo{HasNextPage: true, EndCursor: "1"}, dfw), nil).Times(2)
+
+		_, err := config.LoadLocations(ctx, wsc)
+		assert.EqualError(t, err, "failed to get the StackPath locations: the pages of the StackPath locations don't advance")
+	})
+}
+
+func TestValidateLocations(t *testing.T) {
+	locations := []*workload_models.Workloadv1Location{{CityCode: "DFW"}, {CityCode: "DXB"}, {CityCode: "JFK"}, {CityCode: "ATL"}}
+
+	testCases := []struct {
+		cityCodes     []string
+		expectedError string
+	}{
+		{
+			cityCodes: []string{"DFW", "JFK"},
+		},
+		{
+			cityCodes:     []string{"DFW", "DFX"},
+			expectedError: "city code DFX is not a StackPath location, did you mean DFW?",
+		},
+		{
+			cityCodes:     []string{"DXW"},
+			expectedError: "city code DXW is not a StackPath location, did you mean DFW or DXB?",
+		},
+		{
+			cityCodes:     []string{"LAX"},
+			expectedError: "city code LAX is not a StackPath location",
+		},
+	}
+
+	for _, c := range testCases {
+		config := &Config{CityCodes: c.cityCodes}
+		err := config.ValidateLocations(locations)
+		if c.expectedError == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, c.expectedError)
+		}
+	}
+}
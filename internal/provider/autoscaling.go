@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The annotations of the pods scaled by StackPath, which runs between the minimum and the maximum number of
+	// instances of the pod in each of its locations, scaling them to keep their average CPU utilisation at the
+	// target, e.g.
+	//
+	//	autoscaling.vk.stackpath.com/min-replicas: "2"
+	//	autoscaling.vk.stackpath.com/max-replicas: "10"
+	//	autoscaling.vk.stackpath.com/target-cpu-utilization: "70"
+	minReplicasAnnotation          = "autoscaling.vk.stackpath.com/min-replicas"
+	maxReplicasAnnotation          = "autoscaling.vk.stackpath.com/max-replicas"
+	targetCPUUtilizationAnnotation = "autoscaling.vk.stackpath.com/target-cpu-utilization"
+
+	// the StackPath metric the instances are scaled on
+	cpuScaleMetric = "cpu"
+)
+
+// autoscalingSpec is the number of instances a pod runs in each of its locations
+type autoscalingSpec struct {
+	minReplicas int32
+	maxReplicas int32
+	// the average CPU utilisation percentage the instances are scaled to, none when the number of instances is fixed
+	targetCPUUtilization int32
+}
+
+// isAutoscaled returns whether the pod may run more than one instance in a location
+func isAutoscaled(pod *v1.Pod) bool {
+	for _, key := range []string{minReplicasAnnotation, maxReplicasAnnotation, targetCPUUtilizationAnnotation} {
+		if _, ok := pod.Annotations[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSeveralInstances returns whether the pod may run more than its instance in the location of its node,
+// whose status is then aggregated across its instances
+func hasSeveralInstances(pod *v1.Pod) bool {
+	return isMultiLocation(pod) || isAutoscaled(pod)
+}
+
+// getAutoscalingSpecFrom returns the number of instances the pod runs in each of its locations, which is one
+// unless the pod is autoscaled. The maximum number of instances defaults to the minimum one, and a CPU utilisation
+// target is required for StackPath to scale the instances between the two.
+func getAutoscalingSpecFrom(pod *v1.Pod) (*autoscalingSpec, error) {
+	spec := &autoscalingSpec{minReplicas: 1, maxReplicas: 1}
+	if !isAutoscaled(pod) {
+		return spec, nil
+	}
+
+	parse := func(key string, min, max int64) (int32, error) {
+		value, err := strconv.ParseInt(pod.Annotations[key], 10, 32)
+		if err != nil || value < min || value > max {
+			return 0, fmt.Errorf("the annotation %s must be a number between %d and %d", key, min, max)
+		}
+		return int32(value), nil
+	}
+
+	var err error
+	if _, ok := pod.Annotations[minReplicasAnnotation]; ok {
+		if spec.minReplicas, err = parse(minReplicasAnnotation, 1, 1<<31-1); err != nil {
+			return nil, err
+		}
+	}
+	spec.maxReplicas = spec.minReplicas
+	if _, ok := pod.Annotations[maxReplicasAnnotation]; ok {
+		if spec.maxReplicas, err = parse(maxReplicasAnnotation, int64(spec.minReplicas), 1<<31-1); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := pod.Annotations[targetCPUUtilizationAnnotation]; ok {
+		if spec.targetCPUUtilization, err = parse(targetCPUUtilizationAnnotation, 1, 100); err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.maxReplicas > spec.minReplicas && spec.targetCPUUtilization == 0 {
+		return nil, fmt.Errorf("the annotation %s must be set to scale the instances between %d and %d",
+			targetCPUUtilizationAnnotation, spec.minReplicas, spec.maxReplicas)
+	}
+	return spec, nil
+}
+
+// getDeploymentSpec returns the deployment of the instances of a workload target in the location
+func (spec *autoscalingSpec) getDeploymentSpec(cityCode string) *workload_models.V1DeploymentSpec {
+	deployment := &workload_models.V1DeploymentSpec{
+		MinReplicas: spec.minReplicas,
+		MaxReplicas: spec.maxReplicas,
+		Selectors:   []*workload_models.V1MatchExpression{{Key: "cityCode", Operator: "in", Values: []string{cityCode}}},
+	}
+	if spec.targetCPUUtilization > 0 {
+		deployment.ScaleSettings = &workload_models.V1ScaleSettings{
+			Metrics: []*workload_models.V1MetricSpec{{Metric: cpuScaleMetric, AverageUtilization: spec.targetCPUUtilization}},
+		}
+	}
+	return deployment
+}
@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instances"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestGetWorkloadTargetsFromAutoscaledPods(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	testCases := []struct {
+		description        string
+		annotations        map[string]string
+		expectedDeployment *workload_models.V1DeploymentSpec
+		expectedError      string
+	}{
+		{
+			description: "scales the instances between the minimum and the maximum on their CPU utilisation",
+			annotations: map[string]string{minReplicasAnnotation: "2", maxReplicasAnnotation: "5", targetCPUUtilizationAnnotation: "70"},
+			expectedDeployment: &workload_models.V1DeploymentSpec{
+				MinReplicas: 2,
+				MaxReplicas: 5,
+				ScaleSettings: &workload_models.V1ScaleSettings{
+					Metrics: []*workload_models.V1MetricSpec{{Metric: "cpu", AverageUtilization: 70}},
+				},
+				Selectors: []*workload_models.V1MatchExpression{{Key: "cityCode", Operator: "in", Values: []string{"JFK"}}},
+			},
+		},
+		{
+			description: "runs a fixed number of instances without a maximum",
+			annotations: map[string]string{minReplicasAnnotation: "3"},
+			expectedDeployment: &workload_models.V1DeploymentSpec{
+				MinReplicas: 3,
+				MaxReplicas: 3,
+				Selectors:   []*workload_models.V1MatchExpression{{Key: "cityCode", Operator: "in", Values: []string{"JFK"}}},
+			},
+		},
+		{
+			description:   "fails without a CPU utilisation target to scale on",
+			annotations:   map[string]string{maxReplicasAnnotation: "4"},
+			expectedError: "the annotation autoscaling.vk.stackpath.com/target-cpu-utilization must be set to scale the instances between 1 and 4",
+		},
+		{
+			description:   "fails for a maximum below the minimum",
+			annotations:   map[string]string{minReplicasAnnotation: "3", maxReplicasAnnotation: "2", targetCPUUtilizationAnnotation: "50"},
+			expectedError: "the annotation autoscaling.vk.stackpath.com/max-replicas must be a number between 3 and 2147483647",
+		},
+		{
+			description:   "fails for a CPU utilisation target which isn't a percentage",
+			annotations:   map[string]string{maxReplicasAnnotation: "2", targetCPUUtilizationAnnotation: "150"},
+			expectedError: "the annotation autoscaling.vk.stackpath.com/target-cpu-utilization must be a number between 1 and 100",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			targets, err := provider.getWorkloadTargetsFrom(createTestPodWithAnnotations(c.annotations))
+			if c.expectedError != "" {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, targets, 1)
+			assert.Equal(t, c.expectedDeployment, targets[targetName].Spec.Deployments)
+		})
+	}
+}
+
+func TestGetAutoscaledPodStatus(t *testing.T) {
+	ctx := context.Background()
+
+	mockController := gomock.NewController(t)
+	isc := mocks.NewInstancesClientService(mockController)
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, &workload_client.EdgeCompute{Instances: isc})
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	// the instance of the ordinal 0 was scaled in, and an instance scaled out isn't ready yet
+	isc.EXPECT().GetWorkloadInstances(gomock.Any(), nil).Return(&instances.GetWorkloadInstancesOK{
+		Payload: &workload_models.V1GetWorkloadInstancesResponse{
+			Results: []*workload_models.Workloadv1Instance{
+				createTestPodInstance("test-ns-test-pod-city-code-jfk-3", workload_models.Workloadv1InstanceInstancePhaseRUNNING, false, "10.0.0.4"),
+				createTestPodInstance("test-ns-test-pod-city-code-jfk-1", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+				createTestPodInstance("test-ns-test-pod-city-code-jfk-2", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.3"),
+			},
+		},
+	}, nil)
+
+	pod := createTestPodWithAnnotations(map[string]string{minReplicasAnnotation: "2", maxReplicasAnnotation: "4", targetCPUUtilizationAnnotation: "60"})
+
+	status, err := provider.getPodStatus(ctx, pod)
+	assert.NoError(t, err)
+	assert.Equal(t, v1.PodRunning, status.Phase)
+	assert.Equal(t, "10.0.0.2", status.PodIP)
+	assert.Equal(t, []v1.PodIP{{IP: "10.0.0.2"}, {IP: "10.0.0.3"}, {IP: "10.0.0.4"}}, status.PodIPs)
+
+	// the pod is ready once all the instances it always runs are
+	for _, condition := range status.Conditions {
+		if condition.Type == v1.PodReady {
+			assert.Equal(t, v1.ConditionTrue, condition.Status)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// unknownPodIP is the value of the status.podIP field of the downward API. The IP address of a pod is
+// the one of its instance, which is only known once StackPath has scheduled the workload, after the
+// environment of its containers is set. The unspecified address lets the services that bind to the
+// pod's IP listen on the instance's interfaces; the ones that advertise it must resolve it at runtime.
+const unknownPodIP = "0.0.0.0"
+
+// getPodFieldValue returns the value of a field of the pod selected through the downward API
+func (p *StackpathProvider) getPodFieldValue(pod *v1.Pod, fieldPath string) (string, error) {
+	if path, key, ok := splitSubscriptedFieldPath(fieldPath); ok {
+		switch path {
+		case "metadata.labels":
+			return pod.Labels[key], nil
+		case "metadata.annotations":
+			return pod.Annotations[key], nil
+		}
+		return "", fmt.Errorf("unsupported field path %s", fieldPath)
+	}
+
+	switch fieldPath {
+	case "metadata.name":
+		return pod.Name, nil
+	case "metadata.namespace":
+		return pod.Namespace, nil
+	case "metadata.uid":
+		return string(pod.UID), nil
+	case "spec.nodeName":
+		if pod.Spec.NodeName != "" {
+			return pod.Spec.NodeName, nil
+		}
+		return p.nodeName, nil
+	case "spec.serviceAccountName":
+		return pod.Spec.ServiceAccountName, nil
+	case "status.hostIP", "status.hostIPs":
+		return p.internalIP, nil
+	case "status.podIP", "status.podIPs":
+		p.logger.Infof("the pod IP isn't known before the workload of the pod %s/%s is scheduled, using %s", pod.Namespace, pod.Name, unknownPodIP)
+		return unknownPodIP, nil
+	}
+	return "", fmt.Errorf("unsupported field path %s", fieldPath)
+}
+
+// splitSubscriptedFieldPath splits a field path of the form metadata.labels['key'] into its path and key
+func splitSubscriptedFieldPath(fieldPath string) (string, string, bool) {
+	if !strings.HasSuffix(fieldPath, "']") {
+		return "", "", false
+	}
+	parts := strings.SplitN(fieldPath, "['", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], strings.TrimSuffix(parts[1], "']"), true
+}
+
+// getContainerResourceValue returns the value of a resource of a container selected through the downward API.
+// The containers run with the resources of the instance size picked for them, which are both their requests
+// and limits, so those are the values returned rather than the ones of the container's spec.
+func (p *StackpathProvider) getContainerResourceValue(pod *v1.Pod, k8sContainer *v1.Container, selector *v1.ResourceFieldSelector) (string, error) {
+	container := k8sContainer
+	if selector.ContainerName != "" && selector.ContainerName != k8sContainer.Name {
+		container = nil
+		podContainers := getPodContainers(pod)
+		for i := range podContainers {
+			if podContainers[i].Name == selector.ContainerName {
+				container = &podContainers[i]
+			}
+		}
+		if container == nil {
+			return "", fmt.Errorf("container %s is not found in pod %s/%s", selector.ContainerName, pod.Namespace, pod.Name)
+		}
+	}
+
+	var resourceName v1.ResourceName
+	switch selector.Resource {
+	case "limits.cpu", "requests.cpu":
+		resourceName = v1.ResourceCPU
+	case "limits.memory", "requests.memory":
+		resourceName = v1.ResourceMemory
+	default:
+		return "", fmt.Errorf("unsupported container resource %s", selector.Resource)
+	}
+
+	resources, err := p.getWorkloadContainerResourcesFrom(container)
+	if err != nil {
+		return "", err
+	}
+	quantity, err := resource.ParseQuantity(resources.Limits[string(resourceName)])
+	if err != nil {
+		return "", err
+	}
+
+	divisor := selector.Divisor
+	if divisor.IsZero() {
+		divisor = resource.MustParse("1")
+	}
+
+	// Same as the kubelet, the value is rounded up to the next multiple of the divisor
+	var value float64
+	if resourceName == v1.ResourceCPU {
+		value = math.Ceil(float64(quantity.MilliValue()) / float64(divisor.MilliValue()))
+	} else {
+		value = math.Ceil(float64(quantity.Value()) / float64(divisor.Value()))
+	}
+	return strconv.FormatInt(int64(value), 10), nil
+}
@@ -0,0 +1,142 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPodFieldValue(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := &v1.Pod{}
+	pod.Name = "test-pod"
+	pod.Namespace = "test-ns"
+	pod.UID = "6b2cbd2a-3f1a-4b36-a3f4-8c3e0e1a5d1f"
+	pod.Labels = map[string]string{"app": "nginx"}
+	pod.Annotations = map[string]string{"example.com/owner": "team"}
+	pod.Spec.ServiceAccountName = "default"
+
+	var tests = []struct {
+		fieldPath     string
+		expectedValue string
+		expectedError string
+	}{
+		{fieldPath: "metadata.name", expectedValue: "test-pod"},
+		{fieldPath: "metadata.namespace", expectedValue: "test-ns"},
+		{fieldPath: "metadata.uid", expectedValue: "6b2cbd2a-3f1a-4b36-a3f4-8c3e0e1a5d1f"},
+		{fieldPath: "metadata.labels['app']", expectedValue: "nginx"},
+		{fieldPath: "metadata.labels['missing']", expectedValue: ""},
+		{fieldPath: "metadata.annotations['example.com/owner']", expectedValue: "team"},
+		{fieldPath: "spec.nodeName", expectedValue: provider.nodeName},
+		{fieldPath: "spec.serviceAccountName", expectedValue: "default"},
+		{fieldPath: "status.hostIP", expectedValue: "127.0.0.1"},
+		{fieldPath: "status.podIP", expectedValue: unknownPodIP},
+		{fieldPath: "metadata.generateName", expectedError: "unsupported field path metadata.generateName"},
+		{fieldPath: "spec.containers['app']", expectedError: "unsupported field path spec.containers['app']"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fieldPath, func(t *testing.T) {
+			value, err := provider.getPodFieldValue(pod, test.fieldPath)
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, value)
+		})
+	}
+}
+
+func TestContainerResourceValue(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := &v1.Pod{}
+	pod.Name = "test-pod"
+	pod.Namespace = "test-ns"
+	pod.Spec.Containers = []v1.Container{
+		{
+			Name: "app",
+			// picks the SP-2 size, 2 CPUs and 4Gi of memory
+			Resources: v1.ResourceRequirements{
+				Limits: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("1500m"),
+					v1.ResourceMemory: resource.MustParse("3Gi"),
+				},
+			},
+		},
+		{
+			// picks the default SP-1 size, 1 CPU and 2Gi of memory
+			Name: "sidecar",
+		},
+	}
+
+	var tests = []struct {
+		description   string
+		selector      v1.ResourceFieldSelector
+		expectedValue string
+		expectedError string
+	}{
+		{
+			description:   "cpu limit of the instance size",
+			selector:      v1.ResourceFieldSelector{Resource: "limits.cpu"},
+			expectedValue: "2",
+		},
+		{
+			description:   "cpu request in millicores",
+			selector:      v1.ResourceFieldSelector{Resource: "requests.cpu", Divisor: resource.MustParse("1m")},
+			expectedValue: "2000",
+		},
+		{
+			description:   "memory limit of the instance size",
+			selector:      v1.ResourceFieldSelector{Resource: "limits.memory"},
+			expectedValue: "4294967296",
+		},
+		{
+			description:   "memory limit rounded up to the divisor",
+			selector:      v1.ResourceFieldSelector{Resource: "limits.memory", Divisor: resource.MustParse("3Gi")},
+			expectedValue: "2",
+		},
+		{
+			description:   "resource of another container",
+			selector:      v1.ResourceFieldSelector{ContainerName: "sidecar", Resource: "limits.memory", Divisor: resource.MustParse("1Mi")},
+			expectedValue: "2048",
+		},
+		{
+			description:   "resource of a container that doesn't exist",
+			selector:      v1.ResourceFieldSelector{ContainerName: "missing", Resource: "limits.cpu"},
+			expectedError: "container missing is not found in pod test-ns/test-pod",
+		},
+		{
+			description:   "unsupported resource",
+			selector:      v1.ResourceFieldSelector{Resource: "limits.ephemeral-storage"},
+			expectedError: "unsupported container resource limits.ephemeral-storage",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			value, err := provider.getContainerResourceValue(pod, &pod.Spec.Containers[0], &test.selector)
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, value)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// getWorkloadContainerEnvFromSources returns the environment variables set from every key of the ConfigMaps and Secrets
+// the container's envFrom references. As with the kubelet, a key of a source overrides the same key of the sources before it,
+// and the keys that aren't valid environment variable names are skipped.
+func (p *StackpathProvider) getWorkloadContainerEnvFromSources(pod *v1.Pod, k8sEnvFrom []v1.EnvFromSource) (workload_models.V1EnvironmentVariableMapEntry, error) {
+	envToReturn := workload_models.V1EnvironmentVariableMapEntry{}
+	for _, source := range k8sEnvFrom {
+		switch {
+		case source.ConfigMapRef != nil:
+			optional := source.ConfigMapRef.Optional != nil && *source.ConfigMapRef.Optional
+			configMap, err := p.configMapLister.ConfigMaps(pod.Namespace).Get(source.ConfigMapRef.Name)
+			if err != nil {
+				if !isNotFound(err) {
+					return nil, err
+				}
+				if optional {
+					continue
+				}
+				return nil, fmt.Errorf("configmap %q not found", source.ConfigMapRef.Name)
+			}
+			for key, value := range configMap.Data {
+				p.setEnvVarFromSource(envToReturn, source.Prefix+key, workload_models.V1EnvironmentVariable{Value: value})
+			}
+		case source.SecretRef != nil:
+			optional := source.SecretRef.Optional != nil && *source.SecretRef.Optional
+			secret, err := p.secretLister.Secrets(pod.Namespace).Get(source.SecretRef.Name)
+			if err != nil {
+				if !isNotFound(err) {
+					return nil, err
+				}
+				if optional {
+					continue
+				}
+				return nil, fmt.Errorf("secret %q not found", source.SecretRef.Name)
+			}
+			for key, value := range secret.Data {
+				// secrets are set as secret values, so StackPath doesn't expose them
+				p.setEnvVarFromSource(envToReturn, source.Prefix+key, workload_models.V1EnvironmentVariable{SecretValue: string(value)})
+			}
+		}
+	}
+	return envToReturn, nil
+}
+
+func (p *StackpathProvider) setEnvVarFromSource(env workload_models.V1EnvironmentVariableMapEntry, name string, envVar workload_models.V1EnvironmentVariable) {
+	if errs := validation.IsEnvVarName(name); len(errs) != 0 {
+		p.logger.Warnf("skipping the key %s of an envFrom source, it isn't a valid environment variable name", name)
+		return
+	}
+	env[name] = envVar
+}
+
+// getEnvVarFromSource resolves the value of an environment variable of the container set from a source.
+// It returns false when the variable must not be set, which is the case when an optional
+// ConfigMap, Secret, or key is missing, the same as the kubelet does.
+func (p *StackpathProvider) getEnvVarFromSource(pod *v1.Pod, k8sContainer *v1.Container, name string, source *v1.EnvVarSource) (*workload_models.V1EnvironmentVariable, bool, error) {
+	switch {
+	case source.FieldRef != nil:
+		value, err := p.getPodFieldValue(pod, source.FieldRef.FieldPath)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to resolve the env var %s: %w", name, err)
+		}
+		return &workload_models.V1EnvironmentVariable{Value: value}, true, nil
+	case source.ResourceFieldRef != nil:
+		value, err := p.getContainerResourceValue(pod, k8sContainer, source.ResourceFieldRef)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to resolve the env var %s: %w", name, err)
+		}
+		return &workload_models.V1EnvironmentVariable{Value: value}, true, nil
+	case source.ConfigMapKeyRef != nil:
+		value, found, err := p.getConfigMapKeyValue(pod.Namespace, source.ConfigMapKeyRef)
+		if err != nil || !found {
+			return nil, found, err
+		}
+		return &workload_models.V1EnvironmentVariable{Value: value}, true, nil
+	case source.SecretKeyRef != nil:
+		value, found, err := p.getSecretKeyValue(pod.Namespace, source.SecretKeyRef)
+		if err != nil || !found {
+			return nil, found, err
+		}
+		// secrets are set as secret values, so StackPath doesn't expose them
+		return &workload_models.V1EnvironmentVariable{SecretValue: value}, true, nil
+	}
+
+	p.logger.Warnf("the source of the env var %s is not supported, skipping", name)
+	return nil, false, nil
+}
+
+// getConfigMapKeyValue returns the value of the key of the ConfigMap the selector references
+func (p *StackpathProvider) getConfigMapKeyValue(namespace string, selector *v1.ConfigMapKeySelector) (string, bool, error) {
+	optional := selector.Optional != nil && *selector.Optional
+
+	configMap, err := p.configMapLister.ConfigMaps(namespace).Get(selector.Name)
+	if err != nil {
+		if isNotFound(err) {
+			if optional {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("configmap %q not found", selector.Name)
+		}
+		return "", false, err
+	}
+
+	value, ok := configMap.Data[selector.Key]
+	if !ok {
+		if optional {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("couldn't find key %s in ConfigMap %s/%s", selector.Key, namespace, selector.Name)
+	}
+	return value, true, nil
+}
+
+// getSecretKeyValue returns the value of the key of the Secret the selector references
+func (p *StackpathProvider) getSecretKeyValue(namespace string, selector *v1.SecretKeySelector) (string, bool, error) {
+	optional := selector.Optional != nil && *selector.Optional
+
+	secret, err := p.secretLister.Secrets(namespace).Get(selector.Name)
+	if err != nil {
+		if isNotFound(err) {
+			if optional {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("secret %q not found", selector.Name)
+		}
+		return "", false, err
+	}
+
+	value, ok := secret.Data[selector.Key]
+	if !ok {
+		if optional {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("couldn't find key %s in Secret %s/%s", selector.Key, namespace, selector.Name)
+	}
+	return string(value), true, nil
+}
+
+// isNotFound returns whether the error reports a missing object, as returned by either the listers or the provider
+func isNotFound(err error) bool {
+	return k8serrors.IsNotFound(err) || errdefs.IsNotFound(err)
+}
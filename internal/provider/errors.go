@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -48,6 +49,34 @@ func (e *InvalidClientSecretError) Error() string {
 	return "invalid StackPath client secret"
 }
 
+// NotImplementedError models a request for a feature the provider doesn't
+// support. The virtual-kubelet errdefs package doesn't define such an error,
+// so it's defined here following the same conventions.
+type NotImplementedError struct {
+	message string
+}
+
+// NewNotImplementedError creates a not implemented error with a formatted message.
+func NewNotImplementedError(format string, args ...interface{}) *NotImplementedError {
+	return &NotImplementedError{message: fmt.Sprintf(format, args...)}
+}
+
+// Error returns the not implemented error message.
+func (e *NotImplementedError) Error() string {
+	return e.message
+}
+
+// NotImplemented returns whether the error denotes an unsupported feature.
+func (e *NotImplementedError) NotImplemented() bool {
+	return true
+}
+
+// IsNotImplemented returns whether the error, or any error it wraps, denotes an unsupported feature.
+func IsNotImplemented(err error) bool {
+	var notImplemented interface{ NotImplemented() bool }
+	return errors.As(err, &notImplemented) && notImplemented.NotImplemented()
+}
+
 // APIError models an error received from the StackPath API.
 type APIError struct {
 	statusCode      int
@@ -88,6 +117,12 @@ func (e *APIError) NotFound() bool {
 	return e.statusCode == http.StatusNotFound
 }
 
+// Conflict returns whether the request was rejected because the resource
+// was modified since it was read.
+func (e *APIError) Conflict() bool {
+	return e.statusCode == http.StatusConflict
+}
+
 func (e *APIError) Cause() error {
 	return e
 }
@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecBackend runs commands in the containers of StackPath workload instances
+type ExecBackend interface {
+	// RunInContainer executes a command in a container of the instance, copying data
+	// between in/out/err and the container's stdin/stdout/stderr.
+	RunInContainer(ctx context.Context, instance *workload_models.Workloadv1Instance, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error
+}
+
+// newExecBackend creates the exec backend selected in the provider's configuration
+func newExecBackend(apiConfig *config.Config) (ExecBackend, error) {
+	switch apiConfig.ExecBackend {
+	case "", config.ExecBackendNone:
+		return &unsupportedExecBackend{}, nil
+	case config.ExecBackendAgent:
+		backend := &agentExecBackend{
+			port:       apiConfig.ExecAgentPort,
+			token:      apiConfig.ExecAgentToken,
+			useTLS:     !apiConfig.ExecAgentDisableTLS,
+			serverName: apiConfig.ExecAgentServerName,
+		}
+		if apiConfig.ExecAgentCAFile != "" {
+			caData, err := os.ReadFile(apiConfig.ExecAgentCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the exec agent CA file: %w", err)
+			}
+			backend.caData = caData
+		}
+		return backend, nil
+	}
+	return nil, fmt.Errorf("exec backend %q is not supported", apiConfig.ExecBackend)
+}
+
+func (p *StackpathProvider) runInContainer(ctx context.Context, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error {
+	instance, err := p.getPodInstance(ctx, namespace, podName)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return errdefs.NotFoundf("pod %s/%s is not found", namespace, podName)
+		}
+		return err
+	}
+
+	if _, ok := instance.Containers[containerName]; !ok {
+		return errdefs.NotFoundf("container %s is not found in pod %s/%s", containerName, namespace, podName)
+	}
+
+	return p.execBackend.RunInContainer(ctx, instance, namespace, podName, containerName, cmd, attach)
+}
+
+// unsupportedExecBackend rejects all the commands, it's used when no exec backend is configured
+type unsupportedExecBackend struct{}
+
+// RunInContainer implements the ExecBackend interface.
+func (b *unsupportedExecBackend) RunInContainer(ctx context.Context, instance *workload_models.Workloadv1Instance, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error {
+	return NewNotImplementedError("running commands in containers is not enabled, set the provider's exec backend to %q to enable it", config.ExecBackendAgent)
+}
+
+// agentExecBackend runs commands through a helper agent running in the workload instance.
+// The agent serves the same exec API as the kubelet, on the instance's IP address:
+//
+//	/exec/<namespace>/<pod>/<container>?command=<cmd>&input=1&output=1&error=1&tty=1
+type agentExecBackend struct {
+	port   int
+	token  string
+	useTLS bool
+	// the certificates of the CAs the certificate of the agent is verified with, the system ones when empty
+	caData []byte
+	// the name the certificate of the agent is verified for, the IP address of the instance when empty
+	serverName string
+}
+
+// RunInContainer implements the ExecBackend interface.
+func (b *agentExecBackend) RunInContainer(ctx context.Context, instance *workload_models.Workloadv1Instance, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error {
+	executor, err := b.newExecutor(instance, namespace, podName, containerName, cmd, attach)
+	if err != nil {
+		return err
+	}
+
+	options := remotecommand.StreamOptions{
+		Stdin:  attach.Stdin(),
+		Stdout: attach.Stdout(),
+		Tty:    attach.TTY(),
+	}
+	if attach.TTY() {
+		// The output of a terminal is multiplexed into stdout
+		options.TerminalSizeQueue = &terminalSizeQueue{ctx: ctx, resize: attach.Resize()}
+	} else {
+		options.Stderr = attach.Stderr()
+	}
+
+	// The stream is closed when the context is done, and the exit code of the command is reported as is,
+	// so it reaches the client
+	return executor.StreamWithContext(ctx, options)
+}
+
+// newExecutor creates a client of the agent's exec API for the command.
+func (b *agentExecBackend) newExecutor(instance *workload_models.Workloadv1Instance, namespace, podName, containerName string, cmd []string, attach api.AttachIO) (remotecommand.Executor, error) {
+	host := instance.ExternalIPAddress
+	if host == "" {
+		host = instance.IPAddress
+	}
+	if host == "" {
+		return nil, fmt.Errorf("instance %s doesn't have an IP address yet", instance.Name)
+	}
+
+	scheme := "http"
+	if b.useTLS {
+		scheme = "https"
+	}
+
+	query := url.Values{}
+	for _, arg := range cmd {
+		query.Add("command", arg)
+	}
+	setStreamParam := func(name string, enabled bool) {
+		if enabled {
+			query.Set(name, "1")
+		}
+	}
+	setStreamParam("input", attach.Stdin() != nil)
+	setStreamParam("output", attach.Stdout() != nil)
+	setStreamParam("error", attach.Stderr() != nil && !attach.TTY())
+	setStreamParam("tty", attach.TTY())
+
+	execURL := &url.URL{
+		Scheme:   scheme,
+		Host:     net.JoinHostPort(host, strconv.Itoa(b.port)),
+		Path:     fmt.Sprintf("/exec/%s/%s/%s", namespace, podName, containerName),
+		RawQuery: query.Encode(),
+	}
+
+	restConfig := &restclient.Config{
+		Host:        execURL.Host,
+		BearerToken: b.token,
+		TLSClientConfig: restclient.TLSClientConfig{
+			CAData:     b.caData,
+			ServerName: b.serverName,
+		},
+	}
+
+	return remotecommand.NewSPDYExecutor(restConfig, http.MethodPost, execURL)
+}
+
+// terminalSizeQueue feeds the terminal resize events of the client to the exec stream
+type terminalSizeQueue struct {
+	ctx    context.Context
+	resize <-chan api.TermSize
+}
+
+// Next implements the remotecommand.TerminalSizeQueue interface. It returns nil
+// once there are no more resize events, which stops monitoring the terminal size.
+func (q *terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	select {
+	case <-q.ctx.Done():
+		return nil
+	case size, ok := <-q.resize:
+		if !ok {
+			return nil
+		}
+		return &remotecommand.TerminalSize{Width: size.Width, Height: size.Height}
+	}
+}
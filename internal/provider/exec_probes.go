@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The prefixes of the annotations describing the HTTP or TCP probe replacing the exec
+	// probe of a container, when the exec probe strategy is "annotation". The name of the
+	// annotation is the name of the container, e.g.
+	//
+	//	liveness-probe.vk.stackpath.com/nginx: '{"httpGet": {"path": "/healthz", "port": 8080}}'
+	livenessProbeAnnotationPrefix  = "liveness-probe.vk.stackpath.com/"
+	readinessProbeAnnotationPrefix = "readiness-probe.vk.stackpath.com/"
+
+	// The name of the sidecar container running the exec probes when the exec probe strategy is "shim"
+	execProbeShimContainerName = "exec-probe-shim"
+
+	// The environment variables the exec probe shim is configured with
+	execProbeShimPortEnvVar   = "PROBE_SHIM_PORT"
+	execProbeShimProbesEnvVar = "PROBE_SHIM_PROBES"
+
+	// The reasons of the events recorded when translating exec probes
+	execProbeIgnoredReason   = "ExecProbeIgnored"
+	execProbeRejectedReason  = "ExecProbeRejected"
+	execProbeRewrittenReason = "ExecProbeRewritten"
+	execProbeShimmedReason   = "ExecProbeShimmed"
+)
+
+// execProbeShimProbe is the description of an exec probe passed on to the exec probe shim,
+// which serves the result of running the probe's command on /probes/<name>
+type execProbeShimProbe struct {
+	Name           string   `json:"name"`
+	Container      string   `json:"container"`
+	Command        []string `json:"command"`
+	TimeoutSeconds int32    `json:"timeoutSeconds,omitempty"`
+}
+
+func isExecProbe(probe *v1.Probe) bool {
+	return probe.Exec != nil
+}
+
+// translateExecProbes applies the configured exec probe strategy to the translated containers of the pod,
+// since StackPath only supports HTTP and TCP probes. The rejected probes are recorded as events of the pod,
+// the other decisions are recorded by recordExecProbes once the workload is created.
+func (p *StackpathProvider) translateExecProbes(pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry) error {
+	probes := getContainerProbesFrom(pod, isExecProbe)
+	if len(probes) == 0 {
+		return nil
+	}
+
+	switch p.apiConfig.ExecProbeStrategy {
+	case config.ExecProbeStrategyReject:
+		err := fmt.Errorf("exec probes are not supported, found the %s probe of the container %s", probes[0].probeType, probes[0].container)
+		p.logger.Infof("probe of type Exec is not supported, rejecting the pod %s/%s", pod.Namespace, pod.Name)
+		p.eventRecorder.Event(pod, v1.EventTypeWarning, execProbeRejectedReason, err.Error())
+		return err
+	case config.ExecProbeStrategyAnnotation:
+		return p.rewriteExecProbesFromAnnotations(pod, containers, probes)
+	case config.ExecProbeStrategyShim:
+		return p.addExecProbeShim(pod, containers, probes)
+	}
+
+	for _, probe := range probes {
+		p.logger.Infof("probe of type Exec is not supported, skipping the %s probe of the container %s", probe.probeType, probe.container)
+	}
+	return nil
+}
+
+// recordExecProbes records an event for each exec probe of the pod, telling how the exec probe strategy handled it.
+// It's called once the workload is created, so updating the workload doesn't record them again.
+func (p *StackpathProvider) recordExecProbes(pod *v1.Pod) {
+	for _, probe := range getContainerProbesFrom(pod, isExecProbe) {
+		switch p.apiConfig.ExecProbeStrategy {
+		case config.ExecProbeStrategyReject:
+			// the pods with exec probes fail to be created
+		case config.ExecProbeStrategyAnnotation:
+			p.eventRecorder.Eventf(pod, v1.EventTypeNormal, execProbeRewrittenReason, "the exec %s probe of the container %s is replaced with the probe of the %s annotation", probe.probeType, probe.container, getExecProbeAnnotation(probe))
+		case config.ExecProbeStrategyShim:
+			p.eventRecorder.Eventf(pod, v1.EventTypeNormal, execProbeShimmedReason, "the exec %s probe of the container %s is run by the exec probe shim", probe.probeType, probe.container)
+		default:
+			p.eventRecorder.Eventf(pod, v1.EventTypeWarning, execProbeIgnoredReason, "exec probes are not supported, the %s probe of the container %s is ignored", probe.probeType, probe.container)
+		}
+	}
+}
+
+// getExecProbeAnnotation returns the annotation describing the probe replacing the exec probe
+func getExecProbeAnnotation(probe containerProbe) string {
+	if probe.probeType == "readiness" {
+		return readinessProbeAnnotationPrefix + probe.container
+	}
+	return livenessProbeAnnotationPrefix + probe.container
+}
+
+// rewriteExecProbesFromAnnotations replaces the exec probes with the HTTP or TCP probes described in the pod's annotations
+func (p *StackpathProvider) rewriteExecProbesFromAnnotations(pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry, probes []containerProbe) error {
+	for _, probe := range probes {
+		annotation := getExecProbeAnnotation(probe)
+
+		value, ok := pod.Annotations[annotation]
+		if !ok {
+			err := fmt.Errorf("exec probes are not supported, the %s probe of the container %s must be described in the %s annotation", probe.probeType, probe.container, annotation)
+			p.eventRecorder.Event(pod, v1.EventTypeWarning, execProbeRejectedReason, err.Error())
+			return err
+		}
+
+		handler := v1.ProbeHandler{}
+		if err := json.Unmarshal([]byte(value), &handler); err != nil {
+			return fmt.Errorf("failed to parse the %s annotation: %w", annotation, err)
+		}
+		if handler.HTTPGet == nil && handler.TCPSocket == nil {
+			return fmt.Errorf("the %s annotation must describe either an httpGet or a tcpSocket probe", annotation)
+		}
+
+		// The replacement probe keeps the timings of the exec probe
+		k8sProbe := probe.probe.DeepCopy()
+		k8sProbe.ProbeHandler = handler
+
+		workloadProbe, err := p.getWorkloadContainerProbeFrom(k8sProbe, probe.ports)
+		if err != nil {
+			return err
+		}
+
+		setContainerProbe(containers, probe, workloadProbe)
+	}
+	return nil
+}
+
+// addExecProbeShim adds the exec probe shim sidecar to the containers, and replaces the exec probes
+// with HTTP probes against the shim, which runs the probes' commands and reports their results
+func (p *StackpathProvider) addExecProbeShim(pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry, probes []containerProbe) error {
+	shimPort := p.apiConfig.ExecProbeShimPort
+
+	shimProbes := make([]execProbeShimProbe, 0, len(probes))
+	for _, probe := range probes {
+		shimProbes = append(shimProbes, execProbeShimProbe{
+			Name:           probe.name(),
+			Container:      probe.container,
+			Command:        probe.probe.Exec.Command,
+			TimeoutSeconds: probe.probe.TimeoutSeconds,
+		})
+	}
+
+	shimProbesValue, err := json.Marshal(shimProbes)
+	if err != nil {
+		return err
+	}
+
+	err = p.addProbeSidecar(pod, containers, execProbeShimContainerName, p.apiConfig.ExecProbeShimImage, shimPort, workload_models.V1EnvironmentVariableMapEntry{
+		execProbeShimPortEnvVar:   {Value: fmt.Sprint(shimPort)},
+		execProbeShimProbesEnvVar: {Value: string(shimProbesValue)},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, probe := range probes {
+		setContainerProbe(containers, probe, getSidecarProbe(probe, shimPort))
+	}
+	return nil
+}
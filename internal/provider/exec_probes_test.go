@@ -0,0 +1,212 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestTranslateExecProbes(t *testing.T) {
+	ctx := context.Background()
+
+	newPod := func(annotations map[string]string, ports ...v1.ContainerPort) *v1.Pod {
+		pod := &v1.Pod{}
+		pod.Name = "test-pod"
+		pod.Namespace = "test-ns"
+		pod.Annotations = annotations
+		pod.Spec.Containers = []v1.Container{
+			{
+				Name:  "app",
+				Image: "app:latest",
+				Ports: ports,
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4"), v1.ResourceMemory: resource.MustParse("16Gi")},
+				},
+				LivenessProbe: &v1.Probe{
+					ProbeHandler:     v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"cat", "/tmp/healthy"}}},
+					PeriodSeconds:    10,
+					FailureThreshold: 3,
+					TimeoutSeconds:   2,
+				},
+				ReadinessProbe: &v1.Probe{
+					ProbeHandler: v1.ProbeHandler{TCPSocket: &v1.TCPSocketAction{Port: intstr.IntOrString{Type: intstr.Int, IntVal: 8080}}},
+				},
+			},
+		}
+		return pod
+	}
+
+	testCases := []struct {
+		description        string
+		strategy           string
+		pod                *v1.Pod
+		expectedError      string
+		expectedEvents     []string
+		expectedLiveness   *workload_models.V1Probe
+		expectedContainers []string
+	}{
+		{
+			description:        "ignores exec probes",
+			strategy:           config.ExecProbeStrategyIgnore,
+			pod:                newPod(nil),
+			expectedEvents:     []string{"Warning ExecProbeIgnored exec probes are not supported, the liveness probe of the container app is ignored"},
+			expectedContainers: []string{"app"},
+		},
+		{
+			description:    "rejects exec probes",
+			strategy:       config.ExecProbeStrategyReject,
+			pod:            newPod(nil),
+			expectedError:  "exec probes are not supported, found the liveness probe of the container app",
+			expectedEvents: []string{"Warning ExecProbeRejected exec probes are not supported, found the liveness probe of the container app"},
+		},
+		{
+			description: "rewrites exec probes from annotations",
+			strategy:    config.ExecProbeStrategyAnnotation,
+			pod: newPod(
+				map[string]string{"liveness-probe.vk.stackpath.com/app": `{"httpGet": {"path": "/healthz", "port": "http"}}`},
+				v1.ContainerPort{Name: "http", ContainerPort: 8080},
+			),
+			expectedEvents: []string{"Normal ExecProbeRewritten the exec liveness probe of the container app is replaced with the probe of the liveness-probe.vk.stackpath.com/app annotation"},
+			expectedLiveness: &workload_models.V1Probe{
+				PeriodSeconds:    10,
+				FailureThreshold: 3,
+				TimeoutSeconds:   2,
+				HTTPGet: &workload_models.V1HTTPGetAction{
+					Path:        "/healthz",
+					Port:        8080,
+					HTTPHeaders: workload_models.V1StringMapEntry{},
+				},
+			},
+			expectedContainers: []string{"app"},
+		},
+		{
+			description:    "fails when the annotation describing the probe is missing",
+			strategy:       config.ExecProbeStrategyAnnotation,
+			pod:            newPod(nil),
+			expectedError:  "exec probes are not supported, the liveness probe of the container app must be described in the liveness-probe.vk.stackpath.com/app annotation",
+			expectedEvents: []string{"Warning ExecProbeRejected exec probes are not supported, the liveness probe of the container app must be described in the liveness-probe.vk.stackpath.com/app annotation"},
+		},
+		{
+			description:   "fails when the annotation describing the probe is invalid",
+			strategy:      config.ExecProbeStrategyAnnotation,
+			pod:           newPod(map[string]string{"liveness-probe.vk.stackpath.com/app": `{"exec": {"command": ["true"]}}`}),
+			expectedError: "the liveness-probe.vk.stackpath.com/app annotation must describe either an httpGet or a tcpSocket probe",
+		},
+		{
+			description:    "runs exec probes in the shim",
+			strategy:       config.ExecProbeStrategyShim,
+			pod:            newPod(nil),
+			expectedEvents: []string{"Normal ExecProbeShimmed the exec liveness probe of the container app is run by the exec probe shim"},
+			expectedLiveness: &workload_models.V1Probe{
+				PeriodSeconds:    10,
+				FailureThreshold: 3,
+				TimeoutSeconds:   2,
+				HTTPGet: &workload_models.V1HTTPGetAction{
+					Path:   "/probes/app-liveness",
+					Port:   8081,
+					Scheme: "HTTP",
+				},
+			},
+			expectedContainers: []string{"app", execProbeShimContainerName},
+		},
+		{
+			description:   "fails when a container uses the port of the shim",
+			strategy:      config.ExecProbeStrategyShim,
+			pod:           newPod(nil, v1.ContainerPort{Name: "http", ContainerPort: 8081}),
+			expectedError: "the port 8081 of the container app conflicts with the port of the exec-probe-shim sidecar",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatal("failed to create the test provider", err)
+			}
+			provider.apiConfig.ExecProbeStrategy = c.strategy
+			provider.apiConfig.ExecProbeShimImage = "stackpath/exec-probe-shim:latest"
+
+			spec, err := provider.getWorkloadSpecFrom(ctx, c.pod)
+
+			recorder := provider.eventRecorder.(*record.FakeRecorder)
+			if err == nil {
+				// the decisions are recorded once the workload is created rather than each time the pod is translated
+				assert.Len(t, recorder.Events, 0)
+				provider.recordExecProbes(c.pod)
+			}
+			events := []string{}
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if c.expectedEvents != nil {
+				assert.Equal(t, c.expectedEvents, events)
+			}
+
+			if c.expectedError != "" {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			containers := []string{}
+			for name := range spec.Containers {
+				containers = append(containers, name)
+			}
+			assert.ElementsMatch(t, c.expectedContainers, containers)
+
+			app := spec.Containers["app"]
+			assert.Equal(t, c.expectedLiveness, app.LivenessProbe)
+			// the probes that aren't exec probes are left as is
+			assert.Equal(t, &workload_models.V1Probe{TCPSocket: &workload_models.V1TCPSocketAction{Port: 8080}}, app.ReadinessProbe)
+
+			if shim, ok := spec.Containers[execProbeShimContainerName]; ok {
+				assert.Equal(t, "stackpath/exec-probe-shim:latest", shim.Image)
+				assert.Equal(t, "8081", shim.Env[execProbeShimPortEnvVar].Value)
+				assert.JSONEq(t, `[{"name": "app-liveness", "container": "app", "command": ["cat", "/tmp/healthy"], "timeoutSeconds": 2}]`, shim.Env[execProbeShimProbesEnvVar].Value)
+				// the shim is allocated with the smallest instance size rather than the size of the containers
+				assert.Equal(t, workload_models.V1StringMapEntry{"cpu": "1", "memory": "2Gi"}, shim.Resources.Limits)
+				assert.Equal(t, workload_models.V1StringMapEntry{"cpu": "4", "memory": "16Gi"}, app.Resources.Limits)
+			}
+		})
+	}
+}
+
+func TestRecordExecProbesOnCreate(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	provider, err := createTestProvider(ctx, nil, nil, nil, &workload_client.EdgeCompute{Workloads: wsc})
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.apiConfig.ExecProbeStrategy = config.ExecProbeStrategyIgnore
+
+	pod := createTestPod("test-pod", "test-ns")
+	pod.Spec.Containers[0].LivenessProbe = &v1.Probe{ProbeHandler: v1.ProbeHandler{Exec: &v1.ExecAction{Command: []string{"true"}}}}
+	live, err := provider.getWorkloadFrom(ctx, pod)
+	assert.NoError(t, err)
+	live.Status = workload_models.V1WorkloadStatusACTIVE.Pointer()
+
+	wsc.EXPECT().CreateWorkload(gomock.Any(), nil).Return(nil, nil).Times(1)
+	wsc.EXPECT().GetWorkload(gomock.Any(), nil).Return(&workloads.GetWorkloadOK{Payload: &workload_models.V1GetWorkloadResponse{Workload: live}}, nil).Times(1)
+
+	// the event is recorded once the workload is created, and not again when it's updated
+	events := provider.eventRecorder.(*record.FakeRecorder).Events
+	assert.NoError(t, provider.CreatePod(ctx, pod))
+	assert.NoError(t, provider.UpdatePod(ctx, pod))
+	assert.Len(t, events, 1)
+	assert.Equal(t, "Warning ExecProbeIgnored exec probes are not supported, the liveness probe of the container nginx is ignored", <-events)
+}
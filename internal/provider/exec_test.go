@@ -0,0 +1,299 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	v1 "k8s.io/api/core/v1"
+)
+
+// testAttachIO implements api.AttachIO on top of in-memory streams
+type testAttachIO struct {
+	stdin  io.Reader
+	stdout io.WriteCloser
+	stderr io.WriteCloser
+	tty    bool
+	resize chan api.TermSize
+}
+
+func (a *testAttachIO) Stdin() io.Reader            { return a.stdin }
+func (a *testAttachIO) Stdout() io.WriteCloser      { return a.stdout }
+func (a *testAttachIO) Stderr() io.WriteCloser      { return a.stderr }
+func (a *testAttachIO) TTY() bool                   { return a.tty }
+func (a *testAttachIO) Resize() <-chan api.TermSize { return a.resize }
+func (a *testAttachIO) closeResize()                { close(a.resize) }
+
+func newTestAttachIO(stdin string, tty bool) *testAttachIO {
+	a := &testAttachIO{
+		stdout: &syncBuffer{},
+		tty:    tty,
+		resize: make(chan api.TermSize, 1),
+	}
+	if stdin != "" {
+		a.stdin = strings.NewReader(stdin)
+	}
+	if !tty {
+		a.stderr = &syncBuffer{}
+	}
+	return a
+}
+
+// syncBuffer is a bytes.Buffer that can be written to and read from concurrently
+type syncBuffer struct {
+	sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) Close() error { return nil }
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buffer.String()
+}
+
+func TestRunInContainer(t *testing.T) {
+	podName := "test-pod"
+	podNamespace := "test-ns"
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	ctx := context.Background()
+
+	isc := mocks.NewInstanceClientService(mockController)
+	stackPathClientMock := workload_client.EdgeCompute{Instance: isc}
+
+	provider, err := createTestProvider(ctx, mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), createTestPodLister(mockController, createTestPod(podName, podNamespace)), &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	params := instance.GetWorkloadInstanceParams{
+		Context:      ctx,
+		StackID:      provider.apiConfig.StackID,
+		WorkloadID:   provider.getWorkloadSlug(podNamespace, podName),
+		InstanceName: provider.getInstanceName(podNamespace, podName),
+	}
+	instanceResponse := &instance.GetWorkloadInstanceOK{
+		Payload: &workload_models.V1GetWorkloadInstanceResponse{
+			Instance: createTestInstance("nginx", workload_models.Workloadv1InstanceInstancePhaseRUNNING.Pointer(), createContainerState("nginx", v1.ContainerState{Running: &v1.ContainerStateRunning{}})),
+		},
+	}
+
+	testCases := []struct {
+		description     string
+		containerName   string
+		initMockedCalls func()
+		expectedError   func(error) bool
+	}{
+		{
+			description:   "rejects commands when no exec backend is configured",
+			containerName: "nginx",
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(&params, nil).Return(instanceResponse, nil).Times(1)
+			},
+			expectedError: IsNotImplemented,
+		},
+		{
+			description:   "fails for a container that doesn't exist",
+			containerName: "another-container",
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(&params, nil).Return(instanceResponse, nil).Times(1)
+			},
+			expectedError: errdefs.IsNotFound,
+		},
+		{
+			description:   "fails for a pod that doesn't exist",
+			containerName: "nginx",
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(&params, nil).Return(nil, &APIError{statusCode: http.StatusNotFound, message: "not found"}).Times(1)
+			},
+			expectedError: errdefs.IsNotFound,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			c.initMockedCalls()
+			err := provider.RunInContainer(ctx, podNamespace, podName, c.containerName, []string{"ls"}, newTestAttachIO("", false))
+			assert.Error(t, err)
+			assert.True(t, c.expectedError(err), "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestNewExecBackend(t *testing.T) {
+	backend, err := newExecBackend(&config.Config{ExecBackend: config.ExecBackendNone})
+	assert.NoError(t, err)
+	assert.IsType(t, &unsupportedExecBackend{}, backend)
+
+	backend, err = newExecBackend(&config.Config{ExecBackend: config.ExecBackendAgent, ExecAgentPort: 8022, ExecAgentToken: "token"})
+	assert.NoError(t, err)
+	assert.Equal(t, &agentExecBackend{port: 8022, token: "token", useTLS: true}, backend)
+
+	backend, err = newExecBackend(&config.Config{ExecBackend: config.ExecBackendAgent, ExecAgentPort: 8022, ExecAgentDisableTLS: true})
+	assert.NoError(t, err)
+	assert.Equal(t, &agentExecBackend{port: 8022}, backend)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("certificates"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backend, err = newExecBackend(&config.Config{ExecBackend: config.ExecBackendAgent, ExecAgentPort: 8022, ExecAgentCAFile: caFile, ExecAgentServerName: "agent.local"})
+	assert.NoError(t, err)
+	assert.Equal(t, &agentExecBackend{port: 8022, useTLS: true, caData: []byte("certificates"), serverName: "agent.local"}, backend)
+
+	_, err = newExecBackend(&config.Config{ExecBackend: config.ExecBackendAgent, ExecAgentCAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.ErrorContains(t, err, "failed to read the exec agent CA file")
+
+	_, err = newExecBackend(&config.Config{ExecBackend: "ssh"})
+	assert.EqualError(t, err, "exec backend \"ssh\" is not supported")
+}
+
+func TestAgentExecBackend(t *testing.T) {
+	type execRequest struct {
+		namespace, pod, container string
+		cmd                       []string
+	}
+	requests := make(chan execRequest, 1)
+
+	// The agent serves the kubelet exec API, which is what the virtual kubelet serves as well
+	agent := api.PodHandler(api.PodHandlerConfig{
+		RunInContainer: func(ctx context.Context, namespace, pod, container string, cmd []string, attach api.AttachIO) error {
+			requests <- execRequest{namespace: namespace, pod: pod, container: container, cmd: cmd}
+
+			switch cmd[0] {
+			case "cat":
+				_, err := io.Copy(attach.Stdout(), attach.Stdin())
+				return err
+			case "fail":
+				fmt.Fprint(attach.Stderr(), "something went wrong")
+				return errors.New("command failed")
+			case "wait":
+				<-ctx.Done()
+				return nil
+			case "resize":
+				size := <-attach.Resize()
+				fmt.Fprintf(attach.Stdout(), "%dx%d", size.Width, size.Height)
+				return nil
+			}
+			return nil
+		},
+	}, false)
+	authorizations := make(chan string, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case authorizations <- r.Header.Get("Authorization"):
+		default:
+		}
+		agent.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentPort, _ := strconv.Atoi(port)
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	backend := &agentExecBackend{port: agentPort, token: "secret-token", useTLS: true, caData: caData}
+	instance := &workload_models.Workloadv1Instance{Name: "test-instance", IPAddress: host}
+
+	t.Run("streams stdin to stdout", func(t *testing.T) {
+		attach := newTestAttachIO("hello from stdin", false)
+		err := backend.RunInContainer(context.Background(), instance, "test-ns", "test-pod", "nginx", []string{"cat"}, attach)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello from stdin", attach.stdout.(*syncBuffer).String())
+
+		request := <-requests
+		assert.Equal(t, "test-ns", request.namespace)
+		assert.Equal(t, "test-pod", request.pod)
+		assert.Equal(t, "nginx", request.container)
+		assert.Equal(t, []string{"cat"}, request.cmd)
+		assert.Equal(t, "Bearer secret-token", <-authorizations)
+	})
+
+	t.Run("streams stderr and reports failures", func(t *testing.T) {
+		attach := newTestAttachIO("", false)
+		err := backend.RunInContainer(context.Background(), instance, "test-ns", "test-pod", "nginx", []string{"fail"}, attach)
+		assert.Error(t, err)
+		assert.Equal(t, "something went wrong", attach.stderr.(*syncBuffer).String())
+		<-requests
+	})
+
+	t.Run("forwards terminal resizes", func(t *testing.T) {
+		attach := newTestAttachIO("", true)
+		attach.resize <- api.TermSize{Width: 120, Height: 40}
+		defer attach.closeResize()
+		err := backend.RunInContainer(context.Background(), instance, "test-ns", "test-pod", "nginx", []string{"resize"}, attach)
+		assert.NoError(t, err)
+		assert.Equal(t, "120x40", attach.stdout.(*syncBuffer).String())
+		<-requests
+	})
+
+	t.Run("stops the stream when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- backend.RunInContainer(ctx, instance, "test-ns", "test-pod", "nginx", []string{"wait"}, newTestAttachIO("", false))
+		}()
+		<-requests
+		cancel()
+
+		select {
+		case err := <-done:
+			assert.Error(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the stream wasn't stopped")
+		}
+	})
+
+	t.Run("refuses an agent whose certificate isn't signed by the CA", func(t *testing.T) {
+		select {
+		case <-authorizations:
+		default:
+		}
+
+		untrusted := &agentExecBackend{port: agentPort, token: "secret-token", useTLS: true}
+		err := untrusted.RunInContainer(context.Background(), instance, "test-ns", "test-pod", "nginx", []string{"ls"}, newTestAttachIO("", false))
+		assert.ErrorContains(t, err, "certificate")
+		select {
+		case authorization := <-authorizations:
+			t.Fatalf("the token was sent to an untrusted agent: %s", authorization)
+		default:
+		}
+	})
+
+	t.Run("fails when the instance has no IP address", func(t *testing.T) {
+		err := backend.RunInContainer(context.Background(), &workload_models.Workloadv1Instance{Name: "test-instance"}, "test-ns", "test-pod", "nginx", []string{"ls"}, newTestAttachIO("", false))
+		assert.EqualError(t, err, "instance test-instance doesn't have an IP address yet")
+	})
+}
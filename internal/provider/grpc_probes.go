@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The name of the sidecar container running the gRPC probes when the gRPC probe strategy is "gateway"
+	grpcHealthGatewayContainerName = "grpc-health-gateway"
+
+	// The environment variables the gRPC health gateway is configured with
+	grpcHealthGatewayPortEnvVar   = "HEALTH_GATEWAY_PORT"
+	grpcHealthGatewayProbesEnvVar = "HEALTH_GATEWAY_PROBES"
+
+	// The condition reporting that the gRPC probes of a pod are weaker than requested
+	grpcProbeDegradedCondition v1.PodConditionType = "GRPCProbeDegraded"
+)
+
+// grpcHealthGatewayProbe is the description of a gRPC probe passed on to the gRPC health gateway, which
+// serves the result of calling the grpc.health.v1 health service on the port on /probes/<name>
+type grpcHealthGatewayProbe struct {
+	Name    string `json:"name"`
+	Port    int32  `json:"port"`
+	Service string `json:"service,omitempty"`
+}
+
+func isGRPCProbe(probe *v1.Probe) bool {
+	return probe.GRPC != nil
+}
+
+// translateGRPCProbes applies the configured gRPC probe strategy to the translated containers of the pod,
+// since StackPath only supports HTTP and TCP probes.
+func (p *StackpathProvider) translateGRPCProbes(pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry) error {
+	probes := getContainerProbesFrom(pod, isGRPCProbe)
+	if len(probes) == 0 {
+		return nil
+	}
+
+	if p.apiConfig.GRPCProbeStrategy == config.GRPCProbeStrategyGateway {
+		return p.addGRPCHealthGateway(pod, containers, probes)
+	}
+
+	for _, probe := range probes {
+		setContainerProbe(containers, probe, &workload_models.V1Probe{
+			FailureThreshold:    probe.probe.FailureThreshold,
+			InitialDelaySeconds: probe.probe.InitialDelaySeconds,
+			PeriodSeconds:       probe.probe.PeriodSeconds,
+			SuccessThreshold:    probe.probe.SuccessThreshold,
+			TimeoutSeconds:      probe.probe.TimeoutSeconds,
+			TCPSocket: &workload_models.V1TCPSocketAction{
+				Port: probe.probe.GRPC.Port,
+			},
+		})
+	}
+	return nil
+}
+
+// addGRPCHealthGateway adds the gRPC health gateway sidecar to the containers, and replaces the gRPC probes
+// with HTTP probes against the gateway, which calls the health service of the containers
+func (p *StackpathProvider) addGRPCHealthGateway(pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry, probes []containerProbe) error {
+	gatewayPort := p.apiConfig.GRPCProbeGatewayPort
+
+	gatewayProbes := make([]grpcHealthGatewayProbe, 0, len(probes))
+	for _, probe := range probes {
+		gatewayProbe := grpcHealthGatewayProbe{
+			Name: probe.name(),
+			Port: probe.probe.GRPC.Port,
+		}
+		if probe.probe.GRPC.Service != nil {
+			gatewayProbe.Service = *probe.probe.GRPC.Service
+		}
+		gatewayProbes = append(gatewayProbes, gatewayProbe)
+	}
+
+	gatewayProbesValue, err := json.Marshal(gatewayProbes)
+	if err != nil {
+		return err
+	}
+
+	err = p.addProbeSidecar(pod, containers, grpcHealthGatewayContainerName, p.apiConfig.GRPCProbeGatewayImage, gatewayPort, workload_models.V1EnvironmentVariableMapEntry{
+		grpcHealthGatewayPortEnvVar:   {Value: fmt.Sprint(gatewayPort)},
+		grpcHealthGatewayProbesEnvVar: {Value: string(gatewayProbesValue)},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, probe := range probes {
+		setContainerProbe(containers, probe, getSidecarProbe(probe, gatewayPort))
+	}
+	return nil
+}
+
+// setGRPCProbeStatus reports in the GRPCProbeDegraded condition of the pod how its gRPC probes
+// are run, since neither of the translations StackPath allows is equivalent to a gRPC probe.
+func setGRPCProbeStatus(pod *v1.Pod, status *v1.PodStatus, strategy string) {
+	probes := getContainerProbesFrom(pod, isGRPCProbe)
+	if len(probes) == 0 {
+		return
+	}
+
+	descriptions := make([]string, 0, len(probes))
+	for _, probe := range probes {
+		descriptions = append(descriptions, fmt.Sprintf("%s of the container %s", probe.probeType, probe.container))
+	}
+
+	condition := v1.PodCondition{
+		Type:   grpcProbeDegradedCondition,
+		Status: v1.ConditionTrue,
+		// The translation of the probes doesn't change during the life of the pod
+		LastTransitionTime: pod.CreationTimestamp,
+	}
+	if strategy == config.GRPCProbeStrategyGateway {
+		condition.Reason = "HealthGatewayProbe"
+		condition.Message = fmt.Sprintf("the gRPC probes (%s) are run through a health gateway sidecar, which fails them as well when it is unavailable", strings.Join(descriptions, ", "))
+	} else {
+		condition.Reason = "TCPSocketProbe"
+		condition.Message = fmt.Sprintf("the gRPC probes (%s) only check that the gRPC port accepts connections, the health service isn't called", strings.Join(descriptions, ", "))
+	}
+
+	status.Conditions = append(status.Conditions, condition)
+}
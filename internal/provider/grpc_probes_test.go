@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newGRPCProbePod returns a pod whose api container has gRPC liveness and readiness probes
+func newGRPCProbePod(ports ...v1.ContainerPort) *v1.Pod {
+	service := "api"
+	pod := createTestPodWithContainers(nil, v1.Container{
+		Name:  "api",
+		Image: "api:latest",
+		Ports: ports,
+		LivenessProbe: &v1.Probe{
+			ProbeHandler:     v1.ProbeHandler{GRPC: &v1.GRPCAction{Port: 9000}},
+			PeriodSeconds:    10,
+			FailureThreshold: 3,
+		},
+		ReadinessProbe: &v1.Probe{
+			ProbeHandler:  v1.ProbeHandler{GRPC: &v1.GRPCAction{Port: 9000, Service: &service}},
+			PeriodSeconds: 5,
+		},
+	})
+	pod.CreationTimestamp = metav1.NewTime(time.Unix(1683000000, 0))
+	return pod
+}
+
+func TestTranslateGRPCProbes(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		description        string
+		strategy           string
+		pod                *v1.Pod
+		expectedError      string
+		expectedLiveness   *workload_models.V1Probe
+		expectedReadiness  *workload_models.V1Probe
+		expectedContainers []string
+	}{
+		{
+			description: "replaces gRPC probes with TCP probes on the gRPC port",
+			strategy:    config.GRPCProbeStrategyTCP,
+			pod:         newGRPCProbePod(),
+			expectedLiveness: &workload_models.V1Probe{
+				PeriodSeconds:    10,
+				FailureThreshold: 3,
+				TCPSocket:        &workload_models.V1TCPSocketAction{Port: 9000},
+			},
+			expectedReadiness: &workload_models.V1Probe{
+				PeriodSeconds: 5,
+				TCPSocket:     &workload_models.V1TCPSocketAction{Port: 9000},
+			},
+			expectedContainers: []string{"api"},
+		},
+		{
+			description: "replaces gRPC probes with HTTP probes against the health gateway",
+			strategy:    config.GRPCProbeStrategyGateway,
+			pod:         newGRPCProbePod(),
+			expectedLiveness: &workload_models.V1Probe{
+				PeriodSeconds:    10,
+				FailureThreshold: 3,
+				HTTPGet:          &workload_models.V1HTTPGetAction{Path: "/probes/api-liveness", Port: 8082, Scheme: "HTTP"},
+			},
+			expectedReadiness: &workload_models.V1Probe{
+				PeriodSeconds: 5,
+				HTTPGet:       &workload_models.V1HTTPGetAction{Path: "/probes/api-readiness", Port: 8082, Scheme: "HTTP"},
+			},
+			expectedContainers: []string{"api", grpcHealthGatewayContainerName},
+		},
+		{
+			description:   "fails when a container uses the port of the health gateway",
+			strategy:      config.GRPCProbeStrategyGateway,
+			pod:           newGRPCProbePod(v1.ContainerPort{Name: "metrics", ContainerPort: 8082}),
+			expectedError: "the port 8082 of the container api conflicts with the port of the grpc-health-gateway sidecar",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatal("failed to create the test provider", err)
+			}
+			provider.apiConfig.GRPCProbeStrategy = c.strategy
+			provider.apiConfig.GRPCProbeGatewayImage = "stackpath/grpc-health-gateway:latest"
+
+			spec, err := provider.getWorkloadSpecFrom(ctx, c.pod)
+			if c.expectedError != "" {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			containers := []string{}
+			for name := range spec.Containers {
+				containers = append(containers, name)
+			}
+			assert.ElementsMatch(t, c.expectedContainers, containers)
+			assert.Equal(t, c.expectedLiveness, spec.Containers["api"].LivenessProbe)
+			assert.Equal(t, c.expectedReadiness, spec.Containers["api"].ReadinessProbe)
+
+			if gateway, ok := spec.Containers[grpcHealthGatewayContainerName]; ok {
+				assert.Equal(t, "stackpath/grpc-health-gateway:latest", gateway.Image)
+				assert.Equal(t, "8082", gateway.Env[grpcHealthGatewayPortEnvVar].Value)
+				assert.JSONEq(t, `[{"name": "api-liveness", "port": 9000}, {"name": "api-readiness", "port": 9000, "service": "api"}]`, gateway.Env[grpcHealthGatewayProbesEnvVar].Value)
+			}
+		})
+	}
+}
+
+func TestSetGRPCProbeStatus(t *testing.T) {
+	t.Run("reports TCP probes in the pod's conditions", func(t *testing.T) {
+		pod := newGRPCProbePod()
+		status := &v1.PodStatus{}
+		setGRPCProbeStatus(pod, status, config.GRPCProbeStrategyTCP)
+
+		assert.Equal(t, []v1.PodCondition{{
+			Type:               grpcProbeDegradedCondition,
+			Status:             v1.ConditionTrue,
+			LastTransitionTime: pod.CreationTimestamp,
+			Reason:             "TCPSocketProbe",
+			Message:            "the gRPC probes (liveness of the container api, readiness of the container api) only check that the gRPC port accepts connections, the health service isn't called",
+		}}, status.Conditions)
+	})
+
+	t.Run("reports health gateway probes in the pod's conditions", func(t *testing.T) {
+		status := &v1.PodStatus{}
+		setGRPCProbeStatus(newGRPCProbePod(), status, config.GRPCProbeStrategyGateway)
+
+		assert.Len(t, status.Conditions, 1)
+		assert.Equal(t, "HealthGatewayProbe", status.Conditions[0].Reason)
+	})
+
+	t.Run("leaves the conditions of pods without gRPC probes as is", func(t *testing.T) {
+		status := &v1.PodStatus{}
+		setGRPCProbeStatus(createTestPod("test-pod", "test-ns"), status, config.GRPCProbeStrategyTCP)
+
+		assert.Empty(t, status.Conditions)
+	})
+}
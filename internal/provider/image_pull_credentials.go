@@ -2,10 +2,14 @@
 package provider
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/registry"
 	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
 	v1 "k8s.io/api/core/v1"
 )
@@ -94,6 +98,14 @@ func getImagePullCredentialsFromJSONConfig(secret *v1.Secret) ([]*workload_model
 	}
 
 	for server, auth := range repoData.Auths {
+		if auth.Username == "" && auth.Password == "" && auth.Auth != "" {
+			// the credential is only set as the base64 encoded username:password pair
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode the auth of the server %s: %w", server, err)
+			}
+			auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+		}
 		imagePullSecret := workload_models.V1ImagePullCredential{
 			DockerRegistry: &workload_models.V1DockerRegistryCredentials{
 				Server:   server,
@@ -107,3 +119,40 @@ func getImagePullCredentialsFromJSONConfig(secret *v1.Secret) ([]*workload_model
 
 	return imagePullCredentials, nil
 }
+
+// getImageEntrypoint returns the entrypoint of the image, which is read from its registry
+// with the credentials of the pod's image pull secrets
+func (p *StackpathProvider) getImageEntrypoint(ctx context.Context, pod *v1.Pod, image string) ([]string, error) {
+	credentials, err := p.getRegistryCredentialsFrom(pod)
+	if err != nil {
+		return nil, err
+	}
+	return p.entrypointResolver.Entrypoint(ctx, image, credentials)
+}
+
+// getImageCommand returns the command the image runs by default, which is read from its registry
+// with the credentials of the pod's image pull secrets
+func (p *StackpathProvider) getImageCommand(ctx context.Context, pod *v1.Pod, image string) ([]string, error) {
+	credentials, err := p.getRegistryCredentialsFrom(pod)
+	if err != nil {
+		return nil, err
+	}
+	return p.entrypointResolver.Command(ctx, image, credentials)
+}
+
+func (p *StackpathProvider) getRegistryCredentialsFrom(pod *v1.Pod) ([]registry.Credential, error) {
+	imagePullCredentials, err := p.getImagePullCredentialsFrom(pod.Namespace, pod.Spec.ImagePullSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]registry.Credential, 0, len(imagePullCredentials))
+	for _, imagePullCredential := range imagePullCredentials {
+		credentials = append(credentials, registry.Credential{
+			Server:   imagePullCredential.DockerRegistry.Server,
+			Username: imagePullCredential.DockerRegistry.Username,
+			Password: imagePullCredential.DockerRegistry.Password,
+		})
+	}
+	return credentials, nil
+}
@@ -84,6 +84,40 @@ func TestImagePullCredentials(t *testing.T) {
 				return secretListerMock
 			},
 		},
+		{
+			description: "test credential set with auth only work",
+			err:         "",
+			namespace:   "test",
+			k8sImagePullSecrets: []v1.LocalObjectReference{
+				{
+					Name: "image-pull-secret",
+				},
+			},
+			expected: []*workload_models.V1ImagePullCredential{
+				{
+					DockerRegistry: &workload_models.V1DockerRegistryCredentials{
+						Username: "user",
+						Password: "pass:word",
+						Server:   "server",
+					},
+				},
+			},
+			secretMapListerMock: func() *mocks.MockSecretLister {
+				secretListerMock := mocks.NewMockSecretLister(mockController)
+				secretNamespaceListerMock := mocks.NewMockSecretNamespaceLister(gomock.NewController(t))
+				secretNamespaceListerMock.EXPECT().Get("image-pull-secret").Return(
+					&v1.Secret{
+						Type: "kubernetes.io/dockerconfigjson",
+						Data: map[string][]byte{
+							".dockerconfigjson": []byte(`{"auths": {"server": {"auth": "dXNlcjpwYXNzOndvcmQ="}}}`),
+						},
+					},
+					nil,
+				)
+				secretListerMock.EXPECT().Secrets("test").Return(secretNamespaceListerMock)
+				return secretListerMock
+			},
+		},
 		{
 			description: "test invalid secret key name returns error",
 			err:         "no dockerconfigjson present in secret",
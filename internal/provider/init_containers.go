@@ -0,0 +1,286 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The name of the sidecar container reporting the init containers that completed
+	initGateContainerName = "init-gate"
+
+	// The environment variables the init gate is configured with
+	initGatePortEnvVar = "INIT_GATE_PORT"
+	initGateDirEnvVar  = "INIT_GATE_DIR"
+
+	// The volume shared by the init containers, the containers and the init gate, in which each
+	// init container that completed leaves a <name>.done file
+	initGateVolumeName = "vk-init-gate"
+	initGateMountPath  = "/.vk-init"
+	initGateVolumeSize = "1Gi"
+
+	// The reasons Kubernetes reports for the containers of pods whose init containers haven't completed
+	podInitializingReason          = "PodInitializing"
+	containersNotInitializedReason = "ContainersNotInitialized"
+	containersNotReadyReason       = "ContainersNotReady"
+	initContainerCompletedReason   = "Completed"
+)
+
+// The scripts wrapping the commands of the init containers and of the containers, which are run by /bin/sh with
+// the init gate directory as $0 and the original command as the positional parameters. An init container waits
+// for the previous one to complete, runs its command unless it already completed, and keeps running so StackPath
+// doesn't restart it. A container waits for the last init container to complete before running its command.
+const (
+	initGateWaitScript      = `until [ -f "$0/%s.done" ]; do sleep 1; done; `
+	initContainerScript     = `if [ ! -f "$0/%[1]s.done" ]; then %[2]s"$@" || exit; : > "$0/%[1]s.done"; fi; exec sleep 2147483647`
+	gatedContainerScript    = `%sexec "$@"`
+	initGateProbePathPrefix = "/init/"
+)
+
+// getPodContainers returns the init containers and the containers of the pod
+func getPodContainers(pod *v1.Pod) []v1.Container {
+	containers := make([]v1.Container, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	containers = append(containers, pod.Spec.InitContainers...)
+	return append(containers, pod.Spec.Containers...)
+}
+
+// addInitGate adds the init containers of the pod to the containers, which StackPath all starts at once.
+// They are run one after the other by wrapping their commands, and the containers are held until the last one
+// completed. Each init container is reported as ready by the init gate sidecar once it completed, and the
+// volume claim of the directory in which they record their completion is returned. The native sidecars, which
+// are already among the containers, are started in their turn and then keep running along with the containers.
+// The containers of pods run to completion record their completion the same way, see getRunToCompletionScript.
+// When the pod has a volume writer, which addVolumeWriter added, the first of them waits for it to write the files.
+// The gated commands are run by /bin/sh, which the images of those containers must provide, while the native
+// sidecars that neither wait for an init container nor are waited for run their command as is.
+func (p *StackpathProvider) addInitGate(ctx context.Context, pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry) ([]*workload_models.V1VolumeClaim, error) {
+	sidecarNames := getNativeSidecarNames(pod)
+	k8sInitContainers := []v1.Container{}
+	for _, k8sContainer := range pod.Spec.InitContainers {
+		if !sidecarNames[k8sContainer.Name] {
+			k8sInitContainers = append(k8sInitContainers, k8sContainer)
+		}
+	}
+	runToCompletion := isRunToCompletion(pod) && p.apiConfig.InitGateImage != ""
+	_, volumeWriter := containers[volumeWriterContainerName]
+	volumeWriter = volumeWriter && p.apiConfig.InitGateImage != ""
+	if len(k8sInitContainers) == 0 && !runToCompletion && !volumeWriter {
+		// the pods whose init containers are all native sidecars run them as containers, and so do the pods
+		// run to completion without init gate, whose containers are restarted whenever they exit
+		return nil, nil
+	}
+	if p.apiConfig.InitGateImage == "" {
+		return nil, fmt.Errorf("init containers are only supported when the init gate image is set")
+	}
+
+	initContainers, err := p.getWorkloadContainersFrom(ctx, pod, k8sInitContainers)
+	if err != nil {
+		return nil, err
+	}
+
+	gateVolumeMount := &workload_models.V1InstanceVolumeMount{Slug: initGateVolumeName, MountPath: initGateMountPath}
+	initGatePort := p.apiConfig.InitGatePort
+
+	// the native sidecars are only gated when they start after an init container or an init container starts after them
+	lastInitContainer := -1
+	for i, k8sContainer := range pod.Spec.InitContainers {
+		if !sidecarNames[k8sContainer.Name] {
+			lastInitContainer = i
+		}
+	}
+
+	wait := ""
+	if volumeWriter {
+		// the first init container, or the containers when there are none, wait for the volume writer to write the files
+		wait = fmt.Sprintf(initGateWaitScript, volumeWriterContainerName)
+	}
+	for i, k8sContainer := range pod.Spec.InitContainers {
+		if sidecarNames[k8sContainer.Name] {
+			if wait == "" && i > lastInitContainer {
+				continue
+			}
+			container := containers[k8sContainer.Name]
+			script := fmt.Sprintf(nativeSidecarScript, wait, k8sContainer.Name)
+			if container.Command, err = p.getGatedCommand(ctx, pod, &k8sContainer, container.Command, script); err != nil {
+				return nil, err
+			}
+			container.VolumeMounts = append(container.VolumeMounts, gateVolumeMount)
+			containers[k8sContainer.Name] = container
+			wait = fmt.Sprintf(initGateWaitScript, k8sContainer.Name)
+			continue
+		}
+
+		container := initContainers[k8sContainer.Name]
+		script := getRunToCompletionScript(pod, k8sContainer.Name, wait)
+		if container.Command, err = p.getGatedCommand(ctx, pod, &k8sContainer, container.Command, script); err != nil {
+			return nil, err
+		}
+		container.VolumeMounts = append(container.VolumeMounts, gateVolumeMount)
+		container.ReadinessProbe = getInitGateProbe(k8sContainer.Name, initGatePort)
+		containers[k8sContainer.Name] = container
+		wait = fmt.Sprintf(initGateWaitScript, k8sContainer.Name)
+	}
+
+	for _, k8sContainer := range pod.Spec.Containers {
+		container := containers[k8sContainer.Name]
+		script := fmt.Sprintf(gatedContainerScript, wait)
+		if runToCompletion {
+			// the readiness of the containers reports their completion, as it does for the init containers
+			script = getRunToCompletionScript(pod, k8sContainer.Name, wait)
+			container.ReadinessProbe = getInitGateProbe(k8sContainer.Name, initGatePort)
+		}
+		if container.Command, err = p.getGatedCommand(ctx, pod, &k8sContainer, container.Command, script); err != nil {
+			return nil, err
+		}
+		container.VolumeMounts = append(container.VolumeMounts, gateVolumeMount)
+		containers[k8sContainer.Name] = container
+	}
+
+	err = p.addProbeSidecar(pod, containers, initGateContainerName, p.apiConfig.InitGateImage, initGatePort, workload_models.V1EnvironmentVariableMapEntry{
+		initGatePortEnvVar: {Value: fmt.Sprint(initGatePort)},
+		initGateDirEnvVar:  {Value: initGateMountPath},
+	})
+	if err != nil {
+		return nil, err
+	}
+	initGate := containers[initGateContainerName]
+	initGate.VolumeMounts = []*workload_models.V1InstanceVolumeMount{gateVolumeMount}
+	containers[initGateContainerName] = initGate
+
+	return []*workload_models.V1VolumeClaim{
+		{
+			Name:     initGateVolumeName,
+			Slug:     initGateVolumeName,
+			Metadata: &workload_models.V1Metadata{},
+			Spec: &workload_models.V1VolumeClaimSpec{
+				Resources: &workload_models.V1ResourceRequirements{
+					Limits:   workload_models.V1StringMapEntry{"storage": initGateVolumeSize},
+					Requests: workload_models.V1StringMapEntry{"storage": initGateVolumeSize},
+				},
+			},
+		},
+	}, nil
+}
+
+// getInitGateProbe returns the readiness probe against the init gate, which succeeds once the container completed
+func getInitGateProbe(name string, port int32) *workload_models.V1Probe {
+	return &workload_models.V1Probe{
+		PeriodSeconds:    2,
+		SuccessThreshold: 1,
+		FailureThreshold: 1,
+		TimeoutSeconds:   1,
+		HTTPGet: &workload_models.V1HTTPGetAction{
+			Path:   initGateProbePathPrefix + name,
+			Port:   port,
+			Scheme: string(v1.URISchemeHTTP),
+		},
+	}
+}
+
+// getGatedCommand returns the command running the command of the container through the script.
+// The containers without command run the command of their image, which is read from its registry.
+func (p *StackpathProvider) getGatedCommand(ctx context.Context, pod *v1.Pod, k8sContainer *v1.Container, command []string, script string) ([]string, error) {
+	if len(command) == 0 {
+		var err error
+		if command, err = p.getImageCommand(ctx, pod, k8sContainer.Image); err != nil {
+			return nil, err
+		}
+		if len(command) == 0 {
+			return nil, fmt.Errorf("the container %s has no command and its image %s has neither entrypoint nor cmd", k8sContainer.Name, k8sContainer.Image)
+		}
+	}
+	return append([]string{"/bin/sh", "-c", script, initGateMountPath}, command...), nil
+}
+
+// setInitContainerStatus reports the statuses of the init containers of the pod, which the instance reports along
+// with the statuses of the containers, in the init container statuses of the pod. An init container is completed
+// once the init gate reports it as ready, and a native sidecar once it's running. Until every init container
+// completed, the pod is pending, the containers are waiting for the pod to be initialized, and the pod's
+// conditions report it isn't initialized.
+func setInitContainerStatus(pod *v1.Pod, status *v1.PodStatus) {
+	if len(pod.Spec.InitContainers) == 0 {
+		return
+	}
+	sidecarNames := getNativeSidecarNames(pod)
+
+	initContainerNames := make(map[string]bool, len(pod.Spec.InitContainers))
+	for _, initContainer := range pod.Spec.InitContainers {
+		initContainerNames[initContainer.Name] = true
+	}
+
+	instanceStatuses := map[string]v1.ContainerStatus{}
+	containerStatuses := make([]v1.ContainerStatus, 0, len(status.ContainerStatuses))
+	for _, containerStatus := range status.ContainerStatuses {
+		if initContainerNames[containerStatus.Name] {
+			instanceStatuses[containerStatus.Name] = containerStatus
+			continue
+		}
+		containerStatuses = append(containerStatuses, containerStatus)
+	}
+	status.ContainerStatuses = containerStatuses
+
+	incomplete := []string{}
+	status.InitContainerStatuses = make([]v1.ContainerStatus, 0, len(pod.Spec.InitContainers))
+	for _, initContainer := range pod.Spec.InitContainers {
+		initContainerStatus, ok := instanceStatuses[initContainer.Name]
+		switch {
+		case !ok || len(incomplete) != 0:
+			// the init container waits for the previous one, whatever the state of the script waiting for it
+			initContainerStatus = v1.ContainerStatus{
+				Name:         initContainer.Name,
+				Image:        initContainer.Image,
+				State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: podInitializingReason}},
+				RestartCount: initContainerStatus.RestartCount,
+			}
+			incomplete = append(incomplete, initContainer.Name)
+		case sidecarNames[initContainer.Name]:
+			// the native sidecar keeps its state, as it runs along with the containers
+			if initContainerStatus.State.Running == nil {
+				incomplete = append(incomplete, initContainer.Name)
+			}
+		case initContainerStatus.Ready:
+			terminated := &v1.ContainerStateTerminated{ExitCode: 0, Reason: initContainerCompletedReason}
+			if initContainerStatus.State.Running != nil {
+				terminated.StartedAt = initContainerStatus.State.Running.StartedAt
+			}
+			initContainerStatus.State = v1.ContainerState{Terminated: terminated}
+		default:
+			incomplete = append(incomplete, initContainer.Name)
+		}
+		status.InitContainerStatuses = append(status.InitContainerStatuses, initContainerStatus)
+	}
+
+	if len(incomplete) == 0 {
+		return
+	}
+
+	if status.Phase == v1.PodRunning {
+		status.Phase = v1.PodPending
+	}
+
+	notReady := make([]string, 0, len(status.ContainerStatuses))
+	for i := range status.ContainerStatuses {
+		containerStatus := &status.ContainerStatuses[i]
+		containerStatus.Ready = false
+		containerStatus.State = v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: podInitializingReason}}
+		notReady = append(notReady, containerStatus.Name)
+	}
+
+	for i := range status.Conditions {
+		condition := &status.Conditions[i]
+		switch condition.Type {
+		case v1.PodInitialized:
+			condition.Status = v1.ConditionFalse
+			condition.Reason = containersNotInitializedReason
+			condition.Message = fmt.Sprintf("containers with incomplete status: [%s]", strings.Join(incomplete, " "))
+		case v1.PodReady:
+			condition.Status = v1.ConditionFalse
+			condition.Reason = containersNotReadyReason
+			condition.Message = fmt.Sprintf("containers with unready status: [%s]", strings.Join(notReady, " "))
+		}
+	}
+}
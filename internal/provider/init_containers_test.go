@@ -0,0 +1,256 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stackpath/vk-stackpath-provider/internal/registry"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+// newInitContainersPod returns a pod whose app container, running the image given, is preceded by two init containers
+func newInitContainersPod(image string) *v1.Pod {
+	return createTestPodWithContainers([]v1.Container{
+		{Name: "migrate", Image: "app:latest", Command: []string{"migrate"}, Args: []string{"up"}},
+		{Name: "render", Image: "render:latest", Command: []string{"render", "--out", "/config"}},
+	}, v1.Container{Name: "app", Image: image})
+}
+
+func TestAddInitContainers(t *testing.T) {
+	ctx := context.Background()
+
+	// a local registry serving the image app:1.0, which runs /docker-entrypoint.sh nginx
+	registryServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/app/manifests/1.0":
+			fmt.Fprint(w, `{"mediaType": "application/vnd.oci.image.manifest.v1+json", "config": {"digest": "sha256:app"}}`)
+		case "/v2/app/blobs/sha256:app":
+			fmt.Fprint(w, `{"config": {"Entrypoint": ["/docker-entrypoint.sh"], "Cmd": ["nginx"]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer registryServer.Close()
+	registryHost := strings.TrimPrefix(registryServer.URL, "https://")
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.entrypointResolver = registry.NewResolver(registryServer.Client())
+
+	t.Run("sequences the init containers and holds the containers until they completed", func(t *testing.T) {
+		provider.apiConfig.InitGateImage = "stackpath/init-gate:latest"
+
+		workload, err := provider.getWorkloadFrom(ctx, newInitContainersPod(registryHost+"/app:1.0"))
+		assert.NoError(t, err)
+
+		containers := workload.Spec.Containers
+		assert.Len(t, containers, 4)
+		gateVolumeMount := []*workload_models.V1InstanceVolumeMount{{Slug: initGateVolumeName, MountPath: initGateMountPath}}
+
+		migrate := containers["migrate"]
+		assert.Equal(t, []string{"/bin/sh", "-c", `if [ ! -f "$0/migrate.done" ]; then "$@" || exit; : > "$0/migrate.done"; fi; exec sleep 2147483647`, initGateMountPath, "migrate", "up"}, migrate.Command)
+		assert.Equal(t, gateVolumeMount, migrate.VolumeMounts)
+		assert.Equal(t, &workload_models.V1HTTPGetAction{Path: "/init/migrate", Port: 8083, Scheme: "HTTP"}, migrate.ReadinessProbe.HTTPGet)
+
+		render := containers["render"]
+		assert.Equal(t, []string{"/bin/sh", "-c", `if [ ! -f "$0/render.done" ]; then until [ -f "$0/migrate.done" ]; do sleep 1; done; "$@" || exit; : > "$0/render.done"; fi; exec sleep 2147483647`, initGateMountPath, "render", "--out", "/config"}, render.Command)
+		assert.Equal(t, &workload_models.V1HTTPGetAction{Path: "/init/render", Port: 8083, Scheme: "HTTP"}, render.ReadinessProbe.HTTPGet)
+
+		app := containers["app"]
+		assert.Equal(t, []string{"/bin/sh", "-c", `until [ -f "$0/render.done" ]; do sleep 1; done; exec "$@"`, initGateMountPath, "/docker-entrypoint.sh", "nginx"}, app.Command)
+		assert.Equal(t, gateVolumeMount, app.VolumeMounts)
+		assert.Nil(t, app.ReadinessProbe)
+
+		initGate := containers[initGateContainerName]
+		assert.Equal(t, "stackpath/init-gate:latest", initGate.Image)
+		assert.Equal(t, workload_models.V1EnvironmentVariableMapEntry{
+			initGatePortEnvVar: {Value: "8083"},
+			initGateDirEnvVar:  {Value: initGateMountPath},
+		}, initGate.Env)
+		assert.Equal(t, gateVolumeMount, initGate.VolumeMounts)
+
+		assert.Len(t, workload.Spec.VolumeClaimTemplates, 1)
+		assert.Equal(t, initGateVolumeName, workload.Spec.VolumeClaimTemplates[0].Slug)
+	})
+
+	t.Run("leaves the pods without init containers unchanged", func(t *testing.T) {
+		provider.apiConfig.InitGateImage = ""
+		pod := newInitContainersPod("app:latest")
+		pod.Spec.InitContainers = nil
+		pod.Spec.Containers[0].Command = []string{"app"}
+
+		workload, err := provider.getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+		assert.Len(t, workload.Spec.Containers, 1)
+		assert.Equal(t, []string{"app"}, workload.Spec.Containers["app"].Command)
+		assert.Empty(t, workload.Spec.VolumeClaimTemplates)
+	})
+
+	t.Run("fails without init gate image", func(t *testing.T) {
+		provider.apiConfig.InitGateImage = ""
+		_, err := provider.getWorkloadFrom(ctx, newInitContainersPod(registryHost+"/app:1.0"))
+		assert.EqualError(t, err, "init containers are only supported when the init gate image is set")
+	})
+
+	t.Run("fails when the command of the image can't be read", func(t *testing.T) {
+		provider.apiConfig.InitGateImage = "stackpath/init-gate:latest"
+		_, err := provider.getWorkloadFrom(ctx, newInitContainersPod(registryHost+"/missing:1.0"))
+		assert.ErrorContains(t, err, "failed to read the manifest of the image "+registryHost+"/missing:1.0")
+	})
+
+	t.Run("fails when a container is named after the init gate", func(t *testing.T) {
+		pod := newInitContainersPod(registryHost + "/app:1.0")
+		pod.Spec.InitContainers[1].Name = initGateContainerName
+
+		provider.apiConfig.InitGateImage = "stackpath/init-gate:latest"
+		_, err := provider.getWorkloadFrom(ctx, pod)
+		assert.EqualError(t, err, "the container name init-gate is reserved for the provider's probe sidecar")
+	})
+}
+
+func TestSetInitContainerStatus(t *testing.T) {
+	pod := newInitContainersPod("app:latest")
+
+	running := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	podInitializing := v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: podInitializingReason}}
+	completed := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: initContainerCompletedReason}}
+	failed := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}}
+
+	newStatus := func(migrate, render v1.ContainerStatus, appReady bool) *v1.PodStatus {
+		migrate.Name = "migrate"
+		render.Name = "render"
+		return &v1.PodStatus{
+			Phase: v1.PodRunning,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionTrue},
+				{Type: v1.PodInitialized, Status: v1.ConditionTrue},
+				{Type: v1.PodScheduled, Status: v1.ConditionTrue},
+			},
+			ContainerStatuses: []v1.ContainerStatus{
+				migrate,
+				{Name: "app", State: running, Ready: appReady},
+				render,
+			},
+		}
+	}
+
+	testCases := []struct {
+		description          string
+		status               *v1.PodStatus
+		expectedPhase        v1.PodPhase
+		expectedInitStatuses []v1.ContainerStatus
+		expectedAppState     v1.ContainerState
+		expectedAppReady     bool
+		expectedInitialized  v1.PodCondition
+		expectedReadyStatus  v1.ConditionStatus
+		expectedReadyReason  string
+		expectedReadyMessage string
+	}{
+		{
+			description:   "reports the init container running and the ones waiting for it",
+			status:        newStatus(v1.ContainerStatus{State: running}, v1.ContainerStatus{State: running}, true),
+			expectedPhase: v1.PodPending,
+			expectedInitStatuses: []v1.ContainerStatus{
+				{Name: "migrate", State: running},
+				{Name: "render", Image: "render:latest", State: podInitializing},
+			},
+			expectedAppState:     podInitializing,
+			expectedInitialized:  v1.PodCondition{Type: v1.PodInitialized, Status: v1.ConditionFalse, Reason: containersNotInitializedReason, Message: "containers with incomplete status: [migrate render]"},
+			expectedReadyStatus:  v1.ConditionFalse,
+			expectedReadyReason:  containersNotReadyReason,
+			expectedReadyMessage: "containers with unready status: [app]",
+		},
+		{
+			description:   "reports the init container that failed after the ones that completed",
+			status:        newStatus(v1.ContainerStatus{State: running, Ready: true}, v1.ContainerStatus{State: failed, RestartCount: 2}, true),
+			expectedPhase: v1.PodPending,
+			expectedInitStatuses: []v1.ContainerStatus{
+				{Name: "migrate", State: completed, Ready: true},
+				{Name: "render", State: failed, RestartCount: 2},
+			},
+			expectedAppState:     podInitializing,
+			expectedInitialized:  v1.PodCondition{Type: v1.PodInitialized, Status: v1.ConditionFalse, Reason: containersNotInitializedReason, Message: "containers with incomplete status: [render]"},
+			expectedReadyStatus:  v1.ConditionFalse,
+			expectedReadyReason:  containersNotReadyReason,
+			expectedReadyMessage: "containers with unready status: [app]",
+		},
+		{
+			description:   "reports the pod initialized once every init container completed",
+			status:        newStatus(v1.ContainerStatus{State: running, Ready: true}, v1.ContainerStatus{State: running, Ready: true}, true),
+			expectedPhase: v1.PodRunning,
+			expectedInitStatuses: []v1.ContainerStatus{
+				{Name: "migrate", State: completed, Ready: true},
+				{Name: "render", State: completed, Ready: true},
+			},
+			expectedAppState:    running,
+			expectedAppReady:    true,
+			expectedInitialized: v1.PodCondition{Type: v1.PodInitialized, Status: v1.ConditionTrue},
+			expectedReadyStatus: v1.ConditionTrue,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			setInitContainerStatus(pod, c.status)
+
+			assert.Equal(t, c.expectedPhase, c.status.Phase)
+			assert.Equal(t, c.expectedInitStatuses, c.status.InitContainerStatuses)
+			assert.Len(t, c.status.ContainerStatuses, 1)
+			assert.Equal(t, c.expectedAppState, c.status.ContainerStatuses[0].State)
+			assert.Equal(t, c.expectedAppReady, c.status.ContainerStatuses[0].Ready)
+			assert.Equal(t, c.expectedInitialized, c.status.Conditions[1])
+			assert.Equal(t, c.expectedReadyStatus, c.status.Conditions[0].Status)
+			assert.Equal(t, c.expectedReadyReason, c.status.Conditions[0].Reason)
+			assert.Equal(t, c.expectedReadyMessage, c.status.Conditions[0].Message)
+		})
+	}
+
+	t.Run("leaves the status of pods without init containers unchanged", func(t *testing.T) {
+		status := newStatus(v1.ContainerStatus{}, v1.ContainerStatus{}, true)
+		expected := status.DeepCopy()
+
+		setInitContainerStatus(&v1.Pod{}, status)
+		assert.Equal(t, expected, status)
+	})
+}
+
+func TestGetPodStatusOfInitContainers(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	ctx := context.Background()
+
+	isc := mocks.NewInstanceClientService(mockController)
+	pod := createTestPod("test-pod", "test-ns")
+	pod.Spec.InitContainers = []v1.Container{{Name: "migrate", Image: "app:latest", Command: []string{"migrate"}}}
+
+	provider, err := createTestProvider(ctx, nil, nil, createTestPodLister(mockController, pod), &workload_client.EdgeCompute{Instance: isc})
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.apiConfig.InitGateImage = "stackpath/init-gate:latest"
+
+	// the init container is still running, so the pod is reported as initializing as GetPod reports it
+	i := createTestPodInstance(provider.getInstanceName("test-ns", "test-pod"), workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.1")
+	i.ContainerStatuses = append(i.ContainerStatuses, &workload_models.V1ContainerStatus{Name: "migrate", Running: &workload_models.ContainerStatusRunning{}})
+	isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(&instance.GetWorkloadInstanceOK{Payload: &workload_models.V1GetWorkloadInstanceResponse{Instance: i}}, nil)
+
+	podStatus, err := provider.GetPodStatus(ctx, "test-ns", "test-pod")
+	assert.NoError(t, err)
+	assert.Equal(t, v1.PodPending, podStatus.Phase)
+	assert.Len(t, podStatus.ContainerStatuses, 1)
+	assert.Len(t, podStatus.InitContainerStatuses, 1)
+	assert.Equal(t, "migrate", podStatus.InitContainerStatuses[0].Name)
+	assert.Nil(t, podStatus.InitContainerStatuses[0].State.Terminated)
+}
@@ -0,0 +1,241 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// The prefix of the annotations recording the instance size of each container of a pod, e.g.
+	//
+	//	instance-size.vk.stackpath.com/nginx: SP-2
+	instanceSizeAnnotationPrefix = "instance-size.vk.stackpath.com/"
+
+	// The reasons of the events recorded for the containers whose resources don't fit their instance size
+	instanceSizeExceededReason      = "InstanceSizeExceeded"
+	instanceSizeRatioMismatchReason = "InstanceSizeRatioMismatch"
+)
+
+// instanceSizeSelection is the instance size chosen for the resources of a container
+type instanceSizeSelection struct {
+	size config.InstanceSize
+	// whether no instance size fits the resources of the container, the largest one is then the one chosen
+	oversize bool
+	// the CPU and memory of the container, the largest of its requests and limits
+	cpu    resource.Quantity
+	memory resource.Quantity
+}
+
+// getInstanceSizeFrom returns the instance size the resources of the container are allocated with, which is chosen
+// among the configured sizes according to the instance size policy. The resources of the container are the largest
+// of its requests and limits, and default to the CPU and memory of the StackPath SP-1 size when they aren't set.
+func (p *StackpathProvider) getInstanceSizeFrom(k8sContainer *v1.Container) (*instanceSizeSelection, error) {
+	cpu, memory := getContainerCPUAndMemory(k8sContainer.Resources)
+	sizes := p.apiConfig.InstanceSizes
+
+	selection := &instanceSizeSelection{cpu: cpu, memory: memory}
+	largest := sizes[0]
+	for _, size := range sizes[1:] {
+		if compareInstanceSizes(size, largest) > 0 {
+			largest = size
+		}
+	}
+	// the catalogue may have sizes with more memory but less CPU than others, so the container is only oversize
+	// when no size fits both its CPU and its memory
+	fitting, ok := getSmallestFittingInstanceSize(sizes, cpu, memory)
+	selection.oversize = !ok
+
+	switch {
+	case selection.oversize && p.apiConfig.InstanceSizePolicy == config.InstanceSizePolicyRejectIfOversize:
+		return nil, fmt.Errorf("the resources of the container %s (%s CPU, %s memory) exceed the largest instance size %s (%s CPU, %s memory)",
+			k8sContainer.Name, cpu.String(), memory.String(), largest.Name, largest.CPU, largest.Memory)
+	case selection.oversize:
+		selection.size = largest
+	case p.apiConfig.InstanceSizePolicy == config.InstanceSizePolicyNearestFit:
+		selection.size = getNearestInstanceSize(sizes, cpu, memory)
+	default:
+		selection.size = fitting
+	}
+
+	if p.apiConfig.InstanceSizePolicy == config.InstanceSizePolicyFailIfRatioMismatch {
+		ratio := getMemoryPerCPU(cpu, memory)
+		sizeRatio := getMemoryPerCPU(resource.MustParse(selection.size.CPU), resource.MustParse(selection.size.Memory))
+		tolerance := p.apiConfig.InstanceSizeRatioTolerance
+		if ratio > sizeRatio*tolerance || ratio*tolerance < sizeRatio {
+			return nil, fmt.Errorf("the memory to CPU ratio of the container %s (%s CPU, %s memory) doesn't match the ratio of its instance size %s (%s CPU, %s memory)",
+				k8sContainer.Name, cpu.String(), memory.String(), selection.size.Name, selection.size.CPU, selection.size.Memory)
+		}
+	}
+
+	return selection, nil
+}
+
+// getContainerCPUAndMemory returns the largest of the requests and the limits of the resources
+func getContainerCPUAndMemory(k8sResource v1.ResourceRequirements) (resource.Quantity, resource.Quantity) {
+	var requestCPU, requestMEM, limitCPU, limitMEM *resource.Quantity
+
+	// default values matching SP1
+	defaultCPU := resource.NewQuantity(1, resource.DecimalSI)
+	defaultMEM := resource.NewQuantity(2*oneGi, resource.BinarySI)
+
+	if k8sResource.Requests != nil {
+		requestCPU = k8sResource.Requests.Cpu()
+		requestMEM = k8sResource.Requests.Memory()
+	} else {
+		requestCPU = defaultCPU
+		requestMEM = defaultMEM
+	}
+
+	if k8sResource.Limits != nil {
+		limitCPU = k8sResource.Limits.Cpu()
+		limitMEM = k8sResource.Limits.Memory()
+	} else {
+		limitCPU = defaultCPU
+		limitMEM = defaultMEM
+	}
+
+	return *maxResource(requestCPU, limitCPU), *maxResource(requestMEM, limitMEM)
+}
+
+// compareInstanceSizes orders the instance sizes by CPU, then by memory
+func compareInstanceSizes(x, y config.InstanceSize) int {
+	xCPU, yCPU := resource.MustParse(x.CPU), resource.MustParse(y.CPU)
+	if c := xCPU.Cmp(yCPU); c != 0 {
+		return c
+	}
+	xMemory, yMemory := resource.MustParse(x.Memory), resource.MustParse(y.Memory)
+	return xMemory.Cmp(yMemory)
+}
+
+// getSmallestFittingInstanceSize returns the smallest instance size whose CPU and memory are
+// both at least the ones given, and whether there is such a size
+func getSmallestFittingInstanceSize(sizes []config.InstanceSize, cpu, memory resource.Quantity) (config.InstanceSize, bool) {
+	var smallest *config.InstanceSize
+	for i, size := range sizes {
+		if cpu.Cmp(resource.MustParse(size.CPU)) > 0 || memory.Cmp(resource.MustParse(size.Memory)) > 0 {
+			continue
+		}
+		if smallest == nil || compareInstanceSizes(size, *smallest) < 0 {
+			smallest = &sizes[i]
+		}
+	}
+	if smallest == nil {
+		return config.InstanceSize{}, false
+	}
+	return *smallest, true
+}
+
+// getNearestInstanceSize returns the instance size whose CPU and memory are the nearest to the ones given,
+// by the sum of their relative differences. The smallest of the sizes as near as each other is returned.
+func getNearestInstanceSize(sizes []config.InstanceSize, cpu, memory resource.Quantity) config.InstanceSize {
+	relativeDifference := func(x, y resource.Quantity) float64 {
+		a, b := x.AsApproximateFloat64(), y.AsApproximateFloat64()
+		return math.Abs(a-b) / math.Max(a, b)
+	}
+
+	nearest := sizes[0]
+	nearestDistance := math.Inf(1)
+	for _, size := range sizes {
+		distance := relativeDifference(cpu, resource.MustParse(size.CPU)) + relativeDifference(memory, resource.MustParse(size.Memory))
+		if distance < nearestDistance || (distance == nearestDistance && compareInstanceSizes(size, nearest) < 0) {
+			nearest = size
+			nearestDistance = distance
+		}
+	}
+	return nearest
+}
+
+// getMemoryPerCPU returns the bytes of memory per CPU, which is infinite without CPU
+func getMemoryPerCPU(cpu, memory resource.Quantity) float64 {
+	if cpu.IsZero() {
+		return math.Inf(1)
+	}
+	return memory.AsApproximateFloat64() / cpu.AsApproximateFloat64()
+}
+
+// getWorkloadContainerResourcesFrom returns the resources of the instance size the container is allocated with
+func (p *StackpathProvider) getWorkloadContainerResourcesFrom(k8sContainer *v1.Container) (*workload_models.V1ResourceRequirements, error) {
+	selection, err := p.getInstanceSizeFrom(k8sContainer)
+	if err != nil {
+		return nil, err
+	}
+	return getInstanceSizeResources(selection.size), nil
+}
+
+// getSidecarResources returns the resources of the sidecar containers the provider adds to the workloads, which are
+// allocated with the sidecar instance size whatever the size of the containers of the pod
+func (p *StackpathProvider) getSidecarResources() *workload_models.V1ResourceRequirements {
+	return getInstanceSizeResources(p.apiConfig.GetSidecarInstanceSize())
+}
+
+// getInstanceSizeResources returns the resources StackPath allocates the instance size with
+func getInstanceSizeResources(size config.InstanceSize) *workload_models.V1ResourceRequirements {
+	return &workload_models.V1ResourceRequirements{
+		Requests: workload_models.V1StringMapEntry{"cpu": size.CPU, "memory": size.Memory},
+		Limits:   workload_models.V1StringMapEntry{"cpu": size.CPU, "memory": size.Memory},
+	}
+}
+
+// recordInstanceSizes records a Warning event for each container of the pod exceeding the largest instance size
+// rather than silently downsizing it, and for each container rejected by the instance size policy. It's called
+// when the pod is created, so updating its workload doesn't record them again.
+func (p *StackpathProvider) recordInstanceSizes(pod *v1.Pod) {
+	for _, k8sContainer := range getPodContainers(pod) {
+		selection, err := p.getInstanceSizeFrom(&k8sContainer)
+		switch {
+		case err != nil && p.apiConfig.InstanceSizePolicy == config.InstanceSizePolicyFailIfRatioMismatch:
+			p.eventRecorder.Event(pod, v1.EventTypeWarning, instanceSizeRatioMismatchReason, err.Error())
+		case err != nil:
+			p.eventRecorder.Event(pod, v1.EventTypeWarning, instanceSizeExceededReason, err.Error())
+		case selection.oversize:
+			p.eventRecorder.Eventf(pod, v1.EventTypeWarning, instanceSizeExceededReason,
+				"the resources of the container %s (%s CPU, %s memory) exceed the largest instance size, it's allocated with the instance size %s (%s CPU, %s memory)",
+				k8sContainer.Name, selection.cpu.String(), selection.memory.String(), selection.size.Name, selection.size.CPU, selection.size.Memory)
+		}
+	}
+}
+
+// getInstanceSizeAnnotations returns the annotations recording the instance size of each container of the pod
+func (p *StackpathProvider) getInstanceSizeAnnotations(pod *v1.Pod) map[string]string {
+	annotations := map[string]string{}
+	for _, k8sContainer := range getPodContainers(pod) {
+		if selection, err := p.getInstanceSizeFrom(&k8sContainer); err == nil {
+			annotations[instanceSizeAnnotationPrefix+k8sContainer.Name] = selection.size.Name
+		}
+	}
+	return annotations
+}
+
+// annotateInstanceSizes records the instance size of each container of the pod in its annotations. The pod is
+// only patched when its annotations differ, and failing to patch it doesn't fail the creation of its workload.
+func (p *StackpathProvider) annotateInstanceSizes(ctx context.Context, pod *v1.Pod) {
+	annotations := map[string]string{}
+	for key, value := range p.getInstanceSizeAnnotations(pod) {
+		if pod.Annotations[key] != value {
+			annotations[key] = value
+		}
+	}
+	if len(annotations) == 0 {
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+	if err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to annotate the instance sizes of the pod %s/%s", pod.Namespace, pod.Name)
+		return
+	}
+	_, err = p.podsClient.Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to annotate the instance sizes of the pod %s/%s", pod.Namespace, pod.Name)
+	}
+}
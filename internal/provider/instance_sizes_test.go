@@ -0,0 +1,231 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// newSizedContainer returns a container whose requests and limits are the CPU and memory given
+func newSizedContainer(cpu, memory string) *v1.Container {
+	resources := v1.ResourceList{"cpu": resource.MustParse(cpu), "memory": resource.MustParse(memory)}
+	return &v1.Container{
+		Name:      "app",
+		Image:     "app:latest",
+		Resources: v1.ResourceRequirements{Requests: resources, Limits: resources},
+	}
+}
+
+func TestInstanceSizePolicies(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		description   string
+		policy        string
+		sizes         []config.InstanceSize
+		container     *v1.Container
+		expectedSize  string
+		expectedError string
+	}{
+		{
+			description:  "rounds the resources up to the smallest size they fit in",
+			policy:       config.InstanceSizePolicyAlwaysRoundUp,
+			container:    newSizedContainer("3", "3Gi"),
+			expectedSize: "SP-4",
+		},
+		{
+			description:  "picks the size the nearest to the resources",
+			policy:       config.InstanceSizePolicyNearestFit,
+			container:    newSizedContainer("3", "3Gi"),
+			expectedSize: "SP-2",
+		},
+		{
+			description:  "picks the largest size for the resources exceeding it",
+			policy:       config.InstanceSizePolicyNearestFit,
+			container:    newSizedContainer("16", "3Gi"),
+			expectedSize: "SP-5",
+		},
+		{
+			description:   "rejects the resources exceeding the largest size",
+			policy:        config.InstanceSizePolicyRejectIfOversize,
+			container:     newSizedContainer("16", "3Gi"),
+			expectedError: "the resources of the container app (16 CPU, 3Gi memory) exceed the largest instance size SP-5 (8 CPU, 32Gi memory)",
+		},
+		{
+			description:  "accepts the resources fitting the largest size",
+			policy:       config.InstanceSizePolicyRejectIfOversize,
+			container:    newSizedContainer("8", "32Gi"),
+			expectedSize: "SP-5",
+		},
+		{
+			description:  "accepts the resources whose ratio matches their size",
+			policy:       config.InstanceSizePolicyFailIfRatioMismatch,
+			container:    newSizedContainer("2", "7Gi"),
+			expectedSize: "SP-3",
+		},
+		{
+			description:   "rejects the resources whose ratio doesn't match their size",
+			policy:        config.InstanceSizePolicyFailIfRatioMismatch,
+			container:     newSizedContainer("100m", "24Gi"),
+			expectedError: "the memory to CPU ratio of the container app (100m CPU, 24Gi memory) doesn't match the ratio of its instance size SP-5 (8 CPU, 32Gi memory)",
+		},
+		{
+			description: "picks the sizes of the configured catalogue",
+			policy:      config.InstanceSizePolicyAlwaysRoundUp,
+			sizes: []config.InstanceSize{
+				{Name: "large", CPU: "16", Memory: "64Gi"},
+				{Name: "small", CPU: "500m", Memory: "1Gi"},
+			},
+			container:    newSizedContainer("2", "1Gi"),
+			expectedSize: "large",
+		},
+		{
+			description: "picks the size with more memory but less CPU than the largest one",
+			policy:      config.InstanceSizePolicyRejectIfOversize,
+			sizes: []config.InstanceSize{
+				{Name: "SP-5", CPU: "8", Memory: "32Gi"},
+				{Name: "MEM", CPU: "4", Memory: "64Gi"},
+			},
+			container:    newSizedContainer("4", "48Gi"),
+			expectedSize: "MEM",
+		},
+		{
+			description: "rejects the resources no size of the catalogue fits",
+			policy:      config.InstanceSizePolicyRejectIfOversize,
+			sizes: []config.InstanceSize{
+				{Name: "SP-5", CPU: "8", Memory: "32Gi"},
+				{Name: "MEM", CPU: "4", Memory: "64Gi"},
+			},
+			container:     newSizedContainer("8", "48Gi"),
+			expectedError: "the resources of the container app (8 CPU, 48Gi memory) exceed the largest instance size SP-5 (8 CPU, 32Gi memory)",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatal("failed to create the test provider", err)
+			}
+			provider.apiConfig.InstanceSizePolicy = c.policy
+			if c.sizes != nil {
+				provider.apiConfig.InstanceSizes = c.sizes
+			}
+
+			selection, err := provider.getInstanceSizeFrom(c.container)
+			if c.expectedError != "" {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedSize, selection.size.Name)
+		})
+	}
+}
+
+func TestRecordInstanceSizes(t *testing.T) {
+	ctx := context.Background()
+
+	newPod := func(container *v1.Container) *v1.Pod {
+		container.Command = []string{"app"}
+		return createTestPodWithContainers(nil, *container)
+	}
+
+	t.Run("allocates the containers exceeding the largest size with it and reports them once", func(t *testing.T) {
+		mockController := gomock.NewController(t)
+		wsc := mocks.NewWorkloadsClientService(mockController)
+		provider, err := createTestProvider(ctx, nil, nil, nil, &workload_client.EdgeCompute{Workloads: wsc})
+		if err != nil {
+			t.Fatal("failed to create the test provider", err)
+		}
+
+		pod := newPod(newSizedContainer("16", "3Gi"))
+		live, err := provider.getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+		assert.Equal(t, "8", live.Spec.Containers["app"].Resources.Limits["cpu"])
+		assert.Equal(t, "32Gi", live.Spec.Containers["app"].Resources.Limits["memory"])
+		live.Status = workload_models.V1WorkloadStatusACTIVE.Pointer()
+
+		// the event is recorded when the pod is created, and not again when its workload is updated
+		wsc.EXPECT().CreateWorkload(gomock.Any(), nil).Return(nil, nil).Times(1)
+		wsc.EXPECT().GetWorkload(gomock.Any(), nil).Return(&workloads.GetWorkloadOK{Payload: &workload_models.V1GetWorkloadResponse{Workload: live}}, nil).Times(1)
+		assert.NoError(t, provider.CreatePod(ctx, pod))
+		assert.NoError(t, provider.UpdatePod(ctx, pod))
+
+		events := provider.eventRecorder.(*record.FakeRecorder).Events
+		assert.Len(t, events, 1)
+		assert.Equal(t, "Warning InstanceSizeExceeded the resources of the container app (16 CPU, 3Gi memory) exceed the largest instance size, it's allocated with the instance size SP-5 (8 CPU, 32Gi memory)", <-events)
+	})
+
+	t.Run("reports the containers rejected by the policy", func(t *testing.T) {
+		provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatal("failed to create the test provider", err)
+		}
+		provider.apiConfig.InstanceSizePolicy = config.InstanceSizePolicyRejectIfOversize
+
+		err = provider.CreatePod(ctx, newPod(newSizedContainer("16", "3Gi")))
+		assert.Error(t, err)
+
+		events := provider.eventRecorder.(*record.FakeRecorder).Events
+		assert.Len(t, events, 1)
+		assert.Equal(t, "Warning InstanceSizeExceeded "+err.Error(), <-events)
+	})
+
+	t.Run("reports the containers whose ratio doesn't match their size", func(t *testing.T) {
+		provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatal("failed to create the test provider", err)
+		}
+		provider.apiConfig.InstanceSizePolicy = config.InstanceSizePolicyFailIfRatioMismatch
+
+		provider.recordInstanceSizes(newPod(newSizedContainer("4", "1Gi")))
+
+		events := provider.eventRecorder.(*record.FakeRecorder).Events
+		assert.Len(t, events, 1)
+		assert.Contains(t, <-events, "Warning InstanceSizeRatioMismatch the memory to CPU ratio of the container app")
+	})
+}
+
+func TestAnnotateInstanceSizes(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "test-ns", Annotations: map[string]string{"team": "edge"}}}
+	pod.Spec.InitContainers = []v1.Container{{Name: "migrate", Image: "migrate:latest"}}
+	pod.Spec.Containers = []v1.Container{*newSizedContainer("2", "8Gi")}
+
+	client := fake.NewSimpleClientset(pod)
+	provider.podsClient = client.CoreV1()
+
+	provider.annotateInstanceSizes(ctx, pod)
+
+	annotated, err := client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"team":                                   "edge",
+		"instance-size.vk.stackpath.com/migrate": "SP-1",
+		"instance-size.vk.stackpath.com/app":     "SP-3",
+	}, annotated.Annotations)
+
+	// the pod isn't patched again once annotated
+	client.ClearActions()
+	provider.annotateInstanceSizes(ctx, annotated)
+	assert.Empty(t, client.Actions())
+}
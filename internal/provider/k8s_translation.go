@@ -2,6 +2,8 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
@@ -29,10 +31,13 @@ func (p *StackpathProvider) getK8SPodStatusFrom(ctx context.Context, instance *w
 			ImageID:      "",
 			ContainerID:  instance.ContainerStatuses[i].ContainerID,
 		}
-		containerStatuses = append(containerStatuses, s)
 		if !s.Ready {
 			isAllReady = false
 		}
+		if sidecarContainerNames[s.Name] {
+			continue
+		}
+		containerStatuses = append(containerStatuses, s)
 	}
 
 	podIPs := make([]v1.PodIP, 0)
@@ -140,3 +145,50 @@ func getPodPhaseFromInstancePhase(state string) v1.PodPhase {
 
 	return v1.PodUnknown
 }
+
+// setPodStatus adjusts the status translated from the instances of the pod to what the provider changed in its
+// workload: the rollout of its images, its init containers, its restart policy and the translation of its gRPC probes
+func setPodStatus(pod *v1.Pod, status *v1.PodStatus, initGateImage, grpcProbeStrategy string) {
+	setRolloutStatus(pod, status)
+	setInitContainerStatus(pod, status)
+	setRestartPolicyStatus(pod, status, initGateImage)
+	setGRPCProbeStatus(pod, status, grpcProbeStrategy)
+}
+
+// setRolloutStatus marks the pod as not ready while the instance still runs
+// containers whose image differs from the one in the pod's spec, which is the case
+// until StackPath has rolled out an update of the pod's workload.
+func setRolloutStatus(pod *v1.Pod, status *v1.PodStatus) {
+	containers := getLongRunningContainers(pod)
+	images := make(map[string]string, len(containers))
+	for _, container := range containers {
+		images[container.Name] = container.Image
+	}
+
+	outdated := []string{}
+	for i := range status.ContainerStatuses {
+		containerStatus := &status.ContainerStatuses[i]
+		image, ok := images[containerStatus.Name]
+		if !ok || containerStatus.Image == "" || containerStatus.Image == image {
+			continue
+		}
+		containerStatus.Ready = false
+		outdated = append(outdated, containerStatus.Name)
+	}
+
+	if len(outdated) == 0 {
+		return
+	}
+
+	for i := range status.Conditions {
+		if status.Conditions[i].Type != v1.PodReady {
+			continue
+		}
+		if status.Conditions[i].Status == v1.ConditionTrue {
+			status.Conditions[i].LastTransitionTime = metav1.Now()
+		}
+		status.Conditions[i].Status = v1.ConditionFalse
+		status.Conditions[i].Reason = "RolloutInProgress"
+		status.Conditions[i].Message = fmt.Sprintf("updating the image of the container(s) %s", strings.Join(outdated, ", "))
+	}
+}
@@ -150,3 +150,56 @@ func TestGetK8SPodStatusFrom(t *testing.T) {
 		})
 	}
 }
+
+func TestSetRolloutStatus(t *testing.T) {
+	pod := &v1.Pod{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "app", Image: "app:v2"}, {Name: "sidecar", Image: "sidecar:v1"}},
+		},
+	}
+
+	var testCases = []struct {
+		description          string
+		containerImages      map[string]string
+		expectedReady        v1.ConditionStatus
+		expectedReason       string
+		expectedReadyByImage map[string]bool
+	}{
+		{
+			description:          "keeps the pod ready when the instance runs the images of the pod",
+			containerImages:      map[string]string{"app": "app:v2", "sidecar": "sidecar:v1"},
+			expectedReady:        v1.ConditionTrue,
+			expectedReadyByImage: map[string]bool{"app": true, "sidecar": true},
+		},
+		{
+			description:          "marks the pod as not ready while an image is being rolled out",
+			containerImages:      map[string]string{"app": "app:v1", "sidecar": "sidecar:v1"},
+			expectedReady:        v1.ConditionFalse,
+			expectedReason:       "RolloutInProgress",
+			expectedReadyByImage: map[string]bool{"app": false, "sidecar": true},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			status := &v1.PodStatus{
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+			}
+			for _, container := range pod.Spec.Containers {
+				status.ContainerStatuses = append(status.ContainerStatuses, v1.ContainerStatus{
+					Name:  container.Name,
+					Image: c.containerImages[container.Name],
+					Ready: true,
+				})
+			}
+
+			setRolloutStatus(pod, status)
+
+			assert.Equal(t, c.expectedReady, status.Conditions[0].Status)
+			assert.Equal(t, c.expectedReason, status.Conditions[0].Reason)
+			for _, containerStatus := range status.ContainerStatuses {
+				assert.Equal(t, c.expectedReadyByImage[containerStatus.Name], containerStatus.Ready)
+			}
+		})
+	}
+}
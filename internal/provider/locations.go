@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// The labels of the virtual node describing the StackPath location it runs in, set along with
+	// the well-known topology.kubernetes.io/region and topology.kubernetes.io/zone labels
+	continentLabelKey   = "location.vk.stackpath.com/continent"
+	countryLabelKey     = "location.vk.stackpath.com/country"
+	subdivisionLabelKey = "location.vk.stackpath.com/subdivision"
+	cityCodeLabelKey    = "location.vk.stackpath.com/city-code"
+)
+
+// SetLocation sets the StackPath location of the provider's city code from the catalogue of the locations, whose
+// topology the virtual node is labeled with. It fails when the city code isn't one of the locations of the catalogue.
+func (p *StackpathProvider) SetLocation(locations []*workload_models.Workloadv1Location) error {
+	location := config.FindLocation(locations, p.apiConfig.CityCode)
+	if location == nil {
+		return fmt.Errorf("the city code %s is not a StackPath location workloads can be created in", p.apiConfig.CityCode)
+	}
+	p.location = location
+	p.locations = locations
+	return nil
+}
+
+// getLocationLabels returns the topology labels of the virtual node running in the location. The region is the
+// StackPath region of the location and the zone is its city code, since each city code is a single location.
+// The fields of the location which aren't valid label values are left out.
+func getLocationLabels(ctx context.Context, location *workload_models.Workloadv1Location) map[string]string {
+	fields := map[string]string{
+		v1.LabelTopologyRegion: location.RegionCode,
+		v1.LabelTopologyZone:   location.CityCode,
+		continentLabelKey:      location.ContinentCode,
+		countryLabelKey:        location.CountryCode,
+		subdivisionLabelKey:    location.SubdivisionCode,
+		cityCodeLabelKey:       location.CityCode,
+	}
+
+	labels := map[string]string{}
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			log.G(ctx).Warnf("the node isn't labeled with %s, %q is not a valid label value", key, value)
+			continue
+		}
+		labels[key] = value
+	}
+	return labels
+}
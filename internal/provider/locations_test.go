@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSetLocation(t *testing.T) {
+	ctx := context.Background()
+
+	locations := []*workload_models.Workloadv1Location{
+		{City: "Dallas", CityCode: "DFW", Continent: "North America", ContinentCode: "NA", Country: "United States", CountryCode: "US", RegionCode: "us-central", SubdivisionCode: "TX"},
+		{City: "New York", CityCode: "JFK", Continent: "North America", ContinentCode: "NA", Country: "United States", CountryCode: "US", RegionCode: "us-east", SubdivisionCode: "NY"},
+	}
+
+	newProvider := func(t *testing.T) *StackpathProvider {
+		provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatal("failed to create the test provider", err)
+		}
+		return provider
+	}
+
+	t.Run("labels the node with the topology of its location", func(t *testing.T) {
+		provider := newProvider(t)
+		assert.NoError(t, provider.SetLocation(locations))
+
+		node := v1.Node{}
+		node.Labels = map[string]string{"type": "virtual-kubelet"}
+		provider.ConfigureNode(ctx, &node)
+		assert.Equal(t, map[string]string{
+			"type":                                  "virtual-kubelet",
+			"topology.kubernetes.io/region":         "us-east",
+			"topology.kubernetes.io/zone":           "JFK",
+			"location.vk.stackpath.com/continent":   "NA",
+			"location.vk.stackpath.com/country":     "US",
+			"location.vk.stackpath.com/subdivision": "NY",
+			"location.vk.stackpath.com/city-code":   "JFK",
+		}, node.Labels)
+	})
+
+	t.Run("leaves out the fields which aren't valid label values", func(t *testing.T) {
+		provider := newProvider(t)
+		assert.NoError(t, provider.SetLocation([]*workload_models.Workloadv1Location{{CityCode: "JFK", RegionCode: "us east"}}))
+
+		node := v1.Node{}
+		provider.ConfigureNode(ctx, &node)
+		assert.Equal(t, map[string]string{
+			"topology.kubernetes.io/zone":         "JFK",
+			"location.vk.stackpath.com/city-code": "JFK",
+		}, node.Labels)
+	})
+
+	t.Run("fails when the city code is not a location", func(t *testing.T) {
+		provider := newProvider(t)
+		assert.EqualError(t, provider.SetLocation(locations[:1]), "the city code JFK is not a StackPath location workloads can be created in")
+	})
+}
@@ -0,0 +1,318 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance_logs"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+)
+
+// Define the interval between attempts to reconnect a dropped log stream and
+// how many attempts in a row can fail before following the logs is given up
+var logStreamReconnectInterval = 1 * time.Second
+var logStreamMaxReconnectAttempts = 5
+
+// Define how long before the last streamed line a dropped log stream is resumed from, so the lines logged at
+// the same time aren't missed whatever the precision of the since time, the lines streamed already are skipped
+var logStreamResumeOverlap = 1 * time.Second
+
+// errLogLimitReached stops following the logs once the requested number of bytes was streamed
+var errLogLimitReached = errors.New("the log limit was reached")
+
+// logStreamFrame models a single frame of a GetLogs response. The StackPath API
+// streams log chunks as newline-delimited JSON objects, each wrapping a log chunk
+// in a "result" envelope or reporting a failure in an "error" envelope.
+// A bare log chunk is accepted as well.
+type logStreamFrame struct {
+	Result *workload_models.V1LogChunk         `json:"result,omitempty"`
+	Error  *workload_models.StackpathapiStatus `json:"error,omitempty"`
+	Bytes  strfmt.Base64                       `json:"bytes,omitempty"`
+}
+
+// logStreamReader reads a GetLogs response frame by frame and writes the
+// decoded log bytes to the underlying writer.
+type logStreamReader struct {
+	out io.Writer
+}
+
+// ReadResponse implements the runtime.ClientResponseReader interface. Error
+// responses are delegated to the generated GetLogs reader so they are reported
+// the same way as any other StackPath API error.
+func (r *logStreamReader) ReadResponse(response runtime.ClientResponse, consumer runtime.Consumer) (interface{}, error) {
+	if response.Code()/100 != 2 {
+		return (&instance_logs.GetLogsReader{}).ReadResponse(response, consumer)
+	}
+
+	decoder := json.NewDecoder(response.Body())
+	for {
+		var frame logStreamFrame
+		if err := decoder.Decode(&frame); err != nil {
+			if err == io.EOF {
+				return instance_logs.NewGetLogsOK(), nil
+			}
+			return nil, err
+		}
+
+		if frame.Error != nil {
+			return nil, &APIError{
+				statusCode: HTTPStatusFromCode(frame.Error.Code),
+				message:    frame.Error.Message,
+			}
+		}
+
+		chunk := frame.Bytes
+		if frame.Result != nil {
+			chunk = frame.Result.Bytes
+		}
+		if _, err := r.out.Write(chunk); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// withLogStreamReader replaces the generated GetLogs response reader, which
+// only decodes the first log chunk, with one that decodes the entire stream.
+func withLogStreamReader(out io.Writer) instance_logs.ClientOption {
+	return func(op *runtime.ClientOperation) {
+		op.Reader = &logStreamReader{out: out}
+	}
+}
+
+func (p *StackpathProvider) getContainerLogs(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
+	instance, err := p.getPodInstance(ctx, namespace, podName)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, errdefs.NotFoundf("pod %s/%s is not found", namespace, podName)
+		}
+		return nil, err
+	}
+
+	if _, ok := instance.Containers[containerName]; !ok {
+		return nil, errdefs.NotFoundf("container %s is not found in pod %s/%s", containerName, namespace, podName)
+	}
+
+	params := p.getLogsParamsFrom(ctx, namespace, podName, instance.Name, containerName, opts)
+
+	if opts.Follow {
+		return p.followContainerLogs(ctx, params, opts), nil
+	}
+
+	logs := &bytes.Buffer{}
+	_, err = p.stackpathClient.InstanceLogs.GetLogs(params, nil, withLogStreamReader(logs))
+	if err != nil {
+		return nil, NewStackPathError(err)
+	}
+
+	return io.NopCloser(logs), nil
+}
+
+// getLogsParamsFrom maps the Kubernetes container log options onto the StackPath GetLogs parameters of the instance.
+// Options that are left at their zero value are not sent, so the API defaults apply.
+func (p *StackpathProvider) getLogsParamsFrom(ctx context.Context, namespace, podName, instanceName, containerName string, opts api.ContainerLogOpts) *instance_logs.GetLogsParams {
+	params := &instance_logs.GetLogsParams{
+		Context:       ctx,
+		StackID:       p.apiConfig.StackID,
+		WorkloadID:    p.getWorkloadSlug(namespace, podName),
+		InstanceName:  instanceName,
+		ContainerName: &containerName,
+		Timestamps:    &opts.Timestamps,
+		Previous:      &opts.Previous,
+		Follow:        &opts.Follow,
+	}
+
+	if opts.Tail > 0 {
+		tailLines := strconv.Itoa(opts.Tail)
+		params.TailLines = &tailLines
+	}
+
+	if opts.LimitBytes > 0 {
+		limitBytes := strconv.Itoa(opts.LimitBytes)
+		params.LimitBytes = &limitBytes
+	}
+
+	// Only one of since_seconds or since_time may be specified
+	if opts.SinceSeconds > 0 {
+		sinceSeconds := strconv.Itoa(opts.SinceSeconds)
+		params.SinceSeconds = &sinceSeconds
+	} else if !opts.SinceTime.IsZero() {
+		sinceTime := strfmt.DateTime(opts.SinceTime)
+		params.SinceTime = &sinceTime
+	}
+
+	return params
+}
+
+// followContainerLogs streams the logs of a container through a pipe until the context is cancelled or the returned
+// reader is closed. StackPath is asked for the timestamps of the lines, which are removed unless they were requested,
+// so if the stream drops while following it's reopened from the timestamp of the last line streamed, skipping the
+// lines streamed already. The byte limit is enforced on the streamed lines, since StackPath would count the timestamps.
+func (p *StackpathProvider) followContainerLogs(ctx context.Context, params *instance_logs.GetLogsParams, opts api.ContainerLogOpts) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	timestamps := true
+	params.Timestamps = &timestamps
+	params.LimitBytes = nil
+
+	go func() {
+		out := &logStreamWriter{out: writer, timestamps: opts.Timestamps, limitBytes: opts.LimitBytes}
+		attempts := 0
+
+		for {
+			_, err := p.stackpathClient.InstanceLogs.GetLogs(params, nil, withLogStreamReader(out))
+			if ctx.Err() != nil || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, errLogLimitReached) {
+				// The client went away or got every byte it asked for, there is nothing left to stream
+				writer.Close()
+				return
+			}
+			if err != nil {
+				err = NewStackPathError(err)
+				if errdefs.IsNotFound(err) {
+					writer.CloseWithError(err)
+					return
+				}
+			}
+
+			if out.receivedSinceReconnect {
+				attempts = 0
+			}
+			attempts++
+			if attempts > logStreamMaxReconnectAttempts {
+				if err == nil {
+					err = errors.New("the log stream was closed by StackPath")
+				}
+				writer.CloseWithError(err)
+				return
+			}
+
+			log.G(ctx).WithError(err).Debugf("log stream of the instance %s dropped, reconnecting", params.InstanceName)
+
+			if resumeAt, ok := out.resume(); ok {
+				// Resume from the last streamed line instead of replaying the requested history
+				sinceTime := strfmt.DateTime(resumeAt)
+				params.SinceTime = &sinceTime
+				params.SinceSeconds = nil
+				params.TailLines = nil
+			}
+
+			select {
+			case <-ctx.Done():
+				writer.Close()
+				return
+			case <-time.After(logStreamReconnectInterval):
+			}
+		}
+	}()
+
+	return reader
+}
+
+// logStreamWriter streams the logs line by line and keeps track of what has been streamed so far, so a dropped
+// log stream can be resumed where it left off. The lines are prefixed with their RFC 3339 timestamp, which is
+// removed unless timestamps are streamed; the lines without timestamp are streamed as is.
+type logStreamWriter struct {
+	out        io.Writer
+	timestamps bool
+	limitBytes int
+	written    int
+	// the incomplete last line of the stream, which is streamed once complete
+	pending bytes.Buffer
+	// the timestamp of the last streamed line and the number of lines streamed with that timestamp
+	lastTimestamp        time.Time
+	linesAtLastTimestamp int
+	// whether the stream is resumed, and how many lines with the last timestamp it replays before the new lines
+	resuming               bool
+	skip                   int
+	receivedSinceReconnect bool
+}
+
+// Write implements the io.Writer interface.
+func (w *logStreamWriter) Write(chunk []byte) (int, error) {
+	if len(chunk) > 0 {
+		w.receivedSinceReconnect = true
+	}
+	w.pending.Write(chunk)
+	for {
+		end := bytes.IndexByte(w.pending.Bytes(), '\n')
+		if end < 0 {
+			return len(chunk), nil
+		}
+		if err := w.writeLine(w.pending.Next(end + 1)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// writeLine streams a complete line, unless it was streamed before the stream was resumed
+func (w *logStreamWriter) writeLine(line []byte) error {
+	if timestamp, message, ok := parseLogTimestamp(line); ok {
+		if w.resuming {
+			switch {
+			case timestamp.Before(w.lastTimestamp):
+				return nil
+			case timestamp.Equal(w.lastTimestamp) && w.skip > 0:
+				w.skip--
+				return nil
+			}
+			w.resuming = false
+		}
+		if timestamp.Equal(w.lastTimestamp) {
+			w.linesAtLastTimestamp++
+		} else {
+			w.lastTimestamp = timestamp
+			w.linesAtLastTimestamp = 1
+		}
+		if !w.timestamps {
+			line = message
+		}
+	}
+
+	if w.limitBytes > 0 && w.written+len(line) > w.limitBytes {
+		line = line[:w.limitBytes-w.written]
+	}
+	n, err := w.out.Write(line)
+	w.written += n
+	if err != nil {
+		return err
+	}
+	if w.limitBytes > 0 && w.written >= w.limitBytes {
+		return errLogLimitReached
+	}
+	return nil
+}
+
+// resume prepares the writer for the reopened stream, and returns the time it's reopened from,
+// if a line with a timestamp was streamed. The incomplete last line is replayed by the reopened stream.
+func (w *logStreamWriter) resume() (time.Time, bool) {
+	w.pending.Reset()
+	w.receivedSinceReconnect = false
+	if w.lastTimestamp.IsZero() {
+		return time.Time{}, false
+	}
+	w.resuming = true
+	w.skip = w.linesAtLastTimestamp
+	return w.lastTimestamp.Add(-logStreamResumeOverlap), true
+}
+
+// parseLogTimestamp splits a log line into its timestamp and its message
+func parseLogTimestamp(line []byte) (time.Time, []byte, bool) {
+	end := bytes.IndexByte(line, ' ')
+	if end < 0 {
+		return time.Time{}, nil, false
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, string(line[:end]))
+	if err != nil {
+		return time.Time{}, nil, false
+	}
+	return timestamp, line[end+1:], true
+}
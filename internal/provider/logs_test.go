@@ -0,0 +1,420 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance_logs"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+)
+
+// fakeClientResponse is a minimal runtime.ClientResponse used to feed a raw
+// response body to the custom response readers.
+type fakeClientResponse struct {
+	code int
+	body string
+}
+
+func (r *fakeClientResponse) Code() int                  { return r.code }
+func (r *fakeClientResponse) Message() string            { return http.StatusText(r.code) }
+func (r *fakeClientResponse) GetHeader(string) string    { return "" }
+func (r *fakeClientResponse) GetHeaders(string) []string { return nil }
+func (r *fakeClientResponse) Body() io.ReadCloser        { return io.NopCloser(strings.NewReader(r.body)) }
+
+// respondWithLogStream returns a function that can be used with gomock's DoAndReturn
+// to simulate the StackPath API streaming the provided body.
+func respondWithLogStream(code int, body string) func(*instance_logs.GetLogsParams, runtime.ClientAuthInfoWriter, ...instance_logs.ClientOption) (*instance_logs.GetLogsOK, error) {
+	return func(params *instance_logs.GetLogsParams, _ runtime.ClientAuthInfoWriter, opts ...instance_logs.ClientOption) (*instance_logs.GetLogsOK, error) {
+		op := &runtime.ClientOperation{Reader: &instance_logs.GetLogsReader{}}
+		for _, opt := range opts {
+			opt(op)
+		}
+		result, err := op.Reader.ReadResponse(&fakeClientResponse{code: code, body: body}, runtime.JSONConsumer())
+		if err != nil {
+			return nil, err
+		}
+		return result.(*instance_logs.GetLogsOK), nil
+	}
+}
+
+// newLogStreamBody returns a GetLogs response streaming each chunk in a frame
+func newLogStreamBody(chunks ...string) string {
+	body := ""
+	for _, chunk := range chunks {
+		body += fmt.Sprintf(`{"result":{"bytes":"%s"}}`, base64.StdEncoding.EncodeToString([]byte(chunk))) + "\n"
+	}
+	return body
+}
+
+func TestGetContainerLogs(t *testing.T) {
+	podName := "test-pod"
+	podNamespace := "test-ns"
+	containerName := "nginx"
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	ctx := context.Background()
+
+	isc := mocks.NewInstanceClientService(mockController)
+	ilc := mocks.NewInstanceLogsClientService(mockController)
+	stackPathClientMock := workload_client.EdgeCompute{Instance: isc, InstanceLogs: ilc}
+
+	provider, err := createTestProvider(ctx, mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), createTestPodLister(mockController, createTestPod(podName, podNamespace)), &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	instanceResponse := &instance.GetWorkloadInstanceOK{
+		Payload: &workload_models.V1GetWorkloadInstanceResponse{
+			Instance: &workload_models.Workloadv1Instance{
+				Name:       provider.getInstanceName(podNamespace, podName),
+				Phase:      workload_models.Workloadv1InstanceInstancePhaseRUNNING.Pointer(),
+				Containers: workload_models.V1ContainerSpecMapEntry{containerName: createTestContainerSpec()},
+			},
+		},
+	}
+
+	testCases := []struct {
+		description     string
+		containerName   string
+		initMockedCalls func()
+		expectedLogs    string
+		expectedError   error
+		isNotFound      bool
+	}{
+		{
+			description:   "successfully decodes a stream of log chunks",
+			containerName: containerName,
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+				ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(respondWithLogStream(http.StatusOK,
+					`{"result":{"bytes":"bGluZSAxCg=="}}`+"\n"+`{"result":{"bytes":"bGluZSAyCg=="}}`+"\n",
+				)).Times(1)
+			},
+			expectedLogs: "line 1\nline 2\n",
+		},
+		{
+			description:   "successfully decodes bare log chunks",
+			containerName: containerName,
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+				ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(respondWithLogStream(http.StatusOK,
+					`{"bytes":"bGluZSAxCg=="}`,
+				)).Times(1)
+			},
+			expectedLogs: "line 1\n",
+		},
+		{
+			description:   "returns an empty stream when there are no logs",
+			containerName: containerName,
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+				ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(respondWithLogStream(http.StatusOK, "")).Times(1)
+			},
+			expectedLogs: "",
+		},
+		{
+			description:   "fails when the stream reports an error",
+			containerName: containerName,
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+				ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(respondWithLogStream(http.StatusOK,
+					`{"result":{"bytes":"bGluZSAxCg=="}}`+"\n"+`{"error":{"code":13,"message":"internal error"}}`,
+				)).Times(1)
+			},
+			expectedError: errors.New("a 500 error was returned from StackPath: \"internal error\""),
+		},
+		{
+			description:   "fails with not found when the pod doesn't exist",
+			containerName: containerName,
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(nil, &APIError{statusCode: http.StatusNotFound, message: "not found"}).Times(1)
+			},
+			expectedError: errors.New("pod test-ns/test-pod is not found"),
+			isNotFound:    true,
+		},
+		{
+			description:   "fails with not found when the container doesn't exist",
+			containerName: "unknown",
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+			},
+			expectedError: errors.New("container unknown is not found in pod test-ns/test-pod"),
+			isNotFound:    true,
+		},
+		{
+			description:   "fails when the logs API call fails",
+			containerName: containerName,
+			initMockedCalls: func() {
+				isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+				ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).Return(nil, errors.New("API error")).Times(1)
+			},
+			expectedError: errors.New("API error"),
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			c.initMockedCalls()
+
+			logs, err := provider.GetContainerLogs(ctx, podNamespace, podName, c.containerName, api.ContainerLogOpts{})
+			if c.expectedError != nil {
+				assert.EqualError(t, err, c.expectedError.Error())
+				assert.Equal(t, c.isNotFound, errdefs.IsNotFound(err))
+				return
+			}
+
+			assert.NoError(t, err)
+			data, err := io.ReadAll(logs)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedLogs, string(data))
+		})
+	}
+}
+
+func TestFollowContainerLogs(t *testing.T) {
+	podName := "test-pod"
+	podNamespace := "test-ns"
+	containerName := "nginx"
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	isc := mocks.NewInstanceClientService(mockController)
+	ilc := mocks.NewInstanceLogsClientService(mockController)
+	stackPathClientMock := workload_client.EdgeCompute{Instance: isc, InstanceLogs: ilc}
+
+	provider, err := createTestProvider(context.Background(), mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), createTestPodLister(mockController, createTestPod(podName, podNamespace)), &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	defaultReconnectInterval := logStreamReconnectInterval
+	logStreamReconnectInterval = time.Millisecond
+	defer func() { logStreamReconnectInterval = defaultReconnectInterval }()
+
+	instanceResponse := &instance.GetWorkloadInstanceOK{
+		Payload: &workload_models.V1GetWorkloadInstanceResponse{
+			Instance: &workload_models.Workloadv1Instance{
+				Name:       provider.getInstanceName(podNamespace, podName),
+				Phase:      workload_models.Workloadv1InstanceInstancePhaseRUNNING.Pointer(),
+				Containers: workload_models.V1ContainerSpecMapEntry{containerName: createTestContainerSpec()},
+			},
+		},
+	}
+
+	t.Run("resumes a dropped stream from its last line and stops when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+		gomock.InOrder(
+			ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(
+				func(params *instance_logs.GetLogsParams, authInfo runtime.ClientAuthInfoWriter, opts ...instance_logs.ClientOption) (*instance_logs.GetLogsOK, error) {
+					assert.True(t, *params.Follow)
+					assert.True(t, *params.Timestamps)
+					assert.Equal(t, "10", *params.TailLines)
+					assert.Nil(t, params.SinceTime)
+					// the stream drops in the middle of the third line
+					_, err := respondWithLogStream(http.StatusOK, newLogStreamBody(
+						"2023-05-01T10:00:01.000000001Z line 1\n",
+						"2023-05-01T10:00:02Z line 2\n",
+						"2023-05-01T10:00:02Z li",
+					))(params, authInfo, opts...)
+					assert.NoError(t, err)
+					return nil, io.ErrUnexpectedEOF
+				},
+			).Times(1),
+			ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(
+				func(params *instance_logs.GetLogsParams, authInfo runtime.ClientAuthInfoWriter, opts ...instance_logs.ClientOption) (*instance_logs.GetLogsOK, error) {
+					assert.Nil(t, params.TailLines)
+					assert.True(t, time.Date(2023, 5, 1, 10, 0, 1, 0, time.UTC).Equal(time.Time(*params.SinceTime)))
+					// the lines since the last one streamed are replayed
+					_, err := respondWithLogStream(http.StatusOK, newLogStreamBody(
+						"2023-05-01T10:00:01.000000001Z line 1\n",
+						"2023-05-01T10:00:02Z line 2\n",
+						"2023-05-01T10:00:02Z line 3\n",
+						"2023-05-01T10:00:03Z line 4\n",
+					))(params, authInfo, opts...)
+					assert.NoError(t, err)
+					cancel()
+					return nil, context.Canceled
+				},
+			).Times(1),
+		)
+
+		logs, err := provider.GetContainerLogs(ctx, podNamespace, podName, containerName, api.ContainerLogOpts{Follow: true, Tail: 10})
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(logs)
+		assert.NoError(t, err)
+		assert.Equal(t, "line 1\nline 2\nline 3\nline 4\n", string(data))
+	})
+
+	t.Run("streams the timestamps when requested", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+		ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(
+			func(params *instance_logs.GetLogsParams, authInfo runtime.ClientAuthInfoWriter, opts ...instance_logs.ClientOption) (*instance_logs.GetLogsOK, error) {
+				_, err := respondWithLogStream(http.StatusOK, newLogStreamBody("2023-05-01T10:00:01Z line 1\n"))(params, authInfo, opts...)
+				assert.NoError(t, err)
+				cancel()
+				return nil, context.Canceled
+			},
+		).Times(1)
+
+		logs, err := provider.GetContainerLogs(ctx, podNamespace, podName, containerName, api.ContainerLogOpts{Follow: true, Timestamps: true})
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(logs)
+		assert.NoError(t, err)
+		assert.Equal(t, "2023-05-01T10:00:01Z line 1\n", string(data))
+	})
+
+	t.Run("stops following once the byte limit is reached", func(t *testing.T) {
+		ctx := context.Background()
+
+		isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+		ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(
+			func(params *instance_logs.GetLogsParams, authInfo runtime.ClientAuthInfoWriter, opts ...instance_logs.ClientOption) (*instance_logs.GetLogsOK, error) {
+				// the limit applies to the lines without their timestamp, which StackPath would count
+				assert.Nil(t, params.LimitBytes)
+				return respondWithLogStream(http.StatusOK, newLogStreamBody("2023-05-01T10:00:01Z line 1\n", "2023-05-01T10:00:02Z line 2\n"))(params, authInfo, opts...)
+			},
+		).Times(1)
+
+		logs, err := provider.GetContainerLogs(ctx, podNamespace, podName, containerName, api.ContainerLogOpts{Follow: true, LimitBytes: 9})
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(logs)
+		assert.NoError(t, err)
+		assert.Equal(t, "line 1\nli", string(data))
+	})
+
+	t.Run("gives up after too many failed reconnection attempts", func(t *testing.T) {
+		ctx := context.Background()
+
+		isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+		ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).Return(nil, errors.New("connection reset")).Times(logStreamMaxReconnectAttempts + 1)
+
+		logs, err := provider.GetContainerLogs(ctx, podNamespace, podName, containerName, api.ContainerLogOpts{Follow: true})
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(logs)
+		assert.EqualError(t, err, "connection reset")
+	})
+
+	t.Run("stops following when the workload is deleted", func(t *testing.T) {
+		ctx := context.Background()
+
+		isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+		ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).Return(nil, &APIError{statusCode: http.StatusNotFound, message: "not found"}).Times(1)
+
+		logs, err := provider.GetContainerLogs(ctx, podNamespace, podName, containerName, api.ContainerLogOpts{Follow: true})
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(logs)
+		assert.True(t, errdefs.IsNotFound(err))
+	})
+
+	t.Run("stops following when the reader is closed", func(t *testing.T) {
+		ctx := context.Background()
+		done := make(chan struct{})
+
+		isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(instanceResponse, nil).Times(1)
+		ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(
+			func(params *instance_logs.GetLogsParams, authInfo runtime.ClientAuthInfoWriter, opts ...instance_logs.ClientOption) (*instance_logs.GetLogsOK, error) {
+				defer close(done)
+				return respondWithLogStream(http.StatusOK, `{"result":{"bytes":"bGluZSAxCg=="}}`)(params, authInfo, opts...)
+			},
+		).Times(1)
+
+		logs, err := provider.GetContainerLogs(ctx, podNamespace, podName, containerName, api.ContainerLogOpts{Follow: true})
+		assert.NoError(t, err)
+		assert.NoError(t, logs.Close())
+
+		<-done
+	})
+}
+
+func TestGetLogsParams(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	sinceTime := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		description          string
+		opts                 api.ContainerLogOpts
+		expectedTailLines    *string
+		expectedLimitBytes   *string
+		expectedSinceSeconds *string
+		expectedSinceTime    *strfmt.DateTime
+		expectedTimestamps   bool
+		expectedPrevious     bool
+	}{
+		{
+			description: "zero options are not sent",
+			opts:        api.ContainerLogOpts{},
+		},
+		{
+			description:          "all options are mapped",
+			opts:                 api.ContainerLogOpts{Tail: 10, LimitBytes: 1024, SinceSeconds: 60, Timestamps: true, Previous: true, Follow: true},
+			expectedTailLines:    stringPtr("10"),
+			expectedLimitBytes:   stringPtr("1024"),
+			expectedSinceSeconds: stringPtr("60"),
+			expectedTimestamps:   true,
+			expectedPrevious:     true,
+		},
+		{
+			description:       "since time is used when since seconds is not set",
+			opts:              api.ContainerLogOpts{SinceTime: sinceTime},
+			expectedSinceTime: (*strfmt.DateTime)(&sinceTime),
+		},
+		{
+			description:          "since seconds wins over since time",
+			opts:                 api.ContainerLogOpts{SinceSeconds: 30, SinceTime: sinceTime},
+			expectedSinceSeconds: stringPtr("30"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			params := provider.getLogsParamsFrom(ctx, "test-ns", "test-pod", provider.getInstanceName("test-ns", "test-pod"), "nginx", test.opts)
+			assert.Equal(t, "nginx", *params.ContainerName)
+			assert.Equal(t, provider.getWorkloadSlug("test-ns", "test-pod"), params.WorkloadID)
+			assert.Equal(t, provider.getInstanceName("test-ns", "test-pod"), params.InstanceName)
+			assert.Equal(t, test.expectedTailLines, params.TailLines)
+			assert.Equal(t, test.expectedLimitBytes, params.LimitBytes)
+			assert.Equal(t, test.expectedSinceSeconds, params.SinceSeconds)
+			assert.Equal(t, test.expectedSinceTime, params.SinceTime)
+			assert.Equal(t, test.expectedTimestamps, *params.Timestamps)
+			assert.Equal(t, test.expectedPrevious, *params.Previous)
+			assert.Equal(t, test.opts.Follow, *params.Follow)
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
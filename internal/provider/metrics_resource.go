@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	stats "github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
+)
+
+// The metrics exposed on the /metrics/resource endpoint, named after the ones
+// exposed by the kubelet so metrics-server can scrape the virtual node as any other node
+const (
+	nodeCPUUsageMetric              = "node_cpu_usage_seconds_total"
+	nodeMemoryWorkingSetMetric      = "node_memory_working_set_bytes"
+	podCPUUsageMetric               = "pod_cpu_usage_seconds_total"
+	podMemoryWorkingSetMetric       = "pod_memory_working_set_bytes"
+	containerCPUUsageMetric         = "container_cpu_usage_seconds_total"
+	containerMemoryWorkingSetMetric = "container_memory_working_set_bytes"
+	containerStartTimeMetric        = "container_start_time_seconds"
+	scrapeErrorMetric               = "scrape_error"
+)
+
+// GetMetricsResource returns the resource usage of the node, its pods and their containers
+// in the Prometheus format served on the kubelet /metrics/resource endpoint.
+// The metrics are built from the stats summary, so both endpoints report the same samples.
+func (p *StackpathProvider) GetMetricsResource(ctx context.Context) ([]*dto.MetricFamily, error) {
+	p.logger.Debug("getting the resource metrics")
+
+	nodeCPU := newMetricFamily(nodeCPUUsageMetric, "Cumulative cpu time consumed by the node in core-seconds", dto.MetricType_COUNTER)
+	nodeMemory := newMetricFamily(nodeMemoryWorkingSetMetric, "Current working set of the node in bytes", dto.MetricType_GAUGE)
+	podCPU := newMetricFamily(podCPUUsageMetric, "Cumulative cpu time consumed by the pod in core-seconds", dto.MetricType_COUNTER)
+	podMemory := newMetricFamily(podMemoryWorkingSetMetric, "Current working set of the pod in bytes", dto.MetricType_GAUGE)
+	containerCPU := newMetricFamily(containerCPUUsageMetric, "Cumulative cpu time consumed by the container in core-seconds", dto.MetricType_COUNTER)
+	containerMemory := newMetricFamily(containerMemoryWorkingSetMetric, "Current working set of the container in bytes", dto.MetricType_GAUGE)
+	containerStartTime := newMetricFamily(containerStartTimeMetric, "Start time of the container since unix epoch in seconds", dto.MetricType_GAUGE)
+	scrapeError := newMetricFamily(scrapeErrorMetric, "1 if there was an error while getting container metrics, 0 otherwise", dto.MetricType_GAUGE)
+
+	families := []*dto.MetricFamily{nodeCPU, nodeMemory, podCPU, podMemory, containerCPU, containerMemory, containerStartTime, scrapeError}
+
+	summary, err := p.getStatsSummary(ctx)
+	if err != nil {
+		// Same as the kubelet, report the failure in the scrape_error metric rather than failing the scrape
+		log.G(ctx).WithError(err).Warn("couldn't get the stats summary for the resource metrics")
+		addGaugeMetric(scrapeError, 1, time.Time{})
+		return families, nil
+	}
+	addGaugeMetric(scrapeError, 0, time.Time{})
+
+	addCPUMetric(nodeCPU, summary.Node.CPU)
+	addMemoryMetric(nodeMemory, summary.Node.Memory)
+
+	for _, pod := range summary.Pods {
+		podLabels := []string{"namespace", pod.PodRef.Namespace, "pod", pod.PodRef.Name}
+		addCPUMetric(podCPU, pod.CPU, podLabels...)
+		addMemoryMetric(podMemory, pod.Memory, podLabels...)
+
+		for _, container := range pod.Containers {
+			containerLabels := append([]string{"container", container.Name}, podLabels...)
+			addCPUMetric(containerCPU, container.CPU, containerLabels...)
+			addMemoryMetric(containerMemory, container.Memory, containerLabels...)
+			if !container.StartTime.IsZero() {
+				addGaugeMetric(containerStartTime, float64(container.StartTime.Unix()), time.Time{}, containerLabels...)
+			}
+		}
+	}
+
+	return families, nil
+}
+
+func newMetricFamily(name, help string, metricType dto.MetricType) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: &name,
+		Help: &help,
+		Type: &metricType,
+	}
+}
+
+// addCPUMetric adds the cumulative CPU usage, in core-seconds, to the metric family.
+func addCPUMetric(family *dto.MetricFamily, cpu *stats.CPUStats, labels ...string) {
+	if cpu == nil || cpu.UsageCoreNanoSeconds == nil {
+		return
+	}
+	value := float64(*cpu.UsageCoreNanoSeconds) / float64(time.Second)
+	metric := newMetric(cpu.Time.Time, labels...)
+	metric.Counter = &dto.Counter{Value: &value}
+	family.Metric = append(family.Metric, metric)
+}
+
+// addMemoryMetric adds the memory working set, in bytes, to the metric family.
+func addMemoryMetric(family *dto.MetricFamily, memory *stats.MemoryStats, labels ...string) {
+	if memory == nil || memory.WorkingSetBytes == nil {
+		return
+	}
+	addGaugeMetric(family, float64(*memory.WorkingSetBytes), memory.Time.Time, labels...)
+}
+
+func addGaugeMetric(family *dto.MetricFamily, value float64, timestamp time.Time, labels ...string) {
+	metric := newMetric(timestamp, labels...)
+	metric.Gauge = &dto.Gauge{Value: &value}
+	family.Metric = append(family.Metric, metric)
+}
+
+// newMetric creates a metric with the labels given as name and value pairs,
+// timestamped with the time the sample was taken at unless it's zero.
+func newMetric(timestamp time.Time, labels ...string) *dto.Metric {
+	metric := &dto.Metric{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		name, value := labels[i], labels[i+1]
+		metric.Label = append(metric.Label, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	// The exposition format expects the labels sorted by name
+	sort.Slice(metric.Label, func(i, j int) bool {
+		return metric.Label[i].GetName() < metric.Label[j].GetName()
+	})
+	if !timestamp.IsZero() {
+		timestampMs := timestamp.UnixMilli()
+		metric.TimestampMs = &timestampMs
+	}
+	return metric
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetMetricsResource(t *testing.T) {
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	ctx := context.Background()
+
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	msc := mocks.NewMetricsClientService(mockController)
+	podLister := mocks.NewMockPodLister(mockController)
+	podNamespaceLister := mocks.NewMockPodNamespaceLister(mockController)
+	stackPathClientMock := workload_client.EdgeCompute{Workloads: wsc, Metrics: msc}
+
+	provider, err := createTestProvider(ctx, mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), podLister, &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	startTime := metav1.NewTime(time.Unix(1683000000, 0))
+	sampledAt := time.Unix(1683000060, 0)
+	pod := createTestPod("test-pod", "test-ns")
+	pod.Status.StartTime = &startTime
+
+	// scrapes the summary with a sample of the instance metrics, which is built again once the cache expires
+	scrape := func(sample string) {
+		provider.statsCache.summary = nil
+		wsc.EXPECT().GetWorkloads(gomock.Any(), nil).Return(createTestWorkloadsResponse(provider.nodeName, pod), nil).Times(1)
+		podLister.EXPECT().Pods(pod.Namespace).Return(podNamespaceLister).Times(1)
+		podNamespaceLister.EXPECT().Get(pod.Name).Return(pod, nil).Times(1)
+		msc.EXPECT().GetMetrics(gomock.Any(), nil).Return(createTestMetricsResponse("nginx", sample, "0.25", "1048576"), nil).Times(1)
+
+		_, err := provider.getStatsSummary(ctx)
+		assert.NoError(t, err)
+	}
+
+	getFamily := func(families []*dto.MetricFamily, name string) *dto.MetricFamily {
+		for _, family := range families {
+			if family.GetName() == name {
+				return family
+			}
+		}
+		t.Fatalf("metric family %s is missing", name)
+		return nil
+	}
+
+	getLabels := func(metric *dto.Metric) map[string]string {
+		labels := map[string]string{}
+		for _, label := range metric.Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		return labels
+	}
+
+	t.Run("exposes the node, pod and container metrics", func(t *testing.T) {
+		// a quarter of a core was used over the minute between the two samples
+		scrape("1683000000")
+		scrape("1683000060")
+
+		families, err := provider.GetMetricsResource(ctx)
+		assert.NoError(t, err)
+
+		nodeCPU := getFamily(families, nodeCPUUsageMetric)
+		assert.Equal(t, dto.MetricType_COUNTER, nodeCPU.GetType())
+		assert.Len(t, nodeCPU.Metric, 1)
+
+		nodeMemory := getFamily(families, nodeMemoryWorkingSetMetric)
+		assert.Equal(t, dto.MetricType_GAUGE, nodeMemory.GetType())
+		assert.Equal(t, 1048576.0, nodeMemory.Metric[0].GetGauge().GetValue())
+
+		podCPU := getFamily(families, podCPUUsageMetric)
+		assert.Len(t, podCPU.Metric, 1)
+		assert.Equal(t, map[string]string{"namespace": "test-ns", "pod": "test-pod"}, getLabels(podCPU.Metric[0]))
+		assert.Equal(t, 15.0, podCPU.Metric[0].GetCounter().GetValue())
+		assert.Equal(t, sampledAt.UnixMilli(), podCPU.Metric[0].GetTimestampMs())
+
+		podMemory := getFamily(families, podMemoryWorkingSetMetric)
+		assert.Equal(t, 1048576.0, podMemory.Metric[0].GetGauge().GetValue())
+
+		containerCPU := getFamily(families, containerCPUUsageMetric)
+		assert.Len(t, containerCPU.Metric, 1)
+		assert.Equal(t, map[string]string{"container": "nginx", "namespace": "test-ns", "pod": "test-pod"}, getLabels(containerCPU.Metric[0]))
+		assert.Equal(t, "container", containerCPU.Metric[0].Label[0].GetName())
+		assert.Equal(t, 15.0, containerCPU.Metric[0].GetCounter().GetValue())
+
+		containerMemory := getFamily(families, containerMemoryWorkingSetMetric)
+		assert.Equal(t, 1048576.0, containerMemory.Metric[0].GetGauge().GetValue())
+
+		containerStartTime := getFamily(families, containerStartTimeMetric)
+		assert.Equal(t, float64(startTime.Unix()), containerStartTime.Metric[0].GetGauge().GetValue())
+
+		scrapeError := getFamily(families, scrapeErrorMetric)
+		assert.Equal(t, 0.0, scrapeError.Metric[0].GetGauge().GetValue())
+	})
+
+	t.Run("reports a scrape error when the stats summary can't be built", func(t *testing.T) {
+		provider.statsCache.summary = nil
+
+		wsc.EXPECT().GetWorkloads(gomock.Any(), nil).Return(nil, errors.New("API error")).Times(1)
+
+		families, err := provider.GetMetricsResource(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, getFamily(families, containerCPUUsageMetric).Metric, 0)
+		assert.Equal(t, 1.0, getFamily(families, scrapeErrorMetric).Metric[0].GetGauge().GetValue())
+	})
+}
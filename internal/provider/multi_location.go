@@ -0,0 +1,306 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instances"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The annotations of the pods running an instance in other locations than the one of their node, which are
+	// the union of the listed city codes and of the locations in the listed region and continent codes, e.g.
+	//
+	//	locations.vk.stackpath.com/city-codes: JFK,LAX
+	//	locations.vk.stackpath.com/regions: us-east
+	//	locations.vk.stackpath.com/continents: EU
+	cityCodesAnnotation  = "locations.vk.stackpath.com/city-codes"
+	regionsAnnotation    = "locations.vk.stackpath.com/regions"
+	continentsAnnotation = "locations.vk.stackpath.com/continents"
+
+	// The annotation of the pods running in several locations overriding the ready quorum of the provider, e.g.
+	//
+	//	locations.vk.stackpath.com/ready-quorum: majority
+	readyQuorumAnnotation = "locations.vk.stackpath.com/ready-quorum"
+
+	// The reason of the Ready condition of the pods running in several locations whose quorum isn't ready
+	readyQuorumNotMetReason = "ReadyQuorumNotMet"
+)
+
+// isMultiLocation returns whether the pod runs an instance in other locations than the one of its node
+func isMultiLocation(pod *v1.Pod) bool {
+	for _, key := range []string{cityCodesAnnotation, regionsAnnotation, continentsAnnotation} {
+		if _, ok := pod.Annotations[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getPodCityCodes returns the city codes of the locations the pod runs an instance in. The location of the node
+// comes first, since the pod always runs an instance there, followed by the other locations in alphabetical order.
+func (p *StackpathProvider) getPodCityCodes(pod *v1.Pod) ([]string, error) {
+	// the city codes are upper case, as the ones of the StackPath locations and of the annotations are
+	nodeCityCode := strings.ToUpper(p.apiConfig.CityCode)
+	cityCodes := map[string]bool{nodeCityCode: true}
+
+	for _, cityCode := range splitAnnotation(pod.Annotations[cityCodesAnnotation]) {
+		location := config.FindLocation(p.locations, cityCode)
+		if location == nil {
+			return nil, fmt.Errorf("the city code %s of the annotation %s is not a StackPath location", cityCode, cityCodesAnnotation)
+		}
+		cityCodes[strings.ToUpper(location.CityCode)] = true
+	}
+
+	selectors := []struct {
+		annotation string
+		code       func(*workload_models.Workloadv1Location) string
+	}{
+		{regionsAnnotation, func(location *workload_models.Workloadv1Location) string { return location.RegionCode }},
+		{continentsAnnotation, func(location *workload_models.Workloadv1Location) string { return location.ContinentCode }},
+	}
+	for _, selector := range selectors {
+		for _, code := range splitAnnotation(pod.Annotations[selector.annotation]) {
+			matched := false
+			for _, location := range p.locations {
+				if strings.EqualFold(selector.code(location), code) {
+					cityCodes[strings.ToUpper(location.CityCode)] = true
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("there are no StackPath locations in %s of the annotation %s", code, selector.annotation)
+			}
+		}
+	}
+
+	others := make([]string, 0, len(cityCodes)-1)
+	for cityCode := range cityCodes {
+		if cityCode != nodeCityCode {
+			others = append(others, cityCode)
+		}
+	}
+	sort.Strings(others)
+	return append([]string{nodeCityCode}, others...), nil
+}
+
+// getTargetName returns the name of the workload target running the instance of a pod in the location. The target
+// in the location of the node is the one every pod has, whose instance is the one getInstanceName returns.
+func (p *StackpathProvider) getTargetName(cityCode string) string {
+	if strings.EqualFold(cityCode, p.apiConfig.CityCode) {
+		return targetName
+	}
+	return fmt.Sprintf("%s-%s", targetName, strings.ToLower(cityCode))
+}
+
+// getReadyQuorum returns the number of the instances of the pod that must be ready for the pod to be ready
+func (p *StackpathProvider) getReadyQuorum(pod *v1.Pod, instances int) (int, error) {
+	quorum := p.apiConfig.ReadyQuorum
+	if value, ok := pod.Annotations[readyQuorumAnnotation]; ok {
+		quorum = value
+	}
+	count, err := config.GetReadyQuorum(quorum, instances)
+	if err != nil {
+		return 0, fmt.Errorf("the annotation %s is invalid: %w", readyQuorumAnnotation, err)
+	}
+	return count, nil
+}
+
+// getPodStatus returns the status of the pod translated from its instances. The status of the pods running in
+// several locations or autoscaled is aggregated across their instances.
+func (p *StackpathProvider) getPodStatus(ctx context.Context, pod *v1.Pod) (*v1.PodStatus, error) {
+	if !hasSeveralInstances(pod) {
+		instance, err := p.getWorkloadInstance(ctx, pod.Namespace, pod.Name)
+		if err != nil {
+			return nil, err
+		}
+		return p.getK8SPodStatusFrom(ctx, instance), nil
+	}
+
+	instances, err := p.getWorkloadInstances(ctx, pod.Namespace, pod.Name)
+	if err != nil {
+		return nil, err
+	}
+	return p.getK8SPodStatusFromInstances(ctx, pod, instances)
+}
+
+// getPodInstance returns the instance the logs and the commands of the pod are served from. The pods running
+// several instances are served from their primary instance among the ready ones, or among all of them when none
+// is ready, since the instance in the location of the node may not exist. The pods missing from the lister are
+// assumed to run a single instance.
+func (p *StackpathProvider) getPodInstance(ctx context.Context, namespace, name string) (*workload_models.Workloadv1Instance, error) {
+	pod, err := p.podLister.Pods(namespace).Get(name)
+	if err != nil || !hasSeveralInstances(pod) {
+		return p.getWorkloadInstance(ctx, namespace, name)
+	}
+
+	podInstances, err := p.getWorkloadInstances(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(podInstances) == 0 {
+		return nil, errdefs.NotFoundf("the workload of the pod %s/%s has no instances", namespace, name)
+	}
+
+	var ready []*workload_models.Workloadv1Instance
+	for _, instance := range podInstances {
+		if isInstanceReady(instance) {
+			ready = append(ready, instance)
+		}
+	}
+	if len(ready) > 0 {
+		podInstances = ready
+	}
+	return getPrimaryInstance(podInstances, p.getInstanceName(namespace, name)), nil
+}
+
+// getWorkloadInstances returns every instance of the workload of the pod, following the pages of the instances
+func (p *StackpathProvider) getWorkloadInstances(ctx context.Context, namespace, name string) ([]*workload_models.Workloadv1Instance, error) {
+	var result []*workload_models.Workloadv1Instance
+	var after *string
+	for {
+		params := &instances.GetWorkloadInstancesParams{
+			Context:          ctx,
+			StackID:          p.apiConfig.StackID,
+			WorkloadID:       p.getWorkloadSlug(namespace, name),
+			PageRequestAfter: after,
+		}
+		response, err := p.stackpathClient.Instances.GetWorkloadInstances(params, nil)
+		if err != nil {
+			return nil, NewStackPathError(err)
+		}
+		result = append(result, response.Payload.Results...)
+
+		pageInfo := response.Payload.PageInfo
+		if pageInfo == nil || !pageInfo.HasNextPage || pageInfo.EndCursor == "" || (after != nil && *after == pageInfo.EndCursor) {
+			return result, nil
+		}
+		endCursor := pageInfo.EndCursor
+		after = &endCursor
+	}
+}
+
+// getK8SPodStatusFromInstances returns the status of a pod running several instances. The phase and the containers
+// of the pod are the ones of its primary instance, which is the first instance in the location of the node unless
+// another one is running while it isn't. The pod is ready once the quorum of the instances it always runs, its
+// minimum number of instances in each of its locations, is ready. The IP addresses of every instance are reported
+// in its IPs, those of the primary instance first and then by instance name.
+func (p *StackpathProvider) getK8SPodStatusFromInstances(ctx context.Context, pod *v1.Pod, podInstances []*workload_models.Workloadv1Instance) (*v1.PodStatus, error) {
+	if len(podInstances) == 0 {
+		return nil, fmt.Errorf("the workload of the pod %s/%s has no instances", pod.Namespace, pod.Name)
+	}
+
+	// the number of instances the pod always runs, some of which may not be scheduled yet, while the instances
+	// autoscaled beyond them count towards the quorum once ready
+	expected := len(podInstances)
+	cityCodes, err := p.getPodCityCodes(pod)
+	autoscaling, autoscalingErr := getAutoscalingSpecFrom(pod)
+	if err == nil && autoscalingErr == nil {
+		expected = len(cityCodes) * int(autoscaling.minReplicas)
+	}
+	quorum, err := p.getReadyQuorum(pod, expected)
+	if err != nil {
+		return nil, err
+	}
+
+	primary := getPrimaryInstance(podInstances, p.getInstanceName(pod.Namespace, pod.Name))
+	status := p.getK8SPodStatusFrom(ctx, primary)
+
+	ready := 0
+	podIPs := status.PodIPs
+	seen := map[string]bool{}
+	for _, podIP := range podIPs {
+		seen[podIP.IP] = true
+	}
+	for _, instance := range sortInstances(podInstances) {
+		if isInstanceReady(instance) {
+			ready++
+		}
+		for _, ip := range []string{instance.IPAddress, instance.IPV6Address} {
+			if ip != "" && !seen[ip] {
+				seen[ip] = true
+				podIPs = append(podIPs, v1.PodIP{IP: ip})
+			}
+		}
+	}
+	status.PodIPs = podIPs
+
+	for i := range status.Conditions {
+		if status.Conditions[i].Type != v1.PodReady {
+			continue
+		}
+		if ready >= quorum {
+			status.Conditions[i].Status = v1.ConditionTrue
+		} else {
+			status.Conditions[i].Status = v1.ConditionFalse
+			status.Conditions[i].Reason = readyQuorumNotMetReason
+			status.Conditions[i].Message = fmt.Sprintf("%d instances of the pod are ready, %d of its %d instances must be", ready, quorum, expected)
+		}
+	}
+	return status, nil
+}
+
+// getPrimaryInstance returns the instance with the name given, or the first instance running if it isn't
+func getPrimaryInstance(podInstances []*workload_models.Workloadv1Instance, name string) *workload_models.Workloadv1Instance {
+	sorted := sortInstances(podInstances)
+
+	var primary, running *workload_models.Workloadv1Instance
+	for _, instance := range sorted {
+		if primary == nil && instance.Name == name {
+			primary = instance
+		}
+		if running == nil && isInstanceRunning(instance) {
+			running = instance
+		}
+	}
+	switch {
+	case primary != nil && (isInstanceRunning(primary) || running == nil):
+		return primary
+	case running != nil:
+		return running
+	}
+	return sorted[0]
+}
+
+// sortInstances returns the instances sorted by name
+func sortInstances(podInstances []*workload_models.Workloadv1Instance) []*workload_models.Workloadv1Instance {
+	sorted := make([]*workload_models.Workloadv1Instance, len(podInstances))
+	copy(sorted, podInstances)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// isInstanceRunning returns whether the instance is running
+func isInstanceRunning(instance *workload_models.Workloadv1Instance) bool {
+	return instance.Phase != nil && *instance.Phase == workload_models.Workloadv1InstanceInstancePhaseRUNNING
+}
+
+// isInstanceReady returns whether the instance is running and all its containers are ready
+func isInstanceReady(instance *workload_models.Workloadv1Instance) bool {
+	if !isInstanceRunning(instance) || len(instance.ContainerStatuses) == 0 {
+		return false
+	}
+	for _, status := range instance.ContainerStatuses {
+		if !status.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// splitAnnotation returns the trimmed, uppercased and non-empty comma-separated values of the annotation
+func splitAnnotation(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.ToUpper(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
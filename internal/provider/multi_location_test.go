@@ -0,0 +1,374 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/runtime"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance_logs"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instances"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	v1 "k8s.io/api/core/v1"
+)
+
+var testLocations = []*workload_models.Workloadv1Location{
+	{CityCode: "JFK", RegionCode: "us-east", ContinentCode: "NA"},
+	{CityCode: "IAD", RegionCode: "us-east", ContinentCode: "NA"},
+	{CityCode: "DFW", RegionCode: "us-central", ContinentCode: "NA"},
+	{CityCode: "AMS", RegionCode: "eu-west", ContinentCode: "EU"},
+	{CityCode: "FRA", RegionCode: "eu-central", ContinentCode: "EU"},
+}
+
+func TestGetWorkloadTargetsFromMultiLocationPods(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.locations = testLocations
+
+	testCases := []struct {
+		description       string
+		cityCode          string
+		annotations       map[string]string
+		expectedCityCodes map[string]string
+		expectedError     string
+	}{
+		{
+			description:       "runs the pods in the location of their node",
+			expectedCityCodes: map[string]string{"city-code": "JFK"},
+		},
+		{
+			description:       "runs the pods in the listed city codes",
+			annotations:       map[string]string{cityCodesAnnotation: "ams, dfw"},
+			expectedCityCodes: map[string]string{"city-code": "JFK", "city-code-ams": "AMS", "city-code-dfw": "DFW"},
+		},
+		{
+			description:       "runs the pods once in the location of their node whatever the case of its city code",
+			cityCode:          "jfk",
+			annotations:       map[string]string{cityCodesAnnotation: "JFK,AMS"},
+			expectedCityCodes: map[string]string{"city-code": "JFK", "city-code-ams": "AMS"},
+		},
+		{
+			description:       "runs the pods in the locations of the listed regions and continents",
+			annotations:       map[string]string{regionsAnnotation: "us-east", continentsAnnotation: "eu"},
+			expectedCityCodes: map[string]string{"city-code": "JFK", "city-code-iad": "IAD", "city-code-ams": "AMS", "city-code-fra": "FRA"},
+		},
+		{
+			description:   "fails for the city codes which aren't locations",
+			annotations:   map[string]string{cityCodesAnnotation: "AMS,LAX"},
+			expectedError: "the city code LAX of the annotation locations.vk.stackpath.com/city-codes is not a StackPath location",
+		},
+		{
+			description:   "fails for the selectors matching no location",
+			annotations:   map[string]string{continentsAnnotation: "AF"},
+			expectedError: "there are no StackPath locations in AF of the annotation locations.vk.stackpath.com/continents",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			provider.apiConfig.CityCode = "JFK"
+			if c.cityCode != "" {
+				provider.apiConfig.CityCode = c.cityCode
+			}
+
+			targets, err := provider.getWorkloadTargetsFrom(createTestPodWithAnnotations(c.annotations))
+			if c.expectedError != "" {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			cityCodes := map[string]string{}
+			for name, target := range targets {
+				assert.Equal(t, int32(1), target.Spec.Deployments.MinReplicas)
+				assert.Equal(t, int32(1), target.Spec.Deployments.MaxReplicas)
+				cityCodes[name] = target.Spec.Deployments.Selectors[0].Values[0]
+			}
+			assert.Equal(t, c.expectedCityCodes, cityCodes)
+		})
+	}
+}
+
+func TestGetMultiLocationPodStatus(t *testing.T) {
+	ctx := context.Background()
+
+	mockController := gomock.NewController(t)
+	isc := mocks.NewInstancesClientService(mockController)
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, &workload_client.EdgeCompute{Instances: isc})
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.locations = testLocations
+
+	podInstances := []*workload_models.Workloadv1Instance{
+		createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+		createTestPodInstance("test-ns-test-pod-city-code-jfk-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.1"),
+		createTestPodInstance("test-ns-test-pod-city-code-dfw-dfw-0", workload_models.Workloadv1InstanceInstancePhaseSTARTING, false, ""),
+	}
+
+	testCases := []struct {
+		description        string
+		readyQuorum        string
+		expectedReadyState v1.ConditionStatus
+	}{
+		{
+			description:        "reports the pod not ready until all its instances are ready",
+			expectedReadyState: v1.ConditionFalse,
+		},
+		{
+			description:        "reports the pod ready once the quorum of its instances is ready",
+			readyQuorum:        "majority",
+			expectedReadyState: v1.ConditionTrue,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			// the instances are read from two pages
+			isc.EXPECT().GetWorkloadInstances(gomock.Any(), nil).DoAndReturn(
+				func(params *instances.GetWorkloadInstancesParams, _ interface{}, _ ...instances.ClientOption) (*instances.GetWorkloadInstancesOK, error) {
+					assert.Equal(t, "test-ns-test-pod", params.WorkloadID)
+					if params.PageRequestAfter == nil {
+						return &instances.GetWorkloadInstancesOK{Payload: &workload_models.V1GetWorkloadInstancesResponse{
+							PageInfo: &workload_models.PaginationPageInfo{HasNextPage: true, EndCursor: "2"},
+							Results:  podInstances[:2],
+						}}, nil
+					}
+					return &instances.GetWorkloadInstancesOK{Payload: &workload_models.V1GetWorkloadInstancesResponse{
+						Results: podInstances[2:],
+					}}, nil
+				}).Times(2)
+
+			pod := createTestPodWithAnnotations(map[string]string{cityCodesAnnotation: "AMS,DFW"})
+			if c.readyQuorum != "" {
+				pod.Annotations[readyQuorumAnnotation] = c.readyQuorum
+			}
+
+			status, err := provider.getPodStatus(ctx, pod)
+			assert.NoError(t, err)
+			assert.Equal(t, v1.PodRunning, status.Phase)
+			assert.Equal(t, "10.0.0.1", status.PodIP)
+			assert.Equal(t, []v1.PodIP{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}, status.PodIPs)
+
+			for _, condition := range status.Conditions {
+				if condition.Type == v1.PodReady {
+					assert.Equal(t, c.expectedReadyState, condition.Status)
+					if c.expectedReadyState == v1.ConditionFalse {
+						assert.Equal(t, readyQuorumNotMetReason, condition.Reason)
+						assert.Equal(t, "2 instances of the pod are ready, 3 of its 3 instances must be", condition.Message)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("reports the running instance when the one in the location of the node isn't", func(t *testing.T) {
+		primary := getPrimaryInstance([]*workload_models.Workloadv1Instance{
+			createTestPodInstance("test-ns-test-pod-city-code-jfk-0", workload_models.Workloadv1InstanceInstancePhaseSCHEDULING, false, ""),
+			createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+		}, "test-ns-test-pod-city-code-jfk-0")
+		assert.Equal(t, "test-ns-test-pod-city-code-ams-ams-0", primary.Name)
+	})
+}
+
+func TestMultiLocationPodTracking(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	isc := mocks.NewInstancesClientService(mockController)
+	provider, err := createTestProvider(ctx, nil, nil, nil, &workload_client.EdgeCompute{Workloads: wsc, Instances: isc})
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.locations = testLocations
+
+	pod := createTestPodWithAnnotations(map[string]string{cityCodesAnnotation: "AMS", readyQuorumAnnotation: "any"})
+	pod.Spec.Containers[0].Image = "nginx:latest"
+	pod.Status.Phase = v1.PodPending
+
+	t.Run("reports the status aggregated across the instances", func(t *testing.T) {
+		isc.EXPECT().GetWorkloadInstances(gomock.Any(), nil).Return(&instances.GetWorkloadInstancesOK{
+			Payload: &workload_models.V1GetWorkloadInstancesResponse{
+				Results: []*workload_models.Workloadv1Instance{
+					createTestPodInstance("test-ns-test-pod-city-code-jfk-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, false, "10.0.0.1"),
+					createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+				},
+			},
+		}, nil).Times(1)
+
+		podsTracker := &PodsTracker{
+			podLister:      mocks.NewMockPodLister(mockController),
+			updateCallback: func(p *v1.Pod) {},
+			handler:        provider,
+		}
+		assert.True(t, podsTracker.handlePodUpdates(ctx, pod))
+		assert.Equal(t, v1.PodRunning, pod.Status.Phase)
+		assert.Equal(t, []v1.PodIP{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}, pod.Status.PodIPs)
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodReady {
+				assert.Equal(t, v1.ConditionTrue, condition.Status)
+			}
+		}
+	})
+
+	t.Run("keeps the targets of the workload when the pod is updated", func(t *testing.T) {
+		live, err := provider.getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+		live.Metadata.Version = "1"
+		live.Status = workload_models.V1WorkloadStatusACTIVE.Pointer()
+		assert.Len(t, live.Targets, 2)
+
+		updated := pod.DeepCopy()
+		updated.Spec.Containers[0].Image = "nginx:1.25"
+		// the locations are set when the pod is created
+		updated.Annotations[cityCodesAnnotation] = "AMS,DFW"
+
+		wsc.EXPECT().GetWorkload(gomock.Any(), nil).Return(&workloads.GetWorkloadOK{Payload: &workload_models.V1GetWorkloadResponse{Workload: live}}, nil).Times(1)
+		wsc.EXPECT().UpdateWorkload(gomock.Any(), nil).Do(func(params *workloads.UpdateWorkloadParams, _ interface{}, _ ...workloads.ClientOption) {
+			assert.Equal(t, "nginx:1.25", params.Body.Workload.Spec.Containers["nginx"].Image)
+			assert.Equal(t, live.Targets, params.Body.Workload.Targets)
+		}).Return(nil, nil).Times(1)
+
+		assert.NoError(t, provider.UpdatePod(ctx, updated))
+	})
+}
+
+func TestGetMultiLocationPod(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	pod := createTestPodWithAnnotations(map[string]string{cityCodesAnnotation: "AMS"})
+	pod.Spec.Containers[0].Image = "nginx:latest"
+
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	isc := mocks.NewInstancesClientService(mockController)
+	// the instance in the location of the node was scaled in, so it mustn't be read on its own
+	stackPathClientMock := workload_client.EdgeCompute{Workloads: wsc, Instance: mocks.NewInstanceClientService(mockController), Instances: isc}
+	provider, err := createTestProvider(ctx, nil, nil, createTestPodLister(mockController, pod), &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.locations = testLocations
+
+	wsc.EXPECT().GetWorkload(gomock.Any(), nil).Return(&workloads.GetWorkloadOK{
+		Payload: &workload_models.V1GetWorkloadResponse{Workload: &workload_models.V1Workload{Name: "test-ns-test-pod"}},
+	}, nil).Times(1)
+	isc.EXPECT().GetWorkloadInstances(gomock.Any(), nil).Return(&instances.GetWorkloadInstancesOK{
+		Payload: &workload_models.V1GetWorkloadInstancesResponse{
+			Results: []*workload_models.Workloadv1Instance{
+				createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+			},
+		},
+	}, nil).Times(1)
+
+	updatedPod, err := provider.GetPod(ctx, "test-ns", "test-pod")
+	assert.NoError(t, err)
+	assert.Equal(t, v1.PodRunning, updatedPod.Status.Phase)
+	assert.Equal(t, "10.0.0.2", updatedPod.Status.PodIP)
+}
+
+func TestGetMultiLocationPodInstance(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	pod := createTestPodWithAnnotations(map[string]string{cityCodesAnnotation: "AMS"})
+
+	isc := mocks.NewInstancesClientService(mockController)
+	ilc := mocks.NewInstanceLogsClientService(mockController)
+	stackPathClientMock := workload_client.EdgeCompute{Instance: mocks.NewInstanceClientService(mockController), Instances: isc, InstanceLogs: ilc}
+	provider, err := createTestProvider(ctx, nil, nil, createTestPodLister(mockController, pod), &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.locations = testLocations
+
+	respondWithInstances := func(podInstances ...*workload_models.Workloadv1Instance) {
+		isc.EXPECT().GetWorkloadInstances(gomock.Any(), nil).Return(&instances.GetWorkloadInstancesOK{
+			Payload: &workload_models.V1GetWorkloadInstancesResponse{Results: podInstances},
+		}, nil).Times(1)
+	}
+
+	testCases := []struct {
+		description      string
+		podInstances     []*workload_models.Workloadv1Instance
+		expectedInstance string
+	}{
+		{
+			description: "serves the pod from the instance in the location of the node when it's ready",
+			podInstances: []*workload_models.Workloadv1Instance{
+				createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+				createTestPodInstance("test-ns-test-pod-city-code-jfk-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.1"),
+			},
+			expectedInstance: "test-ns-test-pod-city-code-jfk-0",
+		},
+		{
+			description: "serves the pod from a ready instance when the one in the location of the node isn't",
+			podInstances: []*workload_models.Workloadv1Instance{
+				createTestPodInstance("test-ns-test-pod-city-code-jfk-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, false, "10.0.0.1"),
+				createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+			},
+			expectedInstance: "test-ns-test-pod-city-code-ams-ams-0",
+		},
+		{
+			description: "serves the pod from a running instance when none is ready",
+			podInstances: []*workload_models.Workloadv1Instance{
+				createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, false, "10.0.0.2"),
+				createTestPodInstance("test-ns-test-pod-city-code-dfw-dfw-0", workload_models.Workloadv1InstanceInstancePhaseSTARTING, false, ""),
+			},
+			expectedInstance: "test-ns-test-pod-city-code-ams-ams-0",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			respondWithInstances(c.podInstances...)
+
+			instance, err := provider.getPodInstance(ctx, "test-ns", "test-pod")
+			assert.NoError(t, err)
+			assert.Equal(t, c.expectedInstance, instance.Name)
+		})
+	}
+
+	t.Run("reads the logs of the ready instance", func(t *testing.T) {
+		respondWithInstances(
+			createTestPodInstance("test-ns-test-pod-city-code-jfk-0", workload_models.Workloadv1InstanceInstancePhaseSTARTING, false, ""),
+			createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+		)
+		ilc.EXPECT().GetLogs(gomock.Any(), nil, gomock.Any()).DoAndReturn(
+			func(params *instance_logs.GetLogsParams, writer runtime.ClientAuthInfoWriter, opts ...instance_logs.ClientOption) (*instance_logs.GetLogsOK, error) {
+				assert.Equal(t, "test-ns-test-pod-city-code-ams-ams-0", params.InstanceName)
+				return respondWithLogStream(http.StatusOK, `{"result":{"bytes":"bGluZSAxCg=="}}`)(params, writer, opts...)
+			}).Times(1)
+
+		logs, err := provider.GetContainerLogs(ctx, "test-ns", "test-pod", "nginx", api.ContainerLogOpts{})
+		assert.NoError(t, err)
+		data, err := io.ReadAll(logs)
+		assert.NoError(t, err)
+		assert.Equal(t, "line 1\n", string(data))
+	})
+
+	t.Run("fails with not found to run commands in a pod without instances", func(t *testing.T) {
+		respondWithInstances()
+
+		err := provider.RunInContainer(ctx, "test-ns", "test-pod", "nginx", []string{"ls"}, newTestAttachIO("", false))
+		assert.EqualError(t, err, "pod test-ns/test-pod is not found")
+		assert.True(t, errdefs.IsNotFound(err))
+	})
+}
@@ -0,0 +1,35 @@
+package provider
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// The script wrapping the command of a native sidecar, which is run by /bin/sh the way the init containers are.
+// The sidecar waits for the init containers before it, records that it started so the init containers after it
+// can run, and runs its command along with the containers.
+const nativeSidecarScript = `%s: > "$0/%s.done"; exec "$@"`
+
+// getNativeSidecarNames returns the init containers of the pod that are native sidecars, i.e. whose restart policy
+// is Always, the only restart policy init containers may have.
+func getNativeSidecarNames(pod *v1.Pod) map[string]bool {
+	names := map[string]bool{}
+	for _, initContainer := range pod.Spec.InitContainers {
+		if initContainer.RestartPolicy != nil && *initContainer.RestartPolicy == v1.ContainerRestartPolicyAlways {
+			names[initContainer.Name] = true
+		}
+	}
+	return names
+}
+
+// getLongRunningContainers returns the containers of the pod that run until it's deleted,
+// which are its native sidecars, in the order they start in, followed by its containers
+func getLongRunningContainers(pod *v1.Pod) []v1.Container {
+	sidecarNames := getNativeSidecarNames(pod)
+	containers := make([]v1.Container, 0, len(sidecarNames)+len(pod.Spec.Containers))
+	for _, initContainer := range pod.Spec.InitContainers {
+		if sidecarNames[initContainer.Name] {
+			containers = append(containers, initContainer)
+		}
+	}
+	return append(containers, pod.Spec.Containers...)
+}
@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// newNativeSidecar returns an init container with the Always restart policy, which makes it a native sidecar
+func newNativeSidecar(name string) v1.Container {
+	always := v1.ContainerRestartPolicyAlways
+	sidecar := createTestContainer(name)
+	sidecar.RestartPolicy = &always
+	sidecar.ReadinessProbe = &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{HTTPGet: &v1.HTTPGetAction{Path: "/ready", Port: intstr.FromInt(15021)}},
+	}
+	return sidecar
+}
+
+func TestGetNativeSidecarNames(t *testing.T) {
+	testCases := []struct {
+		description         string
+		initContainers      []v1.Container
+		expectedSidecars    map[string]bool
+		expectedLongRunning []string
+	}{
+		{
+			description:         "finds the init containers restarted always",
+			initContainers:      []v1.Container{createTestContainer("migrate"), newNativeSidecar("proxy"), newNativeSidecar("log-shipper")},
+			expectedSidecars:    map[string]bool{"proxy": true, "log-shipper": true},
+			expectedLongRunning: []string{"proxy", "log-shipper", "app"},
+		},
+		{
+			description:         "finds no native sidecars among the init containers which complete",
+			initContainers:      []v1.Container{createTestContainer("migrate")},
+			expectedSidecars:    map[string]bool{},
+			expectedLongRunning: []string{"app"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			pod := createTestPodWithContainers(c.initContainers, createTestContainer("app"))
+			assert.Equal(t, c.expectedSidecars, getNativeSidecarNames(pod))
+
+			longRunning := []string{}
+			for _, container := range getLongRunningContainers(pod) {
+				longRunning = append(longRunning, container.Name)
+			}
+			assert.Equal(t, c.expectedLongRunning, longRunning)
+		})
+	}
+}
+
+func TestNativeSidecars(t *testing.T) {
+	ctx := context.Background()
+
+	newProvider := func(t *testing.T, initGateImage string) *StackpathProvider {
+		provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatal("failed to create the test provider", err)
+		}
+		provider.apiConfig.InitGateImage = initGateImage
+		return provider
+	}
+
+	t.Run("runs the native sidecars as containers", func(t *testing.T) {
+		workload, err := newProvider(t, "").getWorkloadFrom(ctx, createTestPodWithContainers([]v1.Container{newNativeSidecar("proxy")}, createTestContainer("app")))
+		assert.NoError(t, err)
+
+		assert.Len(t, workload.Spec.Containers, 2)
+		assert.Equal(t, []string{"proxy"}, workload.Spec.Containers["proxy"].Command)
+		assert.Equal(t, "/ready", workload.Spec.Containers["proxy"].ReadinessProbe.HTTPGet.Path)
+		assert.Equal(t, []string{"app"}, workload.Spec.Containers["app"].Command)
+		assert.Empty(t, workload.Spec.VolumeClaimTemplates)
+	})
+
+	t.Run("starts the native sidecars in their turn among the init containers", func(t *testing.T) {
+		pod := createTestPodWithContainers([]v1.Container{createTestContainer("migrate"), newNativeSidecar("proxy")}, createTestContainer("app"))
+		// the sidecar starts after the init container before it, and the init container after it waits for it
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, createTestContainer("seed"))
+
+		workload, err := newProvider(t, "stackpath/init-gate:latest").getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+
+		containers := workload.Spec.Containers
+		assert.Len(t, containers, 5)
+
+		proxy := containers["proxy"]
+		assert.Equal(t, []string{"/bin/sh", "-c", `until [ -f "$0/migrate.done" ]; do sleep 1; done; : > "$0/proxy.done"; exec "$@"`, initGateMountPath, "proxy"}, proxy.Command)
+		assert.Equal(t, "/ready", proxy.ReadinessProbe.HTTPGet.Path)
+		assert.Equal(t, []*workload_models.V1InstanceVolumeMount{{Slug: initGateVolumeName, MountPath: initGateMountPath}}, proxy.VolumeMounts)
+
+		seed := containers["seed"]
+		assert.Equal(t, []string{"/bin/sh", "-c", `if [ ! -f "$0/seed.done" ]; then until [ -f "$0/proxy.done" ]; do sleep 1; done; "$@" || exit; : > "$0/seed.done"; fi; exec sleep 2147483647`, initGateMountPath, "seed"}, seed.Command)
+		assert.Equal(t, "/init/seed", seed.ReadinessProbe.HTTPGet.Path)
+
+		assert.Equal(t, []string{"/bin/sh", "-c", `until [ -f "$0/seed.done" ]; do sleep 1; done; exec "$@"`, initGateMountPath, "app"}, containers["app"].Command)
+	})
+
+	t.Run("runs the native sidecars of the pods without other init containers as is", func(t *testing.T) {
+		pod := createTestPodWithContainers([]v1.Container{newNativeSidecar("proxy")}, createTestContainer("job"))
+		pod.Spec.RestartPolicy = v1.RestartPolicyOnFailure
+
+		workload, err := newProvider(t, "stackpath/init-gate:latest").getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+
+		// only the container run to completion is gated
+		proxy := workload.Spec.Containers["proxy"]
+		assert.Equal(t, []string{"proxy"}, proxy.Command)
+		assert.Empty(t, proxy.VolumeMounts)
+		assert.Equal(t, []string{"/bin/sh", "-c", `if [ ! -f "$0/job.done" ]; then "$@" || exit; : > "$0/job.done"; fi; exec sleep 2147483647`, initGateMountPath, "job"}, workload.Spec.Containers["job"].Command)
+	})
+
+	t.Run("reports the native sidecars in the init container statuses", func(t *testing.T) {
+		pod := createTestPodWithContainers([]v1.Container{createTestContainer("migrate"), newNativeSidecar("proxy")}, createTestContainer("app"))
+		running := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+
+		status := &v1.PodStatus{
+			Phase: v1.PodRunning,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionTrue},
+				{Type: v1.PodInitialized, Status: v1.ConditionTrue},
+			},
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "app", State: running, Ready: true},
+				{Name: "migrate", State: running, Ready: true},
+				{Name: "proxy", State: running, Ready: true, RestartCount: 1},
+			},
+		}
+		setInitContainerStatus(pod, status)
+
+		assert.Equal(t, v1.PodRunning, status.Phase)
+		assert.Equal(t, []v1.ContainerStatus{{Name: "app", State: running, Ready: true}}, status.ContainerStatuses)
+		assert.Equal(t, []v1.ContainerStatus{
+			{Name: "migrate", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: initContainerCompletedReason}}, Ready: true},
+			{Name: "proxy", State: running, Ready: true, RestartCount: 1},
+		}, status.InitContainerStatuses)
+		assert.Equal(t, v1.ConditionTrue, status.Conditions[1].Status)
+	})
+
+	t.Run("reports the pod initializing until the native sidecars are running", func(t *testing.T) {
+		pod := createTestPodWithContainers([]v1.Container{newNativeSidecar("proxy")}, createTestContainer("app"))
+		waiting := v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}
+
+		status := &v1.PodStatus{
+			Phase: v1.PodRunning,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodInitialized, Status: v1.ConditionTrue},
+			},
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "app", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}, Ready: true},
+				{Name: "proxy", State: waiting},
+			},
+		}
+		setInitContainerStatus(pod, status)
+
+		assert.Equal(t, v1.PodPending, status.Phase)
+		assert.Equal(t, []v1.ContainerStatus{{Name: "proxy", State: waiting}}, status.InitContainerStatuses)
+		assert.Equal(t, v1.PodCondition{Type: v1.PodInitialized, Status: v1.ConditionFalse, Reason: containersNotInitializedReason, Message: "containers with incomplete status: [proxy]"}, status.Conditions[0])
+	})
+}
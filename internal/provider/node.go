@@ -19,6 +19,15 @@ func (p *StackpathProvider) ConfigureNode(ctx context.Context, node *v1.Node) {
 	node.Status.Capacity = p.getNodeCapacity()
 	node.Status.Allocatable = p.getNodeCapacity()
 	node.Status.NodeInfo.OperatingSystem = p.operatingSystem
+
+	if p.location != nil {
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+		for key, value := range getLocationLabels(ctx, p.location) {
+			node.Labels[key] = value
+		}
+	}
 }
 
 func (p *StackpathProvider) getNodeCapacity() v1.ResourceList {
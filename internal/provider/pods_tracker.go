@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -21,12 +22,24 @@ type PodsTracker struct {
 	podLister      corev1listers.PodLister
 	updateCallback func(*v1.Pod)
 	handler        PodsTrackerHandler
+	// the strategy gRPC probes are translated with, which is reported in the status of the pods
+	grpcProbeStrategy string
+	// the checksum of the files written by the volume writer the workload was last updated with, by pod
+	volumesChecksums map[string]string
+	// what happens to the workloads of the pods run to completion once they terminated
+	terminatedWorkloadPolicy string
+	// the image of the init gate, without which the pods run to completion are restarted like the other pods
+	initGateImage string
 }
 
 type PodsTrackerHandler interface {
 	GetPods(ctx context.Context) ([]*v1.Pod, error)
 	GetPodStatus(ctx context.Context, ns, name string) (*v1.PodStatus, error)
+	getPodStatus(ctx context.Context, pod *v1.Pod) (*v1.PodStatus, error)
+	UpdatePod(ctx context.Context, pod *v1.Pod) error
 	DeletePod(ctx context.Context, pod *v1.Pod) error
+	getVolumesChecksum(pod *v1.Pod) (string, error)
+	deleteWorkload(ctx context.Context, podNamespace, podName string) error
 }
 
 // BeginPodTracking initializes and manages background tracking for created pods
@@ -109,12 +122,18 @@ func (pt *PodsTracker) handlePodUpdates(ctx context.Context, pod *v1.Pod) bool {
 
 	if pt.isPodStatusUpdateRequired(pod) {
 		log.G(ctx).Infof("pod %s will skip pod status update", pod.Name)
+		delete(pt.volumesChecksums, pod.Namespace+"/"+pod.Name)
 		return false
 	}
 
-	newStatus, err := pt.handler.GetPodStatus(ctx, pod.Namespace, pod.Name)
+	newStatus, err := pt.handler.getPodStatus(ctx, pod)
 	if err == nil && newStatus != nil {
+		setPodStatus(pod, newStatus, pt.initGateImage, pt.grpcProbeStrategy)
+		if isRunToCompletion(pod) && (newStatus.Phase == v1.PodSucceeded || newStatus.Phase == v1.PodFailed) && !pt.deleteTerminatedWorkload(ctx, pod) {
+			return false
+		}
 		newStatus.DeepCopyInto(&pod.Status)
+		pt.updateVolumes(ctx, pod)
 		return true
 	}
 	if err != nil {
@@ -150,6 +169,51 @@ func (pt *PodsTracker) handlePodUpdates(ctx context.Context, pod *v1.Pod) bool {
 	return false
 }
 
+// updateVolumes updates the workload of the pod when the files of its ConfigMap, Secret, projected or downward API
+// volumes have changed since the workload was last updated, so the volume writer writes the new files. The workload
+// is left as is when its annotations already hold the checksum of the files, e.g. when the provider restarts.
+func (pt *PodsTracker) updateVolumes(ctx context.Context, pod *v1.Pod) {
+	key := pod.Namespace + "/" + pod.Name
+	checksum, err := pt.handler.getVolumesChecksum(pod)
+	if err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to read the volumes of the pod %s", key)
+		return
+	}
+	if checksum == "" || pt.volumesChecksums[key] == checksum {
+		return
+	}
+
+	log.G(ctx).Infof("updating the volumes of the pod %s", key)
+	if err := pt.handler.UpdatePod(ctx, pod); err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to update the volumes of the pod %s", key)
+		return
+	}
+
+	if pt.volumesChecksums == nil {
+		pt.volumesChecksums = map[string]string{}
+	}
+	pt.volumesChecksums[key] = checksum
+}
+
+// deleteTerminatedWorkload deletes the workload of a pod run to completion that succeeded or failed, unless the
+// workloads are retained, since StackPath keeps its instance running. The function returns false when the workload
+// couldn't be deleted, in which case the status of the pod isn't updated so the deletion is retried.
+func (pt *PodsTracker) deleteTerminatedWorkload(ctx context.Context, pod *v1.Pod) bool {
+	if pt.terminatedWorkloadPolicy == config.TerminatedWorkloadPolicyRetain {
+		return true
+	}
+
+	log.G(ctx).Infof("deleting the workload of the terminated pod %s/%s", pod.Namespace, pod.Name)
+	err := pt.handler.deleteWorkload(ctx, pod.Namespace, pod.Name)
+	if err != nil {
+		if apiError, ok := err.(*APIError); !ok || !apiError.NotFound() {
+			log.G(ctx).WithError(err).Errorf("failed to delete the workload of the terminated pod %s/%s", pod.Namespace, pod.Name)
+			return false
+		}
+	}
+	return true
+}
+
 // isPodStatusUpdateRequired determines whether a given pod requires a status update within the PodsTracker.
 // The function returns false if the pod has completed its execution (PodSucceeded), has failed (PodFailed),
 // or is in the process of being terminated (DeletionTimestamp is set).
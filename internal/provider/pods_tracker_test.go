@@ -12,6 +12,7 @@ import (
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance"
 	workloads "github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/config"
 	mocks "github.com/stackpath/vk-stackpath-provider/internal/mocks"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
@@ -471,6 +472,111 @@ func TestStatusSyncup(t *testing.T) {
 	}
 }
 
+func TestDeleteTerminatedWorkloads(t *testing.T) {
+	podName := fmt.Sprintf("test-pod-%s", uuid.New().String())
+	podNamespace := fmt.Sprintf("test-ns-%s", uuid.New().String())
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	ctx := context.Background()
+
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	isc := mocks.NewInstanceClientService(mockController)
+	stackPathClientMock := workload_client.EdgeCompute{Workloads: wsc, Instance: isc}
+
+	provider, err := createTestProvider(ctx, mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), mocks.NewMockPodLister(mockController), &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	testCases := []struct {
+		description              string
+		terminatedWorkloadPolicy string
+		withoutInitGate          bool
+		deleteError              error
+		expectedUpdate           bool
+		expectedPodPhase         v1.PodPhase
+	}{
+		{
+			description:              "deletes the workload of the pod that completed",
+			terminatedWorkloadPolicy: config.TerminatedWorkloadPolicyDelete,
+			expectedUpdate:           true,
+			expectedPodPhase:         v1.PodSucceeded,
+		},
+		{
+			description:              "reports the pod that completed when its workload was already deleted",
+			terminatedWorkloadPolicy: config.TerminatedWorkloadPolicyDelete,
+			deleteError:              NewStackPathError(&APIError{statusCode: 404, message: "Not found", requestID: "123"}),
+			expectedUpdate:           true,
+			expectedPodPhase:         v1.PodSucceeded,
+		},
+		{
+			description:              "retries the deletion of the workload when it fails",
+			terminatedWorkloadPolicy: config.TerminatedWorkloadPolicyDelete,
+			deleteError:              NewStackPathError(&APIError{statusCode: 500, message: "Internal Server Error", requestID: "123"}),
+			expectedUpdate:           false,
+			expectedPodPhase:         v1.PodRunning,
+		},
+		{
+			description:              "retains the workload of the pod that completed",
+			terminatedWorkloadPolicy: config.TerminatedWorkloadPolicyRetain,
+			expectedUpdate:           true,
+			expectedPodPhase:         v1.PodSucceeded,
+		},
+		{
+			description:              "keeps the pod created without init gate running",
+			terminatedWorkloadPolicy: config.TerminatedWorkloadPolicyDelete,
+			withoutInitGate:          true,
+			expectedUpdate:           true,
+			expectedPodPhase:         v1.PodRunning,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			podsTracker := &PodsTracker{
+				podLister:      mocks.NewMockPodLister(mockController),
+				updateCallback: func(p *v1.Pod) {},
+				handler:        provider,
+
+				terminatedWorkloadPolicy: c.terminatedWorkloadPolicy,
+				initGateImage:            "stackpath/init-gate:latest",
+			}
+			if c.withoutInitGate {
+				podsTracker.initGateImage = ""
+			}
+
+			pod := createTestPod(podName, podNamespace)
+			pod.Spec.RestartPolicy = v1.RestartPolicyOnFailure
+			pod.Status.Phase = v1.PodRunning
+
+			// the init gate reports the container as ready once it completed
+			i := createTestInstance(
+				provider.getInstanceName(podNamespace, podName),
+				workload_models.NewWorkloadv1InstanceInstancePhase(workload_models.Workloadv1InstanceInstancePhaseRUNNING),
+				&workload_models.V1ContainerStatus{Name: "nginx", Ready: true, Running: &workload_models.ContainerStatusRunning{}},
+			)
+			isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(
+				&instance.GetWorkloadInstanceOK{Payload: &workload_models.V1GetWorkloadInstanceResponse{Instance: i}},
+				nil,
+			).Times(1)
+
+			if c.terminatedWorkloadPolicy == config.TerminatedWorkloadPolicyDelete && !c.withoutInitGate {
+				params := workloads.DeleteWorkloadParams{
+					Context:    ctx,
+					StackID:    provider.apiConfig.StackID,
+					WorkloadID: provider.getWorkloadSlug(podNamespace, podName),
+				}
+				wsc.EXPECT().DeleteWorkload(&params, nil).Return(nil, c.deleteError).Times(1)
+			}
+
+			isPodUpdated := podsTracker.handlePodUpdates(ctx, pod)
+
+			assert.Equal(t, c.expectedUpdate, isPodUpdated)
+			assert.Equal(t, c.expectedPodPhase, pod.Status.Phase)
+		})
+	}
+}
+
 func TestBeginPodTracking(t *testing.T) {
 	mockController := gomock.NewController(t)
 	defer mockController.Finish()
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	v1 "k8s.io/api/core/v1"
+)
+
+// The sidecar containers the provider adds to workloads to run the probes, to write the volumes StackPath
+// doesn't support and to report the init containers that completed. They aren't containers of the pod,
+// so they aren't reported in its status.
+var sidecarContainerNames = map[string]bool{
+	execProbeShimContainerName:     true,
+	grpcHealthGatewayContainerName: true,
+	volumeWriterContainerName:      true,
+	initGateContainerName:          true,
+}
+
+// containerProbe is a liveness or readiness probe of a container of a pod
+type containerProbe struct {
+	container string
+	probeType string
+	probe     *v1.Probe
+	ports     []v1.ContainerPort
+}
+
+// name returns a name unique to the probe within the pod
+func (c *containerProbe) name() string {
+	return fmt.Sprintf("%s-%s", c.container, c.probeType)
+}
+
+// getContainerProbesFrom returns the liveness and readiness probes of the pod's containers and native sidecars matching the filter
+func getContainerProbesFrom(pod *v1.Pod, filter func(*v1.Probe) bool) []containerProbe {
+	probes := []containerProbe{}
+	for _, container := range getLongRunningContainers(pod) {
+		if container.LivenessProbe != nil && filter(container.LivenessProbe) {
+			probes = append(probes, containerProbe{container: container.Name, probeType: "liveness", probe: container.LivenessProbe, ports: container.Ports})
+		}
+		if container.ReadinessProbe != nil && filter(container.ReadinessProbe) {
+			probes = append(probes, containerProbe{container: container.Name, probeType: "readiness", probe: container.ReadinessProbe, ports: container.Ports})
+		}
+	}
+	return probes
+}
+
+// setContainerProbe sets the workload probe replacing a probe StackPath doesn't support on the translated container
+func setContainerProbe(containers workload_models.V1ContainerSpecMapEntry, probe containerProbe, workloadProbe *workload_models.V1Probe) {
+	container := containers[probe.container]
+	if probe.probeType == "liveness" {
+		container.LivenessProbe = workloadProbe
+	} else {
+		container.ReadinessProbe = workloadProbe
+	}
+	containers[probe.container] = container
+}
+
+// getSidecarProbe returns an HTTP probe against a probe sidecar, with the timings of the original probe
+func getSidecarProbe(probe containerProbe, port int32) *workload_models.V1Probe {
+	return &workload_models.V1Probe{
+		FailureThreshold:    probe.probe.FailureThreshold,
+		InitialDelaySeconds: probe.probe.InitialDelaySeconds,
+		PeriodSeconds:       probe.probe.PeriodSeconds,
+		SuccessThreshold:    probe.probe.SuccessThreshold,
+		TimeoutSeconds:      probe.probe.TimeoutSeconds,
+		HTTPGet: &workload_models.V1HTTPGetAction{
+			Path:   "/probes/" + probe.name(),
+			Port:   port,
+			Scheme: string(v1.URISchemeHTTP),
+		},
+	}
+}
+
+// addProbeSidecar adds a sidecar running probes to the containers, after checking that neither
+// its name nor its port conflicts with the containers of the pod
+func (p *StackpathProvider) addProbeSidecar(pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry, name, image string, port int32, env workload_models.V1EnvironmentVariableMapEntry) error {
+	for _, container := range getPodContainers(pod) {
+		if container.Name == name {
+			return fmt.Errorf("the container name %s is reserved for the provider's probe sidecar", name)
+		}
+		for _, containerPort := range container.Ports {
+			if containerPort.ContainerPort == port {
+				return fmt.Errorf("the port %d of the container %s conflicts with the port of the %s sidecar", port, container.Name, name)
+			}
+		}
+	}
+
+	containers[name] = workload_models.V1ContainerSpec{
+		Image:     image,
+		Env:       env,
+		Resources: p.getSidecarResources(),
+	}
+	return nil
+}
@@ -4,18 +4,23 @@ package provider
 import (
 	"context"
 	"io"
+	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
 	"github.com/stackpath/vk-stackpath-provider/internal/config"
+	"github.com/stackpath/vk-stackpath-provider/internal/registry"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	"github.com/virtual-kubelet/virtual-kubelet/node/api"
 	stats "github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
 	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -24,8 +29,9 @@ const (
 	targetName = "city-code"
 
 	// targetOrdinal is a constant string representing the ordinal number for
-	// the target instance. It is set to "0" to indicate the first instance in
-	// a given workload.
+	// the primary instance. It is set to "0" to indicate the first instance of
+	// the target in the location of the node, which pods running in several
+	// locations or autoscaled run along with their other instances.
 	targetOrdinal = "0"
 
 	nodeNameLabelKey = "vk-node-name"
@@ -33,6 +39,9 @@ const (
 	podNameLabelKey = "vk-pod-name"
 
 	podNamespaceLabelKey = "vk-pod-namespace"
+
+	// registryTimeout is the time allowed to read the entrypoint of an image from its registry
+	registryTimeout = 30 * time.Second
 )
 
 // StackpathProvider is a struct that implements the virtual-kubelet provider interface
@@ -41,6 +50,9 @@ type StackpathProvider struct {
 	configMapLister corev1listers.ConfigMapLister
 	podLister       corev1listers.PodLister
 
+	// the client the pods are annotated with
+	podsClient corev1client.PodsGetter
+
 	stackpathClient *workload_client.EdgeCompute
 	apiConfig       *config.Config
 	cpu             string
@@ -52,33 +64,58 @@ type StackpathProvider struct {
 	startTime       time.Time
 	internalIP      string
 
+	// the StackPath location of the city code of the provider, once loaded
+	location *workload_models.Workloadv1Location
+	// the catalogue of the StackPath locations, which the locations of the pods running in several of them are
+	// resolved from
+	locations []*workload_models.Workloadv1Location
+
 	podsTracker *PodsTracker
 
+	execBackend ExecBackend
+
+	entrypointResolver *registry.Resolver
+
+	eventRecorder record.EventRecorder
+
+	statsCache statsSummaryCache
+
 	logger log.Logger
 }
 
 // NewStackpathProvider creates a stackpath virtual kubelet provider
-func NewStackpathProvider(ctx context.Context, stackpathClient *workload_client.EdgeCompute, apiConfig *config.Config, providerConfig nodeutil.ProviderConfig, internalIP string) (*StackpathProvider, error) {
+func NewStackpathProvider(ctx context.Context, stackpathClient *workload_client.EdgeCompute, apiConfig *config.Config, providerConfig nodeutil.ProviderConfig, podsClient corev1client.PodsGetter, eventRecorder record.EventRecorder, internalIP string) (*StackpathProvider, error) {
 	log.G(ctx).Debug("creating a new StackPath provider")
 	var provider StackpathProvider
 	provider.configMapLister = providerConfig.ConfigMaps
 	provider.secretLister = providerConfig.Secrets
 	provider.podLister = providerConfig.Pods
+	provider.podsClient = podsClient
 	provider.stackpathClient = stackpathClient
 	provider.nodeName = providerConfig.Node.Name
 	provider.startTime = time.Now()
 	provider.apiConfig = apiConfig
 	provider.internalIP = internalIP
+	provider.eventRecorder = eventRecorder
 	provider.setNodeCapacity()
 	provider.logger = log.G(ctx)
 
+	execBackend, err := newExecBackend(apiConfig)
+	if err != nil {
+		return nil, err
+	}
+	provider.execBackend = execBackend
+	provider.entrypointResolver = registry.NewResolver(&http.Client{Timeout: registryTimeout})
+
 	return &provider, nil
 }
 
 // CreatePod takes a Kubernetes Pod and deploys it within the provider.
 func (p *StackpathProvider) CreatePod(ctx context.Context, pod *v1.Pod) error {
+	// the instance sizes are recorded before the translation, which fails for the containers the policy rejects
+	p.recordInstanceSizes(pod)
 
-	w, err := p.getWorkloadFrom(pod)
+	w, err := p.getWorkloadFrom(ctx, pod)
 	if err != nil {
 		return err
 	}
@@ -87,13 +124,19 @@ func (p *StackpathProvider) CreatePod(ctx context.Context, pod *v1.Pod) error {
 	if err != nil {
 		return err
 	}
+
+	p.recordExecProbes(pod)
+	p.recordReadOnlyMounts(pod)
+	p.recordRestartPolicy(pod)
+	p.annotateInstanceSizes(ctx, pod)
 	return nil
 }
 
 // UpdatePod takes a Kubernetes Pod and updates it within the provider.
 func (p *StackpathProvider) UpdatePod(ctx context.Context, pod *v1.Pod) error {
-	// NOP. Not Implemented in this version
-	return nil
+	log.G(ctx).Debugf("updating the pod %s", pod.Name)
+
+	return p.updatePod(ctx, pod)
 }
 
 // DeletePod takes a Kubernetes Pod and deletes it from the provider.
@@ -118,11 +161,6 @@ func (p *StackpathProvider) GetPod(ctx context.Context, namespace, name string)
 		return nil, err
 	}
 
-	instance, err := p.getWorkloadInstance(ctx, namespace, name)
-	if err != nil {
-		return nil, err
-	}
-
 	pod, err := p.podLister.Pods(namespace).Get(name)
 	if err != nil {
 		return nil, err
@@ -130,7 +168,11 @@ func (p *StackpathProvider) GetPod(ctx context.Context, namespace, name string)
 
 	updatedPod := pod.DeepCopy()
 
-	podStatus := p.getK8SPodStatusFrom(ctx, instance)
+	podStatus, err := p.getPodStatus(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+	setPodStatus(pod, podStatus, p.apiConfig.InitGateImage, p.apiConfig.GRPCProbeStrategy)
 	updatedPod.Status = *podStatus
 
 	return updatedPod, nil
@@ -140,12 +182,16 @@ func (p *StackpathProvider) GetPod(ctx context.Context, namespace, name string)
 func (p *StackpathProvider) GetPodStatus(ctx context.Context, namespace, name string) (*v1.PodStatus, error) {
 	log.G(ctx).Debugf("getting the pod's status (namespace: %s, name: %s)", namespace, name)
 
-	instance, err := p.getWorkloadInstance(ctx, namespace, name)
-
+	pod, err := p.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	podStatus, err := p.getPodStatus(ctx, pod)
 	if err != nil {
 		return nil, err
 	}
-	return p.getK8SPodStatusFrom(ctx, instance), nil
+	setPodStatus(pod, podStatus, p.apiConfig.InitGateImage, p.apiConfig.GRPCProbeStrategy)
+	return podStatus, nil
 }
 
 // GetPods retrieves a list of all pods running on the provider.
@@ -209,15 +255,17 @@ func (p *StackpathProvider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 
 // GetContainerLogs returns the logs of a pod by name that is running as a StackPath workload
 func (p *StackpathProvider) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
-	// NOP. Not Implemented in this version
-	return nil, nil
+	log.G(ctx).Debugf("getting the logs of the container %s (namespace: %s, pod: %s)", containerName, namespace, podName)
+
+	return p.getContainerLogs(ctx, namespace, podName, containerName, opts)
 }
 
 // RunInContainer executes a command in a container in the pod, copying data
 // between in/out/err and the container's stdin/stdout/stderr.
 func (p *StackpathProvider) RunInContainer(ctx context.Context, namespace, name, container string, cmd []string, attach api.AttachIO) error {
-	// NOP. Not Implemented in this version
-	return nil
+	log.G(ctx).Debugf("running a command in the container %s (namespace: %s, pod: %s)", container, namespace, name)
+
+	return p.runInContainer(ctx, namespace, name, container, cmd, attach)
 }
 
 // NotifyPods instructs the notifier to call the passed in function when the pod status changes.
@@ -227,6 +275,11 @@ func (p *StackpathProvider) NotifyPods(ctx context.Context, notifierCallback fun
 		podLister:      p.podLister,
 		updateCallback: notifierCallback,
 		handler:        p,
+
+		grpcProbeStrategy: p.apiConfig.GRPCProbeStrategy,
+
+		terminatedWorkloadPolicy: p.apiConfig.TerminatedWorkloadPolicy,
+		initGateImage:            p.apiConfig.InitGateImage,
 	}
 
 	go p.podsTracker.BeginPodTracking(ctx)
@@ -234,6 +287,7 @@ func (p *StackpathProvider) NotifyPods(ctx context.Context, notifierCallback fun
 
 // GetStatsSummary gets the stats for the node, including running pods
 func (p *StackpathProvider) GetStatsSummary(ctx context.Context) (*stats.Summary, error) {
-	// NOP. Not implemented in this version
-	return nil, nil
+	log.G(ctx).Debug("getting the stats summary")
+
+	return p.getStatsSummary(ctx)
 }
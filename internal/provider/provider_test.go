@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"testing"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/metrics"
 	workloads "github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
 	"github.com/stackpath/vk-stackpath-provider/internal/config"
@@ -24,6 +26,8 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -69,7 +73,7 @@ func TestCreatePod(t *testing.T) {
 			description: "successfully creates a workload",
 			pod:         testPod,
 			initMockedCalls: func() {
-				w, _ := provider.getWorkloadFrom(testPod)
+				w, _ := provider.getWorkloadFrom(ctx, testPod)
 				params := workloads.CreateWorkloadParams{
 					Body:    &workload_models.V1CreateWorkloadRequest{Workload: w},
 					StackID: provider.apiConfig.StackID,
@@ -83,7 +87,7 @@ func TestCreatePod(t *testing.T) {
 			description: "fails to create a workload due to bad probe port",
 			pod:         badPod,
 			initMockedCalls: func() {
-				w, _ := provider.getWorkloadFrom(testPod)
+				w, _ := provider.getWorkloadFrom(ctx, testPod)
 				params := workloads.CreateWorkloadParams{
 					Body:    &workload_models.V1CreateWorkloadRequest{Workload: w},
 					StackID: provider.apiConfig.StackID,
@@ -163,6 +167,128 @@ func TestDeletePod(t *testing.T) {
 	}
 }
 
+func TestUpdatePod(t *testing.T) {
+	podName := fmt.Sprintf("test-pod-%s", uuid.New().String())
+	podNamespace := fmt.Sprintf("test-ns-%s", uuid.New().String())
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	ctx := context.Background()
+
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	stackPathClientMock := workload_client.EdgeCompute{Workloads: wsc}
+
+	provider, err := createTestProvider(ctx, mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), mocks.NewMockPodLister(mockController), &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	testPod := createTestPod(podName, podNamespace)
+	testPod.Labels = map[string]string{"app": "nginx"}
+
+	getWorkloadParams := workloads.GetWorkloadParams{
+		Context:    ctx,
+		StackID:    provider.apiConfig.StackID,
+		WorkloadID: provider.getWorkloadSlug(podNamespace, podName),
+	}
+
+	// getLiveWorkload returns the workload as StackPath would return it for the test pod
+	getLiveWorkload := func(version, image string) *workloads.GetWorkloadOK {
+		w, err := provider.getWorkloadFrom(ctx, testPod)
+		if err != nil {
+			t.Fatal("failed to translate the test pod", err)
+		}
+		w.Metadata.Version = version
+		w.Status = workload_models.V1WorkloadStatusACTIVE.Pointer()
+		container := w.Spec.Containers["nginx"]
+		container.Image = image
+		w.Spec.Containers["nginx"] = container
+		return &workloads.GetWorkloadOK{Payload: &workload_models.V1GetWorkloadResponse{Workload: w}}
+	}
+
+	// expectUpdate asserts the update is made against the given version with the pod's image
+	expectUpdate := func(version string) func(*workloads.UpdateWorkloadParams, interface{}, ...workloads.ClientOption) {
+		return func(params *workloads.UpdateWorkloadParams, _ interface{}, _ ...workloads.ClientOption) {
+			assert.Equal(t, provider.getWorkloadSlug(podNamespace, podName), params.WorkloadID)
+			assert.Equal(t, version, params.Body.Workload.Metadata.Version)
+			assert.Equal(t, "nginx:1.25", params.Body.Workload.Spec.Containers["nginx"].Image)
+			assert.Equal(t, "nginx", params.Body.Workload.Metadata.Labels["app"])
+			assert.Equal(t, workload_models.V1WorkloadStatusACTIVE, *params.Body.Workload.Status)
+		}
+	}
+
+	conflictError := &APIError{statusCode: http.StatusConflict, message: "workload version mismatch"}
+
+	testCases := []struct {
+		description     string
+		initMockedCalls func()
+		expectedError   error
+	}{
+		{
+			description: "doesn't update a workload that is up to date",
+			initMockedCalls: func() {
+				wsc.EXPECT().GetWorkload(&getWorkloadParams, nil).Return(getLiveWorkload("1", "nginx:1.25"), nil).Times(1)
+			},
+			expectedError: nil,
+		},
+		{
+			description: "successfully updates the image of a container",
+			initMockedCalls: func() {
+				wsc.EXPECT().GetWorkload(&getWorkloadParams, nil).Return(getLiveWorkload("1", "nginx:1.24"), nil).Times(1)
+				wsc.EXPECT().UpdateWorkload(gomock.Any(), nil).Do(expectUpdate("1")).Return(nil, nil).Times(1)
+			},
+			expectedError: nil,
+		},
+		{
+			description: "retries the update against a fresh read on conflicts",
+			initMockedCalls: func() {
+				gomock.InOrder(
+					wsc.EXPECT().GetWorkload(&getWorkloadParams, nil).Return(getLiveWorkload("1", "nginx:1.24"), nil).Times(1),
+					wsc.EXPECT().UpdateWorkload(gomock.Any(), nil).Do(expectUpdate("1")).Return(nil, conflictError).Times(1),
+					wsc.EXPECT().GetWorkload(&getWorkloadParams, nil).Return(getLiveWorkload("2", "nginx:1.24"), nil).Times(1),
+					wsc.EXPECT().UpdateWorkload(gomock.Any(), nil).Do(expectUpdate("2")).Return(nil, nil).Times(1),
+				)
+			},
+			expectedError: nil,
+		},
+		{
+			description: "gives up after too many conflicts",
+			initMockedCalls: func() {
+				wsc.EXPECT().GetWorkload(&getWorkloadParams, nil).Return(getLiveWorkload("1", "nginx:1.24"), nil).Times(workloadUpdateMaxAttempts)
+				wsc.EXPECT().UpdateWorkload(gomock.Any(), nil).Return(nil, conflictError).Times(workloadUpdateMaxAttempts)
+			},
+			expectedError: conflictError,
+		},
+		{
+			description: "fails to update a workload",
+			initMockedCalls: func() {
+				wsc.EXPECT().GetWorkload(&getWorkloadParams, nil).Return(getLiveWorkload("1", "nginx:1.24"), nil).Times(1)
+				wsc.EXPECT().UpdateWorkload(gomock.Any(), nil).Return(nil, errors.New("API call failed")).Times(1)
+			},
+			expectedError: errors.New("API call failed"),
+		},
+		{
+			description: "fails to get the workload",
+			initMockedCalls: func() {
+				wsc.EXPECT().GetWorkload(&getWorkloadParams, nil).Return(nil, errors.New("API call failed")).Times(1)
+			},
+			expectedError: errors.New("API call failed"),
+		},
+	}
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			c.initMockedCalls()
+			pod := testPod.DeepCopy()
+			pod.Spec.Containers[0].Image = "nginx:1.25"
+			err := provider.UpdatePod(ctx, pod)
+			if err != nil {
+				assert.Equal(t, c.expectedError.Error(), err.Error())
+			} else {
+				assert.Equal(t, c.expectedError, nil)
+			}
+		})
+	}
+}
+
 func TestGetPodStatus(t *testing.T) {
 	podName := "test-pod"
 	podNamespace := "test-ns"
@@ -172,12 +298,17 @@ func TestGetPodStatus(t *testing.T) {
 
 	isc := mocks.NewInstanceClientService(mockController)
 	stackPathClientMock := workload_client.EdgeCompute{Instance: isc}
+	podLister := mocks.NewMockPodLister(mockController)
+	mockPodsNamespaceLister := mocks.NewMockPodNamespaceLister(mockController)
 
-	provider, err := createTestProvider(ctx, mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), mocks.NewMockPodLister(mockController), &stackPathClientMock)
+	provider, err := createTestProvider(ctx, mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), podLister, &stackPathClientMock)
 	if err != nil {
 		t.Fatal("failed to create the test provider", err)
 	}
 
+	podLister.EXPECT().Pods(podNamespace).Return(mockPodsNamespaceLister).AnyTimes()
+	mockPodsNamespaceLister.EXPECT().Get(podName).Return(createTestPod(podName, podNamespace), nil).AnyTimes()
+
 	params := instance.GetWorkloadInstanceParams{
 		Context:      ctx,
 		StackID:      provider.apiConfig.StackID,
@@ -310,6 +441,9 @@ func TestGetPod(t *testing.T) {
 					},
 				}, nil).Times(1)
 
+				activePodsLister.EXPECT().Pods(podNamespace).Return(mockPodsNamespaceLister).Times(1)
+				mockPodsNamespaceLister.EXPECT().Get(podName).Return(pod, nil).Times(1)
+
 				isc.EXPECT().GetWorkloadInstance(gomock.Any(), gomock.Any()).Return(nil, errors.New("API error")).Times(1)
 			},
 			expectedError:    errors.New("API error"),
@@ -333,15 +467,6 @@ func TestGetPod(t *testing.T) {
 					},
 				}, nil).Times(1)
 
-				isc.EXPECT().GetWorkloadInstance(gomock.Any(), gomock.Any()).Return(&instance.GetWorkloadInstanceOK{
-					Payload: &workload_models.V1GetWorkloadInstanceResponse{
-						Instance: &workload_models.Workloadv1Instance{
-							Name:  podName,
-							Phase: workload_models.Workloadv1InstanceInstancePhaseRUNNING.Pointer(),
-						},
-					},
-				}, nil).Times(1)
-
 				activePodsLister.EXPECT().Pods(podNamespace).Return(mockPodsNamespaceLister).Times(1)
 				mockPodsNamespaceLister.EXPECT().Get(podName).Return(nil, errors.New("indexer error")).Times(1)
 			},
@@ -402,7 +527,7 @@ func createTestProvider(ctx context.Context, configMapMocker *mocks.MockConfigMa
 		return nil, err
 	}
 
-	provider, err := NewStackpathProvider(ctx, stackpathClient, apiConfig, cfg, "127.0.0.1")
+	provider, err := NewStackpathProvider(ctx, stackpathClient, apiConfig, cfg, fake.NewSimpleClientset().CoreV1(), record.NewFakeRecorder(100), "127.0.0.1")
 
 	if err != nil {
 		return nil, err
@@ -454,6 +579,32 @@ func createTestInstance(name string, phase *workload_models.Workloadv1InstanceIn
 	return &i
 }
 
+// createTestPodInstance returns an instance of a pod running in several locations or autoscaled, whose nginx
+// container is ready or not, reachable at the IPv4 address given
+func createTestPodInstance(name string, phase workload_models.Workloadv1InstanceInstancePhase, ready bool, ip string) *workload_models.Workloadv1Instance {
+	instance := createTestInstance(name, phase.Pointer(), &workload_models.V1ContainerStatus{Name: "nginx", Ready: ready})
+	instance.Containers = workload_models.V1ContainerSpecMapEntry{"nginx": createTestContainerSpec()}
+	instance.IPAddress = ip
+	instance.IPV6Address = ""
+	return instance
+}
+
+// createTestPodLister returns a pod lister serving the pods given
+func createTestPodLister(mockController *gomock.Controller, pods ...*v1.Pod) *mocks.MockPodLister {
+	podLister := mocks.NewMockPodLister(mockController)
+	podNamespaceListers := map[string]*mocks.MockPodNamespaceLister{}
+	for _, pod := range pods {
+		podNamespaceLister, ok := podNamespaceListers[pod.Namespace]
+		if !ok {
+			podNamespaceLister = mocks.NewMockPodNamespaceLister(mockController)
+			podNamespaceListers[pod.Namespace] = podNamespaceLister
+			podLister.EXPECT().Pods(pod.Namespace).Return(podNamespaceLister).AnyTimes()
+		}
+		podNamespaceLister.EXPECT().Get(pod.Name).Return(pod, nil).AnyTimes()
+	}
+	return podLister
+}
+
 func createTestPod(podName, podNamespace string) *v1.Pod {
 	return &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
@@ -512,3 +663,64 @@ func createTestPod(podName, podNamespace string) *v1.Pod {
 		},
 	}
 }
+
+func createTestWorkloadsResponse(nodeName string, pods ...*v1.Pod) *workloads.GetWorkloadsOK {
+	response := &workloads.GetWorkloadsOK{Payload: &workload_models.V1GetWorkloadsResponse{}}
+	for _, pod := range pods {
+		response.Payload.Results = append(response.Payload.Results, &workload_models.V1Workload{
+			Metadata: &workload_models.V1Metadata{
+				Labels: workload_models.V1StringMapEntry{
+					nodeNameLabelKey:     nodeName,
+					podNamespaceLabelKey: pod.Namespace,
+					podNameLabelKey:      pod.Name,
+				},
+			},
+		})
+	}
+	return response
+}
+
+func createTestMetricsResponse(container, unixTime, cpu, memory string) *metrics.GetMetricsOK {
+	return &metrics.GetMetricsOK{
+		Payload: &workload_models.PrometheusMetrics{
+			Data: &workload_models.MetricsData{
+				Matrix: &workload_models.DataMatrix{
+					Results: []*workload_models.DataMatrixResult{
+						{
+							Metric: map[string]string{metricNameLabel: instanceCPUMetric, metricContainerLabel: container},
+							Values: []*workload_models.DataValue{{UnixTime: unixTime, Value: cpu}},
+						},
+						{
+							Metric: map[string]string{metricNameLabel: instanceMemoryMetric, metricContainerLabel: container},
+							Values: []*workload_models.DataValue{{UnixTime: unixTime, Value: memory}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func createTestContainer(name string) v1.Container {
+	return v1.Container{Name: name, Image: name + ":latest", Command: []string{name}}
+}
+
+func createTestPodWithContainers(initContainers []v1.Container, containers ...v1.Container) *v1.Pod {
+	pod := createTestPod("test-pod", "test-ns")
+	pod.Spec.InitContainers = initContainers
+	pod.Spec.Containers = containers
+	return pod
+}
+
+func createTestPodWithVolumes(volumes []v1.Volume, volumeMounts ...v1.VolumeMount) *v1.Pod {
+	pod := createTestPod("test-pod", "test-ns")
+	pod.Spec.Containers[0].VolumeMounts = volumeMounts
+	pod.Spec.Volumes = volumes
+	return pod
+}
+
+func createTestPodWithAnnotations(annotations map[string]string) *v1.Pod {
+	pod := createTestPod("test-pod", "test-ns")
+	pod.Annotations = annotations
+	return pod
+}
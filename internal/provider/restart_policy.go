@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The reason of the Ready condition of the pods whose containers completed
+	podCompletedReason = "PodCompleted"
+
+	// The reason of the event recorded for the pods run to completion created without init gate
+	restartPolicyNotEnforcedReason = "RestartPolicyNotEnforced"
+)
+
+// The script wrapping the command of the init containers and of the containers of the pods whose restart policy
+// is Never, which is run by /bin/sh the way the init containers are. The command is run once: the container
+// records its failure along with its exit code, and exits with that code whenever StackPath restarts it.
+const neverRestartScript = `if [ -f "$0/%[1]s.failed" ]; then read code < "$0/%[1]s.failed"; exit "$code"; fi; ` +
+	`if [ ! -f "$0/%[1]s.done" ]; then %[2]s"$@"; code=$?; if [ "$code" -ne 0 ]; then echo "$code" > "$0/%[1]s.failed"; exit "$code"; fi; : > "$0/%[1]s.done"; fi; ` +
+	`exec sleep 2147483647`
+
+// isRunToCompletion returns whether the containers of the pod run to completion rather than being restarted
+// whenever they exit, which is the case of the pods of Jobs. StackPath always restarts the containers, so the
+// commands of those containers are wrapped to only run until they complete.
+func isRunToCompletion(pod *v1.Pod) bool {
+	return pod.Spec.RestartPolicy == v1.RestartPolicyNever || pod.Spec.RestartPolicy == v1.RestartPolicyOnFailure
+}
+
+// getRunToCompletionScript returns the script running the command of an init container, or of a container
+// of a pod run to completion, once the script waiting for the previous init container succeeded. The command
+// is run again when it fails unless the restart policy of the pod is Never, and isn't run again once it completed.
+func getRunToCompletionScript(pod *v1.Pod, name, wait string) string {
+	if pod.Spec.RestartPolicy == v1.RestartPolicyNever {
+		return fmt.Sprintf(neverRestartScript, name, wait)
+	}
+	return fmt.Sprintf(initContainerScript, name, wait)
+}
+
+// recordRestartPolicy records a Warning event for the pods run to completion created without init gate, whose
+// containers StackPath restarts whenever they exit, so the pod keeps running rather than succeeding or failing
+func (p *StackpathProvider) recordRestartPolicy(pod *v1.Pod) {
+	if isRunToCompletion(pod) && p.apiConfig.InitGateImage == "" {
+		p.eventRecorder.Eventf(pod, v1.EventTypeWarning, restartPolicyNotEnforcedReason, "the init gate image is not set, the containers of the pod are restarted whenever they exit despite its restart policy %s", pod.Spec.RestartPolicy)
+	}
+}
+
+// setRestartPolicyStatus reports the containers of the pods run to completion that completed, which the init gate
+// reports as ready, as terminated, and the containers that failed when the restart policy of the pod is Never.
+// The pod succeeded once all its containers completed, and failed as soon as one of its containers or of its
+// init containers failed without being restarted. Without init gate image, the pod is reported as it runs.
+func setRestartPolicyStatus(pod *v1.Pod, status *v1.PodStatus, initGateImage string) {
+	if !isRunToCompletion(pod) || initGateImage == "" {
+		return
+	}
+
+	completed := 0
+	failed := false
+	for i := range status.ContainerStatuses {
+		containerStatus := &status.ContainerStatuses[i]
+		switch {
+		case containerStatus.Ready:
+			terminated := &v1.ContainerStateTerminated{ExitCode: 0, Reason: initContainerCompletedReason}
+			if containerStatus.State.Running != nil {
+				terminated.StartedAt = containerStatus.State.Running.StartedAt
+			}
+			containerStatus.State = v1.ContainerState{Terminated: terminated}
+			containerStatus.Ready = false
+			completed++
+		case hasFailedOnce(pod, containerStatus, pod.Status.ContainerStatuses):
+			failed = true
+		}
+	}
+	for i := range status.InitContainerStatuses {
+		initContainerStatus := &status.InitContainerStatuses[i]
+		if initContainerStatus.State.Terminated == nil || initContainerStatus.State.Terminated.Reason != initContainerCompletedReason {
+			failed = failed || hasFailedOnce(pod, initContainerStatus, pod.Status.InitContainerStatuses)
+		}
+	}
+
+	switch {
+	case failed:
+		status.Phase = v1.PodFailed
+	case completed != 0 && completed == len(status.ContainerStatuses):
+		status.Phase = v1.PodSucceeded
+	default:
+		return
+	}
+
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == v1.PodReady {
+			status.Conditions[i].Status = v1.ConditionFalse
+			status.Conditions[i].Reason = podCompletedReason
+			status.Conditions[i].Message = ""
+		}
+	}
+}
+
+// hasFailedOnce returns whether the container of a pod whose restart policy is Never failed, in which case its
+// state is set to the terminated state reporting its exit code. The container failed if it exited with an error,
+// or if StackPath restarted it, which only happens to the containers that failed since the ones that completed
+// keep running. The exit code is the one StackPath or the previous status of the pod reported, if any.
+func hasFailedOnce(pod *v1.Pod, containerStatus *v1.ContainerStatus, previousStatuses []v1.ContainerStatus) bool {
+	if pod.Spec.RestartPolicy != v1.RestartPolicyNever {
+		return false
+	}
+
+	terminated := containerStatus.State.Terminated
+	if terminated != nil && terminated.ExitCode != 0 {
+		return true
+	}
+	if containerStatus.RestartCount == 0 {
+		return false
+	}
+
+	for _, previousStatus := range previousStatuses {
+		if previousStatus.Name == containerStatus.Name && previousStatus.State.Terminated != nil && previousStatus.State.Terminated.ExitCode != 0 {
+			containerStatus.State = previousStatus.State
+			return true
+		}
+	}
+	containerStatus.State = v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+		ExitCode: 1,
+		Reason:   "Error",
+		Message:  "the container failed and was restarted by StackPath before its exit code was reported",
+	}}
+	return true
+}
@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// newJobPod returns a pod with the restart policy given, whose job container runs once
+func newJobPod(restartPolicy v1.RestartPolicy) *v1.Pod {
+	job := createTestContainer("job")
+	job.Args = []string{"--once"}
+	pod := createTestPodWithContainers(nil, job)
+	pod.Spec.RestartPolicy = restartPolicy
+	return pod
+}
+
+func TestRunToCompletion(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	t.Run("runs the containers of the pods whose restart policy is OnFailure until they succeed", func(t *testing.T) {
+		provider.apiConfig.InitGateImage = "stackpath/init-gate:latest"
+		workload, err := provider.getWorkloadFrom(ctx, newJobPod(v1.RestartPolicyOnFailure))
+		assert.NoError(t, err)
+
+		assert.Len(t, workload.Spec.Containers, 2)
+		job := workload.Spec.Containers["job"]
+		assert.Equal(t, []string{"/bin/sh", "-c", `if [ ! -f "$0/job.done" ]; then "$@" || exit; : > "$0/job.done"; fi; exec sleep 2147483647`, initGateMountPath, "job", "--once"}, job.Command)
+		assert.Equal(t, "/init/job", job.ReadinessProbe.HTTPGet.Path)
+		assert.Equal(t, []*workload_models.V1InstanceVolumeMount{{Slug: initGateVolumeName, MountPath: initGateMountPath}}, job.VolumeMounts)
+		assert.Len(t, workload.Spec.VolumeClaimTemplates, 1)
+	})
+
+	t.Run("runs the containers of the pods whose restart policy is Never once", func(t *testing.T) {
+		pod := newJobPod(v1.RestartPolicyNever)
+		pod.Spec.InitContainers = []v1.Container{createTestContainer("fetch")}
+
+		provider.apiConfig.InitGateImage = "stackpath/init-gate:latest"
+		workload, err := provider.getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+
+		assert.Len(t, workload.Spec.Containers, 3)
+		assert.Equal(t, []string{"/bin/sh", "-c", `if [ -f "$0/fetch.failed" ]; then read code < "$0/fetch.failed"; exit "$code"; fi; ` +
+			`if [ ! -f "$0/fetch.done" ]; then "$@"; code=$?; if [ "$code" -ne 0 ]; then echo "$code" > "$0/fetch.failed"; exit "$code"; fi; : > "$0/fetch.done"; fi; ` +
+			`exec sleep 2147483647`, initGateMountPath, "fetch"}, workload.Spec.Containers["fetch"].Command)
+		assert.Equal(t, []string{"/bin/sh", "-c", `if [ -f "$0/job.failed" ]; then read code < "$0/job.failed"; exit "$code"; fi; ` +
+			`if [ ! -f "$0/job.done" ]; then until [ -f "$0/fetch.done" ]; do sleep 1; done; "$@"; code=$?; if [ "$code" -ne 0 ]; then echo "$code" > "$0/job.failed"; exit "$code"; fi; : > "$0/job.done"; fi; ` +
+			`exec sleep 2147483647`, initGateMountPath, "job", "--once"}, workload.Spec.Containers["job"].Command)
+		assert.Equal(t, "/init/job", workload.Spec.Containers["job"].ReadinessProbe.HTTPGet.Path)
+	})
+
+	t.Run("restarts the containers without init gate image", func(t *testing.T) {
+		provider.apiConfig.InitGateImage = ""
+		workload, err := provider.getWorkloadFrom(ctx, newJobPod(v1.RestartPolicyNever))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"job", "--once"}, workload.Spec.Containers["job"].Command)
+		assert.Empty(t, workload.Spec.VolumeClaimTemplates)
+	})
+
+	t.Run("fails without init gate image when the pod has init containers", func(t *testing.T) {
+		pod := newJobPod(v1.RestartPolicyNever)
+		pod.Spec.InitContainers = []v1.Container{createTestContainer("fetch")}
+
+		provider.apiConfig.InitGateImage = ""
+		_, err := provider.getWorkloadFrom(ctx, pod)
+		assert.EqualError(t, err, "init containers are only supported when the init gate image is set")
+	})
+
+	t.Run("records the pods created without init gate image", func(t *testing.T) {
+		provider.apiConfig.InitGateImage = ""
+		provider.recordRestartPolicy(newJobPod(v1.RestartPolicyOnFailure))
+		provider.recordRestartPolicy(newJobPod(v1.RestartPolicyAlways))
+
+		events := provider.eventRecorder.(*record.FakeRecorder).Events
+		assert.Len(t, events, 1)
+		assert.Equal(t, "Warning RestartPolicyNotEnforced the init gate image is not set, the containers of the pod are restarted whenever they exit despite its restart policy OnFailure", <-events)
+	})
+}
+
+func TestSetRestartPolicyStatus(t *testing.T) {
+	running := v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	completed := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: initContainerCompletedReason}}
+	failed := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 3, Reason: "Error"}}
+
+	newStatus := func(statuses ...v1.ContainerStatus) *v1.PodStatus {
+		return &v1.PodStatus{
+			Phase: v1.PodRunning,
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodReady, Status: v1.ConditionTrue},
+			},
+			ContainerStatuses: statuses,
+		}
+	}
+
+	testCases := []struct {
+		description        string
+		restartPolicy      v1.RestartPolicy
+		previousStatuses   []v1.ContainerStatus
+		status             *v1.PodStatus
+		expectedPhase      v1.PodPhase
+		expectedStatuses   []v1.ContainerStatus
+		expectedReadyState v1.ConditionStatus
+	}{
+		{
+			description:        "reports the pod running until its containers completed",
+			restartPolicy:      v1.RestartPolicyNever,
+			status:             newStatus(v1.ContainerStatus{Name: "job", State: running, Ready: true}, v1.ContainerStatus{Name: "worker", State: running}),
+			expectedPhase:      v1.PodRunning,
+			expectedStatuses:   []v1.ContainerStatus{{Name: "job", State: completed}, {Name: "worker", State: running}},
+			expectedReadyState: v1.ConditionTrue,
+		},
+		{
+			description:        "reports the pod succeeded once its containers completed",
+			restartPolicy:      v1.RestartPolicyOnFailure,
+			status:             newStatus(v1.ContainerStatus{Name: "job", State: running, Ready: true, RestartCount: 2}),
+			expectedPhase:      v1.PodSucceeded,
+			expectedStatuses:   []v1.ContainerStatus{{Name: "job", State: completed, RestartCount: 2}},
+			expectedReadyState: v1.ConditionFalse,
+		},
+		{
+			description:        "keeps the pod running while StackPath restarts the containers that failed",
+			restartPolicy:      v1.RestartPolicyOnFailure,
+			status:             newStatus(v1.ContainerStatus{Name: "job", State: failed, RestartCount: 1}),
+			expectedPhase:      v1.PodRunning,
+			expectedStatuses:   []v1.ContainerStatus{{Name: "job", State: failed, RestartCount: 1}},
+			expectedReadyState: v1.ConditionTrue,
+		},
+		{
+			description:        "reports the pod failed once a container failed",
+			restartPolicy:      v1.RestartPolicyNever,
+			status:             newStatus(v1.ContainerStatus{Name: "job", State: failed}),
+			expectedPhase:      v1.PodFailed,
+			expectedStatuses:   []v1.ContainerStatus{{Name: "job", State: failed}},
+			expectedReadyState: v1.ConditionFalse,
+		},
+		{
+			description:        "reports the exit code of the container that failed before StackPath restarted it",
+			restartPolicy:      v1.RestartPolicyNever,
+			previousStatuses:   []v1.ContainerStatus{{Name: "job", State: failed}},
+			status:             newStatus(v1.ContainerStatus{Name: "job", State: running, RestartCount: 1}),
+			expectedPhase:      v1.PodFailed,
+			expectedStatuses:   []v1.ContainerStatus{{Name: "job", State: failed, RestartCount: 1}},
+			expectedReadyState: v1.ConditionFalse,
+		},
+		{
+			description:   "reports the container restarted by StackPath as failed",
+			restartPolicy: v1.RestartPolicyNever,
+			status:        newStatus(v1.ContainerStatus{Name: "job", State: running, RestartCount: 1}),
+			expectedPhase: v1.PodFailed,
+			expectedStatuses: []v1.ContainerStatus{{Name: "job", RestartCount: 1, State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+				ExitCode: 1,
+				Reason:   "Error",
+				Message:  "the container failed and was restarted by StackPath before its exit code was reported",
+			}}}},
+			expectedReadyState: v1.ConditionFalse,
+		},
+		{
+			description:        "leaves the status of the pods whose restart policy is Always unchanged",
+			restartPolicy:      v1.RestartPolicyAlways,
+			status:             newStatus(v1.ContainerStatus{Name: "job", State: running, Ready: true, RestartCount: 1}),
+			expectedPhase:      v1.PodRunning,
+			expectedStatuses:   []v1.ContainerStatus{{Name: "job", State: running, Ready: true, RestartCount: 1}},
+			expectedReadyState: v1.ConditionTrue,
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			pod := newJobPod(c.restartPolicy)
+			pod.Status.ContainerStatuses = c.previousStatuses
+
+			setRestartPolicyStatus(pod, c.status, "stackpath/init-gate:latest")
+
+			assert.Equal(t, c.expectedPhase, c.status.Phase)
+			assert.Equal(t, c.expectedStatuses, c.status.ContainerStatuses)
+			assert.Equal(t, c.expectedReadyState, c.status.Conditions[0].Status)
+		})
+	}
+
+	t.Run("reports the pod failed once an init container failed", func(t *testing.T) {
+		pod := newJobPod(v1.RestartPolicyNever)
+		status := newStatus(v1.ContainerStatus{Name: "job", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: podInitializingReason}}})
+		status.InitContainerStatuses = []v1.ContainerStatus{{Name: "fetch", State: failed}}
+
+		setRestartPolicyStatus(pod, status, "stackpath/init-gate:latest")
+		assert.Equal(t, v1.PodFailed, status.Phase)
+		assert.Equal(t, podCompletedReason, status.Conditions[0].Reason)
+	})
+
+	t.Run("reports the pod created without init gate as it runs", func(t *testing.T) {
+		pod := newJobPod(v1.RestartPolicyNever)
+		status := newStatus(v1.ContainerStatus{Name: "job", State: running, Ready: true, RestartCount: 1})
+
+		setRestartPolicyStatus(pod, status, "")
+		assert.Equal(t, v1.PodRunning, status.Phase)
+		assert.Equal(t, []v1.ContainerStatus{{Name: "job", State: running, Ready: true, RestartCount: 1}}, status.ContainerStatuses)
+	})
+}
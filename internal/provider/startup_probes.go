@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	v1 "k8s.io/api/core/v1"
+)
+
+// The values Kubernetes defaults the fields of a probe to
+const (
+	defaultProbePeriodSeconds    = 10
+	defaultProbeFailureThreshold = 3
+)
+
+// translateStartupProbes emulates the startup probes of the pod's containers, which StackPath doesn't support,
+// by holding off the liveness probes of the translated containers for the time the startup probes allow the
+// containers to start in. The liveness probes are part of the workload from the start, since adding them once
+// the containers started would update the workload, which StackPath rolls out by replacing its instances.
+func (p *StackpathProvider) translateStartupProbes(pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry) {
+	for _, k8sContainer := range getLongRunningContainers(pod) {
+		if k8sContainer.StartupProbe == nil {
+			continue
+		}
+		container := containers[k8sContainer.Name]
+		if container.LivenessProbe == nil {
+			continue
+		}
+
+		livenessProbe := *container.LivenessProbe
+		livenessProbe.InitialDelaySeconds += getStartupBudgetSeconds(k8sContainer.StartupProbe)
+		container.LivenessProbe = &livenessProbe
+		containers[k8sContainer.Name] = container
+	}
+}
+
+// getStartupBudgetSeconds returns the longest time the startup probe allows a container to start in
+func getStartupBudgetSeconds(probe *v1.Probe) int32 {
+	periodSeconds := probe.PeriodSeconds
+	if periodSeconds == 0 {
+		periodSeconds = defaultProbePeriodSeconds
+	}
+	failureThreshold := probe.FailureThreshold
+	if failureThreshold == 0 {
+		failureThreshold = defaultProbeFailureThreshold
+	}
+	return probe.InitialDelaySeconds + failureThreshold*periodSeconds
+}
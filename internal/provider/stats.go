@@ -0,0 +1,373 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/metrics"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	stats "github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// metricNameLabel is the label holding the name of an INSTANCE metric series
+	metricNameLabel = "__name__"
+
+	// metricContainerLabel is the label holding the name of the container an
+	// INSTANCE metric series belongs to. Series without it describe the whole instance.
+	metricContainerLabel = "container"
+
+	// instanceCPUMetric is the CPU usage of an instance or container, in cores
+	instanceCPUMetric = "cpu"
+
+	// instanceMemoryMetric is the memory usage of an instance or container, in bytes
+	instanceMemoryMetric = "memory"
+
+	// instanceMetricsWindow is how far back to look for the latest INSTANCE metrics sample
+	instanceMetricsWindow = 5 * time.Minute
+)
+
+// statsSummaryCache holds the latest stats summary built for the node
+type statsSummaryCache struct {
+	sync.Mutex
+	summary   *stats.Summary
+	updatedAt time.Time
+	// cpuUsage holds the cumulative CPU usage of the node, its pods and their containers
+	cpuUsage map[string]*cpuUsageCounter
+}
+
+// cpuUsageCounter accumulates CPU usage samples into the cumulative CPU time
+// that Kubernetes expects, as StackPath only reports the current usage in cores.
+type cpuUsageCounter struct {
+	coreNanoSeconds uint64
+	sampledAt       time.Time
+}
+
+// resourceUsage is the latest CPU and memory usage sample of an instance or container
+type resourceUsage struct {
+	time         time.Time
+	cpuNanoCores *uint64
+	memoryBytes  *uint64
+}
+
+// podResourceUsage is the resource usage of a workload instance and its containers
+type podResourceUsage struct {
+	resourceUsage
+	containers map[string]*resourceUsage
+}
+
+// getStatsSummary returns the stats summary of the node and all the pods it runs on StackPath.
+// The summary is cached for the configured TTL, so the scrapes don't each query the metrics of every instance.
+func (p *StackpathProvider) getStatsSummary(ctx context.Context) (*stats.Summary, error) {
+	p.statsCache.Lock()
+	defer p.statsCache.Unlock()
+
+	if p.statsCache.summary != nil && time.Since(p.statsCache.updatedAt) < time.Duration(p.apiConfig.StatsCacheTTLSeconds)*time.Second {
+		return p.statsCache.summary, nil
+	}
+
+	workloads, err := p.getWorkloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	summary := &stats.Summary{
+		Node: stats.NodeStats{
+			NodeName:  p.nodeName,
+			StartTime: metav1.NewTime(p.startTime),
+		},
+		Pods: make([]stats.PodStats, 0, len(workloads)),
+	}
+	node := resourceUsage{time: now, cpuNanoCores: new(uint64), memoryBytes: new(uint64)}
+	cpuUsage := map[string]*cpuUsageCounter{}
+
+	for _, workload := range workloads {
+		// Only use workloads that were created by this provider
+		if workload.Metadata == nil || workload.Metadata.Labels[nodeNameLabelKey] != p.nodeName {
+			continue
+		}
+
+		podNamespace := workload.Metadata.Labels[podNamespaceLabelKey]
+		podName := workload.Metadata.Labels[podNameLabelKey]
+
+		pod, err := p.podLister.Pods(podNamespace).Get(podName)
+		if err != nil {
+			log.G(ctx).WithError(err).Debugf("skipping stats of the pod %s/%s", podNamespace, podName)
+			continue
+		}
+
+		usage, err := p.getPodResourceUsage(ctx, pod)
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("couldn't get the metrics of the pod %s/%s", podNamespace, podName)
+			continue
+		}
+
+		podStats := stats.PodStats{
+			PodRef: stats.PodReference{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+				UID:       string(pod.UID),
+			},
+			StartTime:  pod.CreationTimestamp,
+			Containers: make([]stats.ContainerStats, 0, len(pod.Spec.Containers)),
+			CPU:        usage.cpuStats(),
+			Memory:     usage.memoryStats(),
+		}
+		if pod.Status.StartTime != nil {
+			podStats.StartTime = *pod.Status.StartTime
+		}
+		p.accumulateCPUUsage(cpuUsage, podStats.CPU, pod.Namespace, pod.Name)
+
+		for _, container := range pod.Spec.Containers {
+			containerUsage, ok := usage.containers[container.Name]
+			if !ok {
+				continue
+			}
+			containerStats := stats.ContainerStats{
+				Name:      container.Name,
+				StartTime: podStats.StartTime,
+				CPU:       containerUsage.cpuStats(),
+				Memory:    containerUsage.memoryStats(),
+			}
+			p.accumulateCPUUsage(cpuUsage, containerStats.CPU, pod.Namespace, pod.Name, container.Name)
+			podStats.Containers = append(podStats.Containers, containerStats)
+		}
+
+		summary.Pods = append(summary.Pods, podStats)
+		node.add(&usage.resourceUsage)
+	}
+
+	summary.Node.CPU = node.cpuStats()
+	summary.Node.Memory = node.memoryStats()
+	p.accumulateCPUUsage(cpuUsage, summary.Node.CPU)
+
+	// Counters of pods that are gone are dropped along with the previous map
+	p.statsCache.cpuUsage = cpuUsage
+	p.statsCache.summary = summary
+	p.statsCache.updatedAt = now
+
+	return summary, nil
+}
+
+// accumulateCPUUsage sets the cumulative CPU usage of the CPU stats identified by the keys.
+// The usage reported by the latest sample is assumed to have lasted since the previous sample,
+// so the counter starts at zero the first time the node, a pod or a container is seen.
+func (p *StackpathProvider) accumulateCPUUsage(counters map[string]*cpuUsageCounter, cpu *stats.CPUStats, keys ...string) {
+	if cpu == nil || cpu.UsageNanoCores == nil {
+		return
+	}
+
+	key := strings.Join(keys, "/")
+	counter, ok := p.statsCache.cpuUsage[key]
+	if !ok {
+		counter = &cpuUsageCounter{sampledAt: cpu.Time.Time}
+	}
+	if elapsed := cpu.Time.Sub(counter.sampledAt); elapsed > 0 {
+		counter.coreNanoSeconds += uint64(float64(*cpu.UsageNanoCores) * elapsed.Seconds())
+		counter.sampledAt = cpu.Time.Time
+	}
+	counters[key] = counter
+
+	coreNanoSeconds := counter.coreNanoSeconds
+	cpu.UsageCoreNanoSeconds = &coreNanoSeconds
+}
+
+// getPodResourceUsage returns the latest CPU and memory usage of the pod. The usage of the pods running several
+// instances is the sum of the usage of their running instances.
+func (p *StackpathProvider) getPodResourceUsage(ctx context.Context, pod *v1.Pod) (*podResourceUsage, error) {
+	if !hasSeveralInstances(pod) {
+		return p.getInstanceResourceUsage(ctx, pod.Namespace, pod.Name, p.getInstanceName(pod.Namespace, pod.Name))
+	}
+
+	podInstances, err := p.getWorkloadInstances(ctx, pod.Namespace, pod.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &podResourceUsage{containers: map[string]*resourceUsage{}}
+	for _, instance := range podInstances {
+		if !isInstanceRunning(instance) {
+			continue
+		}
+		instanceUsage, err := p.getInstanceResourceUsage(ctx, pod.Namespace, pod.Name, instance.Name)
+		if err != nil {
+			return nil, err
+		}
+		usage.add(&instanceUsage.resourceUsage)
+		for name, containerUsage := range instanceUsage.containers {
+			if _, ok := usage.containers[name]; !ok {
+				usage.containers[name] = &resourceUsage{}
+			}
+			usage.containers[name].add(containerUsage)
+		}
+	}
+	return usage, nil
+}
+
+// getInstanceResourceUsage returns the latest CPU and memory usage of an instance of the pod.
+func (p *StackpathProvider) getInstanceResourceUsage(ctx context.Context, namespace, name, instanceName string) (*podResourceUsage, error) {
+	metricsType := string(workload_models.V1GetMetricsRequestTypeINSTANCE)
+	workloadID := p.getWorkloadSlug(namespace, name)
+	endDate := strfmt.DateTime(time.Now())
+	startDate := strfmt.DateTime(time.Time(endDate).Add(-instanceMetricsWindow))
+
+	params := &metrics.GetMetricsParams{
+		Context:      ctx,
+		StackID:      p.apiConfig.StackID,
+		Type:         &metricsType,
+		WorkloadID:   &workloadID,
+		InstanceName: &instanceName,
+		StartDate:    &startDate,
+		EndDate:      &endDate,
+	}
+
+	response, err := p.stackpathClient.Metrics.GetMetrics(params, nil)
+	if err != nil {
+		return nil, NewStackPathError(err)
+	}
+
+	usage := &podResourceUsage{containers: map[string]*resourceUsage{}}
+	if response.Payload == nil || response.Payload.Data == nil {
+		return usage, nil
+	}
+
+	data := response.Payload.Data
+	if data.Vector != nil {
+		for _, result := range data.Vector.Results {
+			usage.record(result.Metric, result.Value)
+		}
+	}
+	if data.Matrix != nil {
+		for _, result := range data.Matrix.Results {
+			usage.record(result.Metric, latestDataValue(result.Values))
+		}
+	}
+
+	// Not every series is reported per instance, so fall back to the sum of its containers
+	if usage.cpuNanoCores == nil || usage.memoryBytes == nil {
+		total := resourceUsage{}
+		for _, containerUsage := range usage.containers {
+			total.add(containerUsage)
+		}
+		if usage.cpuNanoCores == nil {
+			usage.cpuNanoCores = total.cpuNanoCores
+		}
+		if usage.memoryBytes == nil {
+			usage.memoryBytes = total.memoryBytes
+		}
+		if usage.time.IsZero() {
+			usage.time = total.time
+		}
+	}
+
+	return usage, nil
+}
+
+// record stores a single metric sample either at the instance or at the container level.
+func (u *podResourceUsage) record(labels map[string]string, value *workload_models.DataValue) {
+	if value == nil {
+		return
+	}
+
+	sample, err := strconv.ParseFloat(value.Value, 64)
+	if err != nil || sample < 0 {
+		return
+	}
+
+	target := &u.resourceUsage
+	if container := labels[metricContainerLabel]; container != "" {
+		if _, ok := u.containers[container]; !ok {
+			u.containers[container] = &resourceUsage{}
+		}
+		target = u.containers[container]
+	}
+
+	if unixTime, err := strconv.ParseFloat(value.UnixTime, 64); err == nil {
+		sec, dec := math.Modf(unixTime)
+		sampleTime := time.Unix(int64(sec), int64(dec*1e9))
+		if sampleTime.After(target.time) {
+			target.time = sampleTime
+		}
+	}
+
+	switch labels[metricNameLabel] {
+	case instanceCPUMetric:
+		nanoCores := uint64(sample * 1e9)
+		target.cpuNanoCores = &nanoCores
+	case instanceMemoryMetric:
+		bytes := uint64(sample)
+		target.memoryBytes = &bytes
+	}
+}
+
+// add accumulates another usage sample into this one.
+func (u *resourceUsage) add(other *resourceUsage) {
+	if other.cpuNanoCores != nil {
+		total := *other.cpuNanoCores
+		if u.cpuNanoCores != nil {
+			total += *u.cpuNanoCores
+		}
+		u.cpuNanoCores = &total
+	}
+	if other.memoryBytes != nil {
+		total := *other.memoryBytes
+		if u.memoryBytes != nil {
+			total += *u.memoryBytes
+		}
+		u.memoryBytes = &total
+	}
+	if other.time.After(u.time) {
+		u.time = other.time
+	}
+}
+
+func (u *resourceUsage) cpuStats() *stats.CPUStats {
+	if u.cpuNanoCores == nil {
+		return nil
+	}
+	return &stats.CPUStats{
+		Time:           metav1.NewTime(u.time),
+		UsageNanoCores: u.cpuNanoCores,
+	}
+}
+
+func (u *resourceUsage) memoryStats() *stats.MemoryStats {
+	if u.memoryBytes == nil {
+		return nil
+	}
+	// StackPath reports a single memory figure, which is what the working set is used for
+	return &stats.MemoryStats{
+		Time:            metav1.NewTime(u.time),
+		UsageBytes:      u.memoryBytes,
+		WorkingSetBytes: u.memoryBytes,
+	}
+}
+
+// latestDataValue returns the most recent data point of a time series.
+func latestDataValue(values []*workload_models.DataValue) *workload_models.DataValue {
+	var latest *workload_models.DataValue
+	var latestTime float64
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		unixTime, err := strconv.ParseFloat(value.UnixTime, 64)
+		if err != nil {
+			continue
+		}
+		if latest == nil || unixTime >= latestTime {
+			latest = value
+			latestTime = unixTime
+		}
+	}
+	return latest
+}
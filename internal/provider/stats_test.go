@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instances"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/metrics"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	stats "github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestGetStatsSummary(t *testing.T) {
+	podName := "test-pod"
+	podNamespace := "test-ns"
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+	ctx := context.Background()
+
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	msc := mocks.NewMetricsClientService(mockController)
+	podLister := mocks.NewMockPodLister(mockController)
+	podNamespaceLister := mocks.NewMockPodNamespaceLister(mockController)
+	stackPathClientMock := workload_client.EdgeCompute{Workloads: wsc, Metrics: msc}
+
+	provider, err := createTestProvider(ctx, mocks.NewMockConfigMapLister(mockController), mocks.NewMockSecretLister(mockController), podLister, &stackPathClientMock)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := createTestPod(podName, podNamespace)
+	pod.UID = types.UID("a7188caa-e29b-11ed-b5ea-0242ac120002")
+
+	// the workloads of other nodes are skipped
+	workloadsResponse := createTestWorkloadsResponse(provider.nodeName, pod)
+	otherWorkloads := createTestWorkloadsResponse("another-node", createTestPod("another-pod", podNamespace))
+	workloadsResponse.Payload.Results = append(workloadsResponse.Payload.Results, otherWorkloads.Payload.Results...)
+
+	metricsResponse := &metrics.GetMetricsOK{
+		Payload: &workload_models.PrometheusMetrics{
+			Data: &workload_models.MetricsData{
+				Matrix: &workload_models.DataMatrix{
+					Results: []*workload_models.DataMatrixResult{
+						{
+							Metric: map[string]string{metricNameLabel: instanceCPUMetric, metricContainerLabel: "nginx"},
+							Values: []*workload_models.DataValue{
+								{UnixTime: "1683000000", Value: "0.1"},
+								{UnixTime: "1683000060", Value: "0.25"},
+							},
+						},
+						{
+							Metric: map[string]string{metricNameLabel: instanceMemoryMetric, metricContainerLabel: "nginx"},
+							Values: []*workload_models.DataValue{
+								{UnixTime: "1683000060", Value: "1048576"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("successfully builds the summary from the instance metrics", func(t *testing.T) {
+		provider.statsCache = statsSummaryCache{}
+
+		wsc.EXPECT().GetWorkloads(gomock.Any(), nil).Return(workloadsResponse, nil).Times(1)
+		podLister.EXPECT().Pods(podNamespace).Return(podNamespaceLister).Times(1)
+		podNamespaceLister.EXPECT().Get(podName).Return(pod, nil).Times(1)
+		msc.EXPECT().GetMetrics(gomock.Any(), nil).DoAndReturn(
+			func(params *metrics.GetMetricsParams, _ interface{}, _ ...metrics.ClientOption) (*metrics.GetMetricsOK, error) {
+				assert.Equal(t, string(workload_models.V1GetMetricsRequestTypeINSTANCE), *params.Type)
+				assert.Equal(t, provider.getWorkloadSlug(podNamespace, podName), *params.WorkloadID)
+				assert.Equal(t, provider.getInstanceName(podNamespace, podName), *params.InstanceName)
+				return metricsResponse, nil
+			},
+		).Times(1)
+
+		summary, err := provider.GetStatsSummary(ctx)
+		assert.NoError(t, err)
+
+		assert.Equal(t, provider.nodeName, summary.Node.NodeName)
+		assert.Equal(t, uint64(250000000), *summary.Node.CPU.UsageNanoCores)
+		assert.Equal(t, uint64(1048576), *summary.Node.Memory.WorkingSetBytes)
+		assert.NotNil(t, summary.Node.CPU.UsageCoreNanoSeconds)
+
+		assert.Len(t, summary.Pods, 1)
+		podStats := summary.Pods[0]
+		assert.Equal(t, podName, podStats.PodRef.Name)
+		assert.Equal(t, podNamespace, podStats.PodRef.Namespace)
+		assert.Equal(t, string(pod.UID), podStats.PodRef.UID)
+		assert.Equal(t, uint64(250000000), *podStats.CPU.UsageNanoCores)
+		assert.Equal(t, uint64(1048576), *podStats.Memory.UsageBytes)
+		assert.Equal(t, time.Unix(1683000060, 0), podStats.CPU.Time.Time)
+
+		assert.Len(t, podStats.Containers, 1)
+		assert.Equal(t, "nginx", podStats.Containers[0].Name)
+		assert.Equal(t, uint64(250000000), *podStats.Containers[0].CPU.UsageNanoCores)
+		assert.Equal(t, uint64(1048576), *podStats.Containers[0].Memory.WorkingSetBytes)
+	})
+
+	t.Run("serves the summary from the cache", func(t *testing.T) {
+		provider.statsCache = statsSummaryCache{}
+
+		wsc.EXPECT().GetWorkloads(gomock.Any(), nil).Return(workloadsResponse, nil).Times(1)
+		podLister.EXPECT().Pods(podNamespace).Return(podNamespaceLister).Times(1)
+		podNamespaceLister.EXPECT().Get(podName).Return(pod, nil).Times(1)
+		msc.EXPECT().GetMetrics(gomock.Any(), nil).Return(metricsResponse, nil).Times(1)
+
+		first, err := provider.GetStatsSummary(ctx)
+		assert.NoError(t, err)
+		second, err := provider.GetStatsSummary(ctx)
+		assert.NoError(t, err)
+		assert.Same(t, first, second)
+	})
+
+	t.Run("skips pods whose metrics can't be retrieved", func(t *testing.T) {
+		provider.statsCache = statsSummaryCache{}
+
+		wsc.EXPECT().GetWorkloads(gomock.Any(), nil).Return(workloadsResponse, nil).Times(1)
+		podLister.EXPECT().Pods(podNamespace).Return(podNamespaceLister).Times(1)
+		podNamespaceLister.EXPECT().Get(podName).Return(pod, nil).Times(1)
+		msc.EXPECT().GetMetrics(gomock.Any(), nil).Return(nil, errors.New("API error")).Times(1)
+
+		summary, err := provider.GetStatsSummary(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, summary.Pods, 0)
+		assert.Equal(t, uint64(0), *summary.Node.CPU.UsageNanoCores)
+	})
+
+	t.Run("fails when the workloads can't be listed", func(t *testing.T) {
+		provider.statsCache = statsSummaryCache{}
+
+		wsc.EXPECT().GetWorkloads(gomock.Any(), nil).Return(nil, errors.New("API error")).Times(1)
+
+		_, err := provider.GetStatsSummary(ctx)
+		assert.EqualError(t, err, "API error")
+	})
+}
+
+func TestGetMultiLocationPodResourceUsage(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	isc := mocks.NewInstancesClientService(mockController)
+	msc := mocks.NewMetricsClientService(mockController)
+	provider, err := createTestProvider(ctx, nil, nil, nil, &workload_client.EdgeCompute{Instances: isc, Metrics: msc})
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	isc.EXPECT().GetWorkloadInstances(gomock.Any(), nil).Return(&instances.GetWorkloadInstancesOK{
+		Payload: &workload_models.V1GetWorkloadInstancesResponse{
+			Results: []*workload_models.Workloadv1Instance{
+				createTestPodInstance("test-ns-test-pod-city-code-jfk-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.1"),
+				createTestPodInstance("test-ns-test-pod-city-code-ams-ams-0", workload_models.Workloadv1InstanceInstancePhaseRUNNING, true, "10.0.0.2"),
+				createTestPodInstance("test-ns-test-pod-city-code-dfw-dfw-0", workload_models.Workloadv1InstanceInstancePhaseSTARTING, false, ""),
+			},
+		},
+	}, nil).Times(1)
+	// the metrics are read for each running instance
+	msc.EXPECT().GetMetrics(gomock.Any(), nil).DoAndReturn(
+		func(params *metrics.GetMetricsParams, _ interface{}, _ ...metrics.ClientOption) (*metrics.GetMetricsOK, error) {
+			switch *params.InstanceName {
+			case "test-ns-test-pod-city-code-jfk-0":
+				return createTestMetricsResponse("nginx", "1683000000", "0.5", "1024"), nil
+			case "test-ns-test-pod-city-code-ams-ams-0":
+				return createTestMetricsResponse("nginx", "1683000010", "0.25", "2048"), nil
+			}
+			t.Errorf("unexpected metrics of the instance %s", *params.InstanceName)
+			return nil, errors.New("API error")
+		}).Times(2)
+
+	usage, err := provider.getPodResourceUsage(ctx, createTestPodWithAnnotations(map[string]string{cityCodesAnnotation: "AMS,DFW"}))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(750000000), *usage.cpuNanoCores)
+	assert.Equal(t, uint64(3072), *usage.memoryBytes)
+	assert.Equal(t, time.Unix(1683000010, 0), usage.time)
+	assert.Equal(t, uint64(750000000), *usage.containers["nginx"].cpuNanoCores)
+	assert.Equal(t, uint64(3072), *usage.containers["nginx"].memoryBytes)
+}
+
+func TestPodResourceUsageFallsBackToContainers(t *testing.T) {
+	usage := &podResourceUsage{containers: map[string]*resourceUsage{}}
+	usage.record(map[string]string{metricNameLabel: instanceCPUMetric, metricContainerLabel: "app"}, &workload_models.DataValue{UnixTime: "1683000000", Value: "0.5"})
+	usage.record(map[string]string{metricNameLabel: instanceCPUMetric, metricContainerLabel: "sidecar"}, &workload_models.DataValue{UnixTime: "1683000000", Value: "0.25"})
+	usage.record(map[string]string{metricNameLabel: instanceMemoryMetric}, &workload_models.DataValue{UnixTime: "1683000000", Value: "2048"})
+	usage.record(map[string]string{metricNameLabel: instanceMemoryMetric}, &workload_models.DataValue{UnixTime: "1683000000", Value: "not a number"})
+
+	assert.Nil(t, usage.cpuNanoCores)
+	assert.Equal(t, uint64(2048), *usage.memoryBytes)
+	assert.Equal(t, uint64(500000000), *usage.containers["app"].cpuNanoCores)
+	assert.Equal(t, uint64(250000000), *usage.containers["sidecar"].cpuNanoCores)
+}
+
+func TestAccumulateCPUUsage(t *testing.T) {
+	provider := &StackpathProvider{}
+	sampledAt := time.Unix(1683000000, 0)
+	cpuStats := func(at time.Time, nanoCores uint64) *stats.CPUStats {
+		return &stats.CPUStats{Time: metav1.NewTime(at), UsageNanoCores: &nanoCores}
+	}
+
+	counters := map[string]*cpuUsageCounter{}
+	first := cpuStats(sampledAt, 500000000)
+	provider.accumulateCPUUsage(counters, first, "test-ns", "test-pod")
+	assert.Equal(t, uint64(0), *first.UsageCoreNanoSeconds)
+	provider.statsCache.cpuUsage = counters
+
+	counters = map[string]*cpuUsageCounter{}
+	second := cpuStats(sampledAt.Add(10*time.Second), 500000000)
+	provider.accumulateCPUUsage(counters, second, "test-ns", "test-pod")
+	assert.Equal(t, uint64(5000000000), *second.UsageCoreNanoSeconds)
+	provider.statsCache.cpuUsage = counters
+
+	// The same sample must not be accounted for twice
+	counters = map[string]*cpuUsageCounter{}
+	third := cpuStats(sampledAt.Add(10*time.Second), 500000000)
+	provider.accumulateCPUUsage(counters, third, "test-ns", "test-pod")
+	assert.Equal(t, uint64(5000000000), *third.UsageCoreNanoSeconds)
+	assert.Len(t, counters, 1)
+}
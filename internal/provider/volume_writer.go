@@ -0,0 +1,353 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The name of the sidecar container writing the files of the ConfigMap, Secret, projected
+	// and downward API volumes of a pod, which StackPath doesn't support, into volume claims
+	volumeWriterContainerName = "volume-writer"
+
+	// The environment variable listing the volumes the volume writer writes, and the prefix of
+	// the environment variables holding the files of each volume
+	volumeWriterVolumesEnvVar     = "VOLUME_WRITER_VOLUMES"
+	volumeWriterFilesEnvVarPrefix = "VOLUME_WRITER_FILES_"
+
+	// The directory the volume writer mounts the volume claims in
+	volumeWriterMountPathPrefix = "/volumes/"
+
+	// The annotation of the workload holding the checksum of the files of its volumes, which
+	// tells whether the workload must be updated once a ConfigMap or Secret of the pod changes
+	volumesChecksumAnnotation = "vk.stackpath.com/volumes-checksum"
+
+	// The size of the volume claims the files are written to
+	fileVolumeSize = "1Gi"
+)
+
+// volumeWriterVolume is the description of a volume passed on to the volume writer, which writes
+// the files held by the environment variable FilesEnvVar into the directory MountPath
+type volumeWriterVolume struct {
+	Name        string `json:"name"`
+	MountPath   string `json:"mountPath"`
+	FilesEnvVar string `json:"filesEnvVar"`
+}
+
+// volumeFile is a file of a volume, its content is base64 encoded when passed on to the volume writer
+type volumeFile struct {
+	Path    string `json:"path"`
+	Content []byte `json:"content"`
+	Mode    int32  `json:"mode"`
+}
+
+// fileVolume is a volume of a pod whose files are written by the volume writer
+type fileVolume struct {
+	name  string
+	files []volumeFile
+	// whether some of the files are read from Secrets
+	secret bool
+}
+
+// isFileVolume returns whether the files of the volume are written by the volume writer
+func isFileVolume(volume *v1.Volume) bool {
+	return volume.ConfigMap != nil || volume.Secret != nil || volume.Projected != nil || volume.DownwardAPI != nil
+}
+
+// addVolumeWriter adds the volume writer sidecar to the containers when the pod has ConfigMap, Secret,
+// projected or downward API volumes, and returns the volume claims it writes their files into.
+// The containers of the pod mount the claims in place of the volumes, since they have the same slug.
+// When the init gate image is set, the volume writer also mounts the init gate directory, in which it
+// records that it wrote the files, and addInitGate holds the containers until it did.
+func (p *StackpathProvider) addVolumeWriter(pod *v1.Pod, containers workload_models.V1ContainerSpecMapEntry) ([]*workload_models.V1VolumeClaim, error) {
+	volumes, env, err := p.getVolumeWriterEnvFrom(pod)
+	if err != nil || len(volumes) == 0 {
+		return nil, err
+	}
+
+	for _, container := range getPodContainers(pod) {
+		if container.Name == volumeWriterContainerName {
+			return nil, fmt.Errorf("the container name %s is reserved for the provider's volume writer sidecar", volumeWriterContainerName)
+		}
+	}
+
+	volumeClaims := make([]*workload_models.V1VolumeClaim, 0, len(volumes))
+	volumeMounts := make([]*workload_models.V1InstanceVolumeMount, 0, len(volumes))
+	for _, volume := range volumes {
+		volumeClaims = append(volumeClaims, &workload_models.V1VolumeClaim{
+			Name:     volume.name,
+			Slug:     volume.name,
+			Metadata: &workload_models.V1Metadata{},
+			Spec: &workload_models.V1VolumeClaimSpec{
+				Resources: &workload_models.V1ResourceRequirements{
+					Limits:   workload_models.V1StringMapEntry{"storage": fileVolumeSize},
+					Requests: workload_models.V1StringMapEntry{"storage": fileVolumeSize},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, &workload_models.V1InstanceVolumeMount{
+			Slug:      volume.name,
+			MountPath: volumeWriterMountPathPrefix + volume.name,
+		})
+	}
+	if p.apiConfig.InitGateImage != "" {
+		volumeMounts = append(volumeMounts, &workload_models.V1InstanceVolumeMount{Slug: initGateVolumeName, MountPath: initGateMountPath})
+	}
+
+	containers[volumeWriterContainerName] = workload_models.V1ContainerSpec{
+		Image:        p.apiConfig.VolumeWriterImage,
+		Env:          env,
+		Resources:    p.getSidecarResources(),
+		VolumeMounts: volumeMounts,
+	}
+	return volumeClaims, nil
+}
+
+// getVolumesChecksum returns the checksum of the files the volume writer writes for the pod,
+// or an empty string when the pod has no volumes written by the volume writer
+func (p *StackpathProvider) getVolumesChecksum(pod *v1.Pod) (string, error) {
+	volumes, env, err := p.getVolumeWriterEnvFrom(pod)
+	if err != nil || len(volumes) == 0 {
+		return "", err
+	}
+	return getVolumeWriterChecksum(env)
+}
+
+// getVolumeWriterChecksum returns the checksum of the environment of the volume writer, which holds the files of the volumes
+func getVolumeWriterChecksum(env workload_models.V1EnvironmentVariableMapEntry) (string, error) {
+	// the keys of the map are sorted, so the checksum doesn't depend on their order
+	value, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// getVolumeWriterEnvFrom returns the volumes of the pod written by the volume writer and the environment
+// variables passing their files on to it. The volumes are skipped when no volume writer image is configured.
+func (p *StackpathProvider) getVolumeWriterEnvFrom(pod *v1.Pod) ([]fileVolume, workload_models.V1EnvironmentVariableMapEntry, error) {
+	if p.apiConfig.VolumeWriterImage == "" {
+		return nil, nil, nil
+	}
+
+	volumes, err := p.getFileVolumesFrom(pod)
+	if err != nil || len(volumes) == 0 {
+		return nil, nil, err
+	}
+
+	env := workload_models.V1EnvironmentVariableMapEntry{}
+	writerVolumes := make([]volumeWriterVolume, 0, len(volumes))
+	for _, volume := range volumes {
+		filesEnvVar := volumeWriterFilesEnvVarPrefix + strings.ToUpper(strings.ReplaceAll(volume.name, "-", "_"))
+		files, err := json.Marshal(volume.files)
+		if err != nil {
+			return nil, nil, err
+		}
+		if volume.secret {
+			// the files read from secrets are set as a secret value, so StackPath doesn't expose them
+			env[filesEnvVar] = workload_models.V1EnvironmentVariable{SecretValue: string(files)}
+		} else {
+			env[filesEnvVar] = workload_models.V1EnvironmentVariable{Value: string(files)}
+		}
+		writerVolumes = append(writerVolumes, volumeWriterVolume{
+			Name:        volume.name,
+			MountPath:   volumeWriterMountPathPrefix + volume.name,
+			FilesEnvVar: filesEnvVar,
+		})
+	}
+
+	writerVolumesValue, err := json.Marshal(writerVolumes)
+	if err != nil {
+		return nil, nil, err
+	}
+	env[volumeWriterVolumesEnvVar] = workload_models.V1EnvironmentVariable{Value: string(writerVolumesValue)}
+	if p.apiConfig.InitGateImage != "" {
+		// the volume writer leaves a volume-writer.done file in the init gate directory once it wrote the files
+		env[initGateDirEnvVar] = workload_models.V1EnvironmentVariable{Value: initGateMountPath}
+	}
+
+	return volumes, env, nil
+}
+
+// getFileVolumesFrom returns the files of the ConfigMap, Secret, projected and downward API volumes of the pod
+func (p *StackpathProvider) getFileVolumesFrom(pod *v1.Pod) ([]fileVolume, error) {
+	volumes := []fileVolume{}
+	for _, volume := range pod.Spec.Volumes {
+		if !isVolumeMounted(pod, volume.Name) {
+			// e.g. the service account token volume, whose mount is skipped
+			continue
+		}
+		writtenVolume := fileVolume{name: volume.Name}
+		var err error
+		switch {
+		case volume.ConfigMap != nil:
+			source := volume.ConfigMap
+			writtenVolume.files, err = p.getConfigMapVolumeFiles(pod.Namespace, source.Name, source.Items, source.Optional, getFileMode(source.DefaultMode, v1.ConfigMapVolumeSourceDefaultMode))
+		case volume.Secret != nil:
+			source := volume.Secret
+			writtenVolume.secret = true
+			writtenVolume.files, err = p.getSecretVolumeFiles(pod.Namespace, source.SecretName, source.Items, source.Optional, getFileMode(source.DefaultMode, v1.SecretVolumeSourceDefaultMode))
+		case volume.DownwardAPI != nil:
+			source := volume.DownwardAPI
+			writtenVolume.files, err = p.getDownwardAPIVolumeFiles(pod, source.Items, getFileMode(source.DefaultMode, v1.DownwardAPIVolumeSourceDefaultMode))
+		case volume.Projected != nil:
+			writtenVolume.files, writtenVolume.secret, err = p.getProjectedVolumeFiles(pod, volume.Name, volume.Projected)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the files are sorted so the environment of the volume writer only changes with their content
+		sort.Slice(writtenVolume.files, func(i, j int) bool {
+			return writtenVolume.files[i].Path < writtenVolume.files[j].Path
+		})
+		volumes = append(volumes, writtenVolume)
+	}
+	return volumes, nil
+}
+
+// isVolumeMounted returns whether a container of the pod mounts the volume elsewhere than at the service account path
+func isVolumeMounted(pod *v1.Pod, name string) bool {
+	for _, container := range getPodContainers(pod) {
+		for _, volumeMount := range container.VolumeMounts {
+			if volumeMount.Name == name && volumeMount.MountPath != defaultK8sServiceAccountMountPath {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getProjectedVolumeFiles returns the files of the sources of a projected volume, and whether some of them are read from Secrets
+func (p *StackpathProvider) getProjectedVolumeFiles(pod *v1.Pod, name string, source *v1.ProjectedVolumeSource) ([]volumeFile, bool, error) {
+	defaultMode := getFileMode(source.DefaultMode, v1.ProjectedVolumeSourceDefaultMode)
+
+	files := []volumeFile{}
+	secret := false
+	for _, projection := range source.Sources {
+		var sourceFiles []volumeFile
+		var err error
+		switch {
+		case projection.ConfigMap != nil:
+			sourceFiles, err = p.getConfigMapVolumeFiles(pod.Namespace, projection.ConfigMap.Name, projection.ConfigMap.Items, projection.ConfigMap.Optional, defaultMode)
+		case projection.Secret != nil:
+			secret = true
+			sourceFiles, err = p.getSecretVolumeFiles(pod.Namespace, projection.Secret.Name, projection.Secret.Items, projection.Secret.Optional, defaultMode)
+		case projection.DownwardAPI != nil:
+			sourceFiles, err = p.getDownwardAPIVolumeFiles(pod, projection.DownwardAPI.Items, defaultMode)
+		case projection.ServiceAccountToken != nil:
+			// the workloads have no access to the Kubernetes API, which the token is meant for
+			p.logger.Warnf("skipping the service account token of the projected volume %s, service account tokens are not supported", name)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		files = append(files, sourceFiles...)
+	}
+	return files, secret, nil
+}
+
+// getConfigMapVolumeFiles returns the files of the keys of a ConfigMap
+func (p *StackpathProvider) getConfigMapVolumeFiles(namespace, name string, items []v1.KeyToPath, optional *bool, defaultMode int32) ([]volumeFile, error) {
+	configMap, err := p.configMapLister.ConfigMaps(namespace).Get(name)
+	if err != nil {
+		if !isNotFound(err) {
+			return nil, err
+		}
+		if optional != nil && *optional {
+			return []volumeFile{}, nil
+		}
+		return nil, fmt.Errorf("configmap %q not found", name)
+	}
+
+	data := map[string][]byte{}
+	for key, value := range configMap.Data {
+		data[key] = []byte(value)
+	}
+	for key, value := range configMap.BinaryData {
+		data[key] = value
+	}
+	return getKeyToPathFiles("ConfigMap", namespace, name, data, items, optional, defaultMode)
+}
+
+// getSecretVolumeFiles returns the files of the keys of a Secret
+func (p *StackpathProvider) getSecretVolumeFiles(namespace, name string, items []v1.KeyToPath, optional *bool, defaultMode int32) ([]volumeFile, error) {
+	secret, err := p.secretLister.Secrets(namespace).Get(name)
+	if err != nil {
+		if !isNotFound(err) {
+			return nil, err
+		}
+		if optional != nil && *optional {
+			return []volumeFile{}, nil
+		}
+		return nil, fmt.Errorf("secret %q not found", name)
+	}
+	return getKeyToPathFiles("Secret", namespace, name, secret.Data, items, optional, defaultMode)
+}
+
+// getKeyToPathFiles returns the files of the keys of a ConfigMap or Secret. As with the kubelet, every key is
+// written to a file of the same name unless items are listed, in which case only those keys are written to their path.
+func getKeyToPathFiles(kind, namespace, name string, data map[string][]byte, items []v1.KeyToPath, optional *bool, defaultMode int32) ([]volumeFile, error) {
+	files := []volumeFile{}
+	if len(items) == 0 {
+		for key, content := range data {
+			files = append(files, volumeFile{Path: key, Content: content, Mode: defaultMode})
+		}
+		return files, nil
+	}
+
+	for _, item := range items {
+		content, ok := data[item.Key]
+		if !ok {
+			if optional != nil && *optional {
+				continue
+			}
+			return nil, fmt.Errorf("couldn't find key %s in %s %s/%s", item.Key, kind, namespace, name)
+		}
+		files = append(files, volumeFile{Path: item.Path, Content: content, Mode: getFileMode(item.Mode, defaultMode)})
+	}
+	return files, nil
+}
+
+// getDownwardAPIVolumeFiles returns the files of the pod fields and container resources selected through the downward API
+func (p *StackpathProvider) getDownwardAPIVolumeFiles(pod *v1.Pod, items []v1.DownwardAPIVolumeFile, defaultMode int32) ([]volumeFile, error) {
+	files := []volumeFile{}
+	for _, item := range items {
+		var value string
+		var err error
+		switch {
+		case item.FieldRef != nil:
+			value, err = p.getPodFieldValue(pod, item.FieldRef.FieldPath)
+		case item.ResourceFieldRef != nil:
+			if item.ResourceFieldRef.ContainerName == "" {
+				return nil, fmt.Errorf("the resource field of the file %s must select a container", item.Path)
+			}
+			value, err = p.getContainerResourceValue(pod, &v1.Container{}, item.ResourceFieldRef)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, volumeFile{Path: item.Path, Content: []byte(value), Mode: getFileMode(item.Mode, defaultMode)})
+	}
+	return files, nil
+}
+
+// getFileMode returns the mode of a file, or the default mode when it isn't set
+func getFileMode(mode *int32, defaultMode int32) int32 {
+	if mode == nil {
+		return defaultMode
+	}
+	return *mode
+}
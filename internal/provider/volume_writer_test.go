@@ -0,0 +1,343 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/instance"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// newFileVolumePod returns a pod mounting the volume the volume writer writes the files of
+func newFileVolumePod(volume v1.Volume) *v1.Pod {
+	pod := createTestPodWithVolumes([]v1.Volume{volume}, v1.VolumeMount{Name: "config", MountPath: "/etc/nginx/conf.d"})
+	pod.Labels = map[string]string{"app": "nginx"}
+	return pod
+}
+
+func TestVolumeWriter(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	configMapListerMock := mocks.NewMockConfigMapLister(mockController)
+	configMapNamespaceListerMock := mocks.NewMockConfigMapNamespaceLister(mockController)
+	secretListerMock := mocks.NewMockSecretLister(mockController)
+	secretNamespaceListerMock := mocks.NewMockSecretNamespaceLister(mockController)
+
+	configMapListerMock.EXPECT().ConfigMaps("test-ns").Return(configMapNamespaceListerMock).AnyTimes()
+	configMapNamespaceListerMock.EXPECT().Get("nginx-config").Return(&v1.ConfigMap{
+		Data:       map[string]string{"default.conf": "server {}", "extra.conf": "gzip on;"},
+		BinaryData: map[string][]byte{"favicon.ico": {0x00, 0x01}},
+	}, nil).AnyTimes()
+	configMapNamespaceListerMock.EXPECT().Get("missing").Return(nil, k8serrors.NewNotFound(v1.Resource("configmaps"), "missing")).AnyTimes()
+	secretListerMock.EXPECT().Secrets("test-ns").Return(secretNamespaceListerMock).AnyTimes()
+	secretNamespaceListerMock.EXPECT().Get("tls").Return(&v1.Secret{
+		Data: map[string][]byte{"tls.key": []byte("key")},
+	}, nil).AnyTimes()
+
+	provider, err := createTestProvider(ctx, configMapListerMock, secretListerMock, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	optional := true
+	mode := int32(0600)
+
+	testCases := []struct {
+		description   string
+		writerImage   string
+		volume        v1.Volume
+		expectedError string
+		expectedEnv   workload_models.V1EnvironmentVariableMapEntry
+	}{
+		{
+			description: "writes every key of a ConfigMap",
+			writerImage: "stackpath/volume-writer:latest",
+			volume: v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "nginx-config"}},
+			}},
+			expectedEnv: workload_models.V1EnvironmentVariableMapEntry{
+				"VOLUME_WRITER_FILES_CONFIG": {Value: `[{"path":"default.conf","content":"c2VydmVyIHt9","mode":420},{"path":"extra.conf","content":"Z3ppcCBvbjs=","mode":420},{"path":"favicon.ico","content":"AAE=","mode":420}]`},
+				volumeWriterVolumesEnvVar:    {Value: `[{"name":"config","mountPath":"/volumes/config","filesEnvVar":"VOLUME_WRITER_FILES_CONFIG"}]`},
+			},
+		},
+		{
+			description: "writes the items of a ConfigMap to their path and mode",
+			writerImage: "stackpath/volume-writer:latest",
+			volume: v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: "nginx-config"},
+					Items:                []v1.KeyToPath{{Key: "default.conf", Path: "sites/default.conf", Mode: &mode}},
+				},
+			}},
+			expectedEnv: workload_models.V1EnvironmentVariableMapEntry{
+				"VOLUME_WRITER_FILES_CONFIG": {Value: `[{"path":"sites/default.conf","content":"c2VydmVyIHt9","mode":384}]`},
+				volumeWriterVolumesEnvVar:    {Value: `[{"name":"config","mountPath":"/volumes/config","filesEnvVar":"VOLUME_WRITER_FILES_CONFIG"}]`},
+			},
+		},
+		{
+			description: "writes the files of a Secret as a secret value",
+			writerImage: "stackpath/volume-writer:latest",
+			volume: v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{SecretName: "tls", DefaultMode: &mode},
+			}},
+			expectedEnv: workload_models.V1EnvironmentVariableMapEntry{
+				"VOLUME_WRITER_FILES_CONFIG": {SecretValue: `[{"path":"tls.key","content":"a2V5","mode":384}]`},
+				volumeWriterVolumesEnvVar:    {Value: `[{"name":"config","mountPath":"/volumes/config","filesEnvVar":"VOLUME_WRITER_FILES_CONFIG"}]`},
+			},
+		},
+		{
+			description: "writes the sources of a projected volume",
+			writerImage: "stackpath/volume-writer:latest",
+			volume: v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+				Projected: &v1.ProjectedVolumeSource{Sources: []v1.VolumeProjection{
+					{ConfigMap: &v1.ConfigMapProjection{
+						LocalObjectReference: v1.LocalObjectReference{Name: "nginx-config"},
+						Items:                []v1.KeyToPath{{Key: "extra.conf", Path: "extra.conf"}},
+					}},
+					{DownwardAPI: &v1.DownwardAPIProjection{Items: []v1.DownwardAPIVolumeFile{
+						{Path: "labels/app", FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.labels['app']"}},
+					}}},
+					{ServiceAccountToken: &v1.ServiceAccountTokenProjection{Path: "token"}},
+				}},
+			}},
+			expectedEnv: workload_models.V1EnvironmentVariableMapEntry{
+				"VOLUME_WRITER_FILES_CONFIG": {Value: `[{"path":"extra.conf","content":"Z3ppcCBvbjs=","mode":420},{"path":"labels/app","content":"bmdpbng=","mode":420}]`},
+				volumeWriterVolumesEnvVar:    {Value: `[{"name":"config","mountPath":"/volumes/config","filesEnvVar":"VOLUME_WRITER_FILES_CONFIG"}]`},
+			},
+		},
+		{
+			description: "writes no files for a missing optional ConfigMap",
+			writerImage: "stackpath/volume-writer:latest",
+			volume: v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "missing"}, Optional: &optional},
+			}},
+			expectedEnv: workload_models.V1EnvironmentVariableMapEntry{
+				"VOLUME_WRITER_FILES_CONFIG": {Value: `[]`},
+				volumeWriterVolumesEnvVar:    {Value: `[{"name":"config","mountPath":"/volumes/config","filesEnvVar":"VOLUME_WRITER_FILES_CONFIG"}]`},
+			},
+		},
+		{
+			description: "fails when a ConfigMap is missing",
+			writerImage: "stackpath/volume-writer:latest",
+			volume: v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "missing"}},
+			}},
+			expectedError: `configmap "missing" not found`,
+		},
+		{
+			description: "fails when an item of a ConfigMap is missing",
+			writerImage: "stackpath/volume-writer:latest",
+			volume: v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: "nginx-config"},
+					Items:                []v1.KeyToPath{{Key: "missing.conf", Path: "missing.conf"}},
+				},
+			}},
+			expectedError: "couldn't find key missing.conf in ConfigMap test-ns/nginx-config",
+		},
+		{
+			description: "fails without a volume writer image",
+			volume: v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "nginx-config"}},
+			}},
+			expectedError: "the workload of the pod test-ns/test-pod is invalid: the volume mount /etc/nginx/conf.d of the container nginx references the volume config, which is only supported when the volume writer image is set",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			provider.apiConfig.VolumeWriterImage = c.writerImage
+
+			workload, err := provider.getWorkloadFrom(ctx, newFileVolumePod(c.volume))
+			if c.expectedError != "" {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			writer, ok := workload.Spec.Containers[volumeWriterContainerName]
+			assert.True(t, ok, "the volume writer must be added")
+			assert.Equal(t, c.writerImage, writer.Image)
+			assert.Equal(t, c.expectedEnv, writer.Env)
+			assert.Equal(t, []*workload_models.V1InstanceVolumeMount{{Slug: "config", MountPath: "/volumes/config"}}, writer.VolumeMounts)
+			// the volume writer is allocated with the smallest instance size rather than the size of the containers
+			assert.Equal(t, workload_models.V1StringMapEntry{"cpu": "1", "memory": "2Gi"}, writer.Resources.Limits)
+			assert.Equal(t, workload_models.V1StringMapEntry{"cpu": "4", "memory": "16Gi"}, workload.Spec.Containers["nginx"].Resources.Limits)
+
+			assert.Len(t, workload.Spec.VolumeClaimTemplates, 1)
+			assert.Equal(t, "config", workload.Spec.VolumeClaimTemplates[0].Slug)
+			assert.Equal(t, fileVolumeSize, workload.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests["storage"])
+			assert.Equal(t, []*workload_models.V1InstanceVolumeMount{{Slug: "config", MountPath: "/etc/nginx/conf.d"}}, workload.Spec.Containers["nginx"].VolumeMounts)
+
+			checksum, err := provider.getVolumesChecksum(newFileVolumePod(c.volume))
+			assert.NoError(t, err)
+			assert.Equal(t, checksum, workload.Metadata.Annotations[volumesChecksumAnnotation])
+		})
+	}
+}
+
+var configVolume = v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+	ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "nginx-config"}},
+}}
+
+func TestVolumeWriterUpdate(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	configMapListerMock := mocks.NewMockConfigMapLister(mockController)
+	configMapNamespaceListerMock := mocks.NewMockConfigMapNamespaceLister(mockController)
+
+	provider, err := createTestProvider(ctx, configMapListerMock, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.apiConfig.VolumeWriterImage = "stackpath/volume-writer:latest"
+
+	pod := newFileVolumePod(configVolume)
+
+	configMapListerMock.EXPECT().ConfigMaps("test-ns").Return(configMapNamespaceListerMock).Times(2)
+	gomock.InOrder(
+		configMapNamespaceListerMock.EXPECT().Get("nginx-config").Return(&v1.ConfigMap{Data: map[string]string{"default.conf": "server {}"}}, nil),
+		configMapNamespaceListerMock.EXPECT().Get("nginx-config").Return(&v1.ConfigMap{Data: map[string]string{"default.conf": "server { listen 8080; }"}}, nil),
+	)
+
+	live, err := provider.getWorkloadFrom(ctx, pod)
+	assert.NoError(t, err)
+	desired, err := provider.getWorkloadFrom(ctx, pod)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"metadata.annotations"}, getWorkloadChanges(live, desired))
+
+	updated := applyWorkloadChanges(live, desired)
+	assert.Equal(t, desired.Spec.Containers[volumeWriterContainerName].Env, updated.Spec.Containers[volumeWriterContainerName].Env)
+	assert.Empty(t, getWorkloadChanges(updated, desired))
+}
+
+func TestVolumeWriterInitGate(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	configMapListerMock := mocks.NewMockConfigMapLister(mockController)
+	configMapNamespaceListerMock := mocks.NewMockConfigMapNamespaceLister(mockController)
+
+	provider, err := createTestProvider(ctx, configMapListerMock, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.apiConfig.VolumeWriterImage = "stackpath/volume-writer:latest"
+	provider.apiConfig.InitGateImage = "stackpath/init-gate:latest"
+
+	configMapListerMock.EXPECT().ConfigMaps("test-ns").Return(configMapNamespaceListerMock).AnyTimes()
+	configMapNamespaceListerMock.EXPECT().Get("nginx-config").Return(&v1.ConfigMap{Data: map[string]string{"default.conf": "server {}"}}, nil).AnyTimes()
+	configMapNamespaceListerMock.EXPECT().Get("large-config").Return(&v1.ConfigMap{Data: map[string]string{"default.conf": strings.Repeat("#", maxEnvironmentVariableSize)}}, nil).AnyTimes()
+
+	t.Run("holds the containers until the files are written", func(t *testing.T) {
+		pod := newFileVolumePod(configVolume)
+		pod.Spec.Containers[0].Command = []string{"nginx"}
+
+		workload, err := provider.getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+
+		writer := workload.Spec.Containers[volumeWriterContainerName]
+		assert.Equal(t, initGateMountPath, writer.Env[initGateDirEnvVar].Value)
+		assert.Equal(t, []*workload_models.V1InstanceVolumeMount{
+			{Slug: "config", MountPath: "/volumes/config"},
+			{Slug: initGateVolumeName, MountPath: initGateMountPath},
+		}, writer.VolumeMounts)
+
+		nginx := workload.Spec.Containers["nginx"]
+		assert.Equal(t, []string{"/bin/sh", "-c", `until [ -f "$0/volume-writer.done" ]; do sleep 1; done; exec "$@"`, initGateMountPath, "nginx"}, nginx.Command)
+		assert.Equal(t, []*workload_models.V1InstanceVolumeMount{
+			{Slug: "config", MountPath: "/etc/nginx/conf.d"},
+			{Slug: initGateVolumeName, MountPath: initGateMountPath},
+		}, nginx.VolumeMounts)
+		assert.Contains(t, workload.Spec.Containers, initGateContainerName)
+
+		checksum, err := provider.getVolumesChecksum(pod)
+		assert.NoError(t, err)
+		assert.Equal(t, checksum, workload.Metadata.Annotations[volumesChecksumAnnotation])
+	})
+
+	t.Run("fails when the files don't fit in an environment variable", func(t *testing.T) {
+		pod := newFileVolumePod(v1.Volume{Name: "config", VolumeSource: v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: "large-config"}},
+		}})
+		pod.Spec.Containers[0].Command = []string{"nginx"}
+
+		_, err := provider.getWorkloadFrom(ctx, pod)
+		assert.ErrorContains(t, err, "the workload of the pod test-ns/test-pod is invalid: the environment variable VOLUME_WRITER_FILES_CONFIG of the container volume-writer is")
+		assert.ErrorContains(t, err, "more than the 131072 bytes a container can be started with")
+	})
+}
+
+func TestPodsTrackerUpdatesVolumes(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	configMapListerMock := mocks.NewMockConfigMapLister(mockController)
+	configMapNamespaceListerMock := mocks.NewMockConfigMapNamespaceLister(mockController)
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	isc := mocks.NewInstanceClientService(mockController)
+
+	provider, err := createTestProvider(ctx, configMapListerMock, nil, nil, &workload_client.EdgeCompute{Workloads: wsc, Instance: isc})
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+	provider.apiConfig.VolumeWriterImage = "stackpath/volume-writer:latest"
+
+	pod := newFileVolumePod(configVolume)
+
+	// the workload was created with the first version of the ConfigMap, which has changed since
+	configMapListerMock.EXPECT().ConfigMaps("test-ns").Return(configMapNamespaceListerMock).AnyTimes()
+	gomock.InOrder(
+		configMapNamespaceListerMock.EXPECT().Get("nginx-config").Return(&v1.ConfigMap{Data: map[string]string{"default.conf": "server {}"}}, nil),
+		configMapNamespaceListerMock.EXPECT().Get("nginx-config").Return(&v1.ConfigMap{Data: map[string]string{"default.conf": "server { listen 8080; }"}}, nil).AnyTimes(),
+	)
+	live, err := provider.getWorkloadFrom(ctx, pod)
+	assert.NoError(t, err)
+	live.Metadata.Version = "1"
+	live.Status = workload_models.V1WorkloadStatusACTIVE.Pointer()
+
+	checksum, err := provider.getVolumesChecksum(pod)
+	assert.NoError(t, err)
+	assert.NotEqual(t, checksum, live.Metadata.Annotations[volumesChecksumAnnotation])
+
+	i := createTestInstance(
+		provider.getInstanceName("test-ns", "test-pod"),
+		workload_models.NewWorkloadv1InstanceInstancePhase(workload_models.Workloadv1InstanceInstancePhaseRUNNING),
+		&workload_models.V1ContainerStatus{Name: "nginx", Ready: true, Running: &workload_models.ContainerStatusRunning{}},
+	)
+	isc.EXPECT().GetWorkloadInstance(gomock.Any(), nil).Return(
+		&instance.GetWorkloadInstanceOK{Payload: &workload_models.V1GetWorkloadInstanceResponse{Instance: i}},
+		nil,
+	).Times(2)
+
+	// the workload is updated once with the new files, and not again while they don't change
+	wsc.EXPECT().GetWorkload(gomock.Any(), nil).Return(&workloads.GetWorkloadOK{Payload: &workload_models.V1GetWorkloadResponse{Workload: live}}, nil).Times(1)
+	wsc.EXPECT().UpdateWorkload(gomock.Any(), nil).Do(func(params *workloads.UpdateWorkloadParams, _ interface{}, _ ...workloads.ClientOption) {
+		assert.Equal(t, "1", params.Body.Workload.Metadata.Version)
+		assert.Equal(t, checksum, params.Body.Workload.Metadata.Annotations[volumesChecksumAnnotation])
+	}).Return(nil, nil).Times(1)
+
+	podsTracker := &PodsTracker{
+		podLister:      mocks.NewMockPodLister(mockController),
+		updateCallback: func(p *v1.Pod) {},
+		handler:        provider,
+	}
+	assert.True(t, podsTracker.handlePodUpdates(ctx, pod))
+	assert.Equal(t, checksum, podsTracker.volumesChecksums["test-ns/test-pod"])
+	assert.True(t, podsTracker.handlePodUpdates(ctx, pod))
+}
@@ -2,6 +2,7 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -13,15 +14,31 @@ import (
 
 const oneGi = 1024 * 1024 * 1024
 
-func (p *StackpathProvider) getWorkloadFrom(pod *v1.Pod) (*workload_models.V1Workload, error) {
-	spec, err := p.getWorkloadSpecFrom(pod)
+// the largest volume StackPath allows
+const stackpathMaxVolumeSize = 1000 * oneGi
+
+func (p *StackpathProvider) getWorkloadFrom(ctx context.Context, pod *v1.Pod) (*workload_models.V1Workload, error) {
+	spec, err := p.getWorkloadSpecFrom(ctx, pod)
 	if err != nil {
 		return nil, err
 	}
 
-	targets := p.getWorkloadTargetsFrom(pod)
+	targets, err := p.getWorkloadTargetsFrom(pod)
+	if err != nil {
+		return nil, err
+	}
 
 	metadata := p.getWorkloadMetadataFrom(pod)
+	if volumeWriter, ok := spec.Containers[volumeWriterContainerName]; ok {
+		checksum, err := getVolumeWriterChecksum(volumeWriter.Env)
+		if err != nil {
+			return nil, err
+		}
+		if metadata.Annotations == nil {
+			metadata.Annotations = workload_models.V1StringMapEntry{}
+		}
+		metadata.Annotations[volumesChecksumAnnotation] = checksum
+	}
 
 	w := workload_models.V1Workload{
 		Name:     p.getWorkloadSlug(pod.Namespace, pod.Name),
@@ -30,22 +47,66 @@ func (p *StackpathProvider) getWorkloadFrom(pod *v1.Pod) (*workload_models.V1Wor
 		Spec:     spec,
 		Targets:  targets,
 	}
+
+	if err := p.validateWorkload(pod, &w); err != nil {
+		return nil, err
+	}
 	return &w, nil
 }
 
 func (p *StackpathProvider) getWorkloadMetadataFrom(pod *v1.Pod) *workload_models.V1Metadata {
+	labels := workload_models.V1StringMapEntry{}
+	for key, value := range pod.Labels {
+		labels[key] = value
+	}
+	// the labels used to find the pod of a workload take precedence over the pod's own labels
+	labels[podNameLabelKey] = pod.Name
+	labels[podNamespaceLabelKey] = pod.Namespace
+	labels[nodeNameLabelKey] = p.nodeName
+
+	var annotations workload_models.V1StringMapEntry
+	for key, value := range pod.Annotations {
+		if key == v1.LastAppliedConfigAnnotation {
+			// it's a copy of the whole pod spec, which is of no use in StackPath
+			continue
+		}
+		if annotations == nil {
+			annotations = workload_models.V1StringMapEntry{}
+		}
+		annotations[key] = value
+	}
+
 	metadata := workload_models.V1Metadata{
-		Labels: workload_models.V1StringMapEntry{
-			podNameLabelKey:      pod.Name,
-			podNamespaceLabelKey: pod.Namespace,
-			nodeNameLabelKey:     p.nodeName,
-		},
+		Labels:      labels,
+		Annotations: annotations,
 	}
 	return &metadata
 }
 
-func (p *StackpathProvider) getWorkloadSpecFrom(pod *v1.Pod) (*workload_models.V1WorkloadSpec, error) {
-	containers, err := p.getWorkloadContainersFrom(pod.Spec.Containers)
+func (p *StackpathProvider) getWorkloadSpecFrom(ctx context.Context, pod *v1.Pod) (*workload_models.V1WorkloadSpec, error) {
+	// the native sidecars run along with the containers, which is how StackPath runs every container
+	containers, err := p.getWorkloadContainersFrom(ctx, pod, getLongRunningContainers(pod))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.translateExecProbes(pod, containers); err != nil {
+		return nil, err
+	}
+
+	if err := p.translateGRPCProbes(pod, containers); err != nil {
+		return nil, err
+	}
+
+	p.translateStartupProbes(pod, containers)
+
+	// the volume writer is added first, so the init gate holds the containers until it wrote the files
+	fileVolumes, err := p.addVolumeWriter(pod, containers)
+	if err != nil {
+		return nil, err
+	}
+
+	initGateVolumes, err := p.addInitGate(ctx, pod, containers)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +117,8 @@ func (p *StackpathProvider) getWorkloadSpecFrom(pod *v1.Pod) (*workload_models.V
 	if err != nil {
 		return nil, err
 	}
+	volumes = append(volumes, initGateVolumes...)
+	volumes = append(volumes, fileVolumes...)
 
 	imagePullCredentials, err := p.getImagePullCredentialsFrom(pod.Namespace, pod.Spec.ImagePullSecrets)
 	if err != nil {
@@ -83,9 +146,9 @@ func (p *StackpathProvider) getVolumeClaimSpecFrom(spec *v1.CSIVolumeSource) (*w
 
 	// force size to match Stackpath limit
 	if providedSize, ok := volumeSize.AsInt64(); ok {
-		if providedSize > int64(1000*oneGi) {
+		if providedSize > int64(stackpathMaxVolumeSize) {
 			p.logger.Info("adjusting volume size to match Stackpath 1000Gi limit")
-			volumeSize = *resource.NewQuantity(1000*oneGi, resource.BinarySI)
+			volumeSize = *resource.NewQuantity(stackpathMaxVolumeSize, resource.BinarySI)
 
 		}
 	}
@@ -100,9 +163,59 @@ func (p *StackpathProvider) getVolumeClaimSpecFrom(spec *v1.CSIVolumeSource) (*w
 	}, nil
 }
 
+// getEmptyDirVolumeClaimSpecFrom returns the spec of the volume claim backing an emptyDir volume, sized from its size limit
+// or the configured default size. The claim belongs to the workload of the pod, so as with an emptyDir volume its content
+// survives the restarts of the containers and is deleted along with the pod.
+func (p *StackpathProvider) getEmptyDirVolumeClaimSpecFrom(name string, emptyDir *v1.EmptyDirVolumeSource) (*workload_models.V1VolumeClaimSpec, error) {
+	var volumeSize resource.Quantity
+	if emptyDir.SizeLimit != nil && !emptyDir.SizeLimit.IsZero() {
+		volumeSize = *emptyDir.SizeLimit
+	} else {
+		var err error
+		if volumeSize, err = resource.ParseQuantity(p.apiConfig.EmptyDirDefaultSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if emptyDir.Medium == v1.StorageMediumMemory {
+		p.logger.Infof("the emptyDir volume %s is backed by a volume claim, memory backed volumes are not supported", name)
+	}
+
+	// the claim is sized in whole gibibytes, rounding up so the volume holds at least the requested size
+	sizeGi := (volumeSize.Value() + oneGi - 1) / oneGi
+	if sizeGi*oneGi > stackpathMaxVolumeSize {
+		return nil, fmt.Errorf("the size %s of the emptyDir volume %s exceeds the %dGi limit of StackPath volumes", volumeSize.String(), name, stackpathMaxVolumeSize/oneGi)
+	}
+
+	storage := fmt.Sprintf("%dGi", sizeGi)
+	return &workload_models.V1VolumeClaimSpec{
+		Resources: &workload_models.V1ResourceRequirements{
+			Limits:   workload_models.V1StringMapEntry{"storage": storage},
+			Requests: workload_models.V1StringMapEntry{"storage": storage},
+		},
+	}, nil
+}
+
 func (p *StackpathProvider) getWorkloadVolumesFrom(pod *v1.Pod) ([]*workload_models.V1VolumeClaim, error) {
 	workloadVolumeClaim := []*workload_models.V1VolumeClaim{}
 	for _, volume := range pod.Spec.Volumes {
+		if isFileVolume(&volume) && p.apiConfig.VolumeWriterImage != "" {
+			// the volume claims of those volumes are added along with the volume writer
+			continue
+		}
+		if volume.EmptyDir != nil {
+			spec, err := p.getEmptyDirVolumeClaimSpecFrom(volume.Name, volume.EmptyDir)
+			if err != nil {
+				return nil, err
+			}
+			workloadVolumeClaim = append(workloadVolumeClaim, &workload_models.V1VolumeClaim{
+				Name:     volume.Name,
+				Slug:     volume.Name,
+				Metadata: &workload_models.V1Metadata{},
+				Spec:     spec,
+			})
+			continue
+		}
 		if volume.CSI == nil || volume.CSI.Driver != stackpathVirtualKubeletCSIDriver {
 			p.logger.Infof("skipping volume %s, only CSI driver of type %s volumes are supported", volume.Name, stackpathVirtualKubeletCSIDriver)
 			continue
@@ -122,10 +235,10 @@ func (p *StackpathProvider) getWorkloadVolumesFrom(pod *v1.Pod) ([]*workload_mod
 	return workloadVolumeClaim, nil
 }
 
-func (p *StackpathProvider) getWorkloadContainersFrom(k8sContainers []v1.Container) (workload_models.V1ContainerSpecMapEntry, error) {
+func (p *StackpathProvider) getWorkloadContainersFrom(ctx context.Context, pod *v1.Pod, k8sContainers []v1.Container) (workload_models.V1ContainerSpecMapEntry, error) {
 	containers := make(workload_models.V1ContainerSpecMapEntry)
 	for _, k8sContainer := range k8sContainers {
-		container, err := p.getWorkloadContainerSpecFrom(&k8sContainer)
+		container, err := p.getWorkloadContainerSpecFrom(ctx, pod, &k8sContainer)
 		if err != nil {
 			return nil, err
 		}
@@ -134,21 +247,32 @@ func (p *StackpathProvider) getWorkloadContainersFrom(k8sContainers []v1.Contain
 	return containers, nil
 }
 
-func (p *StackpathProvider) getWorkloadTargetsFrom(pod *v1.Pod) workload_models.V1TargetMapEntry {
-	// creating one target just for provided city code
-	// No autoscaling allowed, min and max replicas = 1
-	target := workload_models.V1Target{
-		Spec: &workload_models.V1TargetSpec{
-			DeploymentScope: "cityCode",
-			Deployments: &workload_models.V1DeploymentSpec{
-				MinReplicas: 1,
-				MaxReplicas: 1,
-				Selectors:   []*workload_models.V1MatchExpression{{Key: "cityCode", Operator: "in", Values: []string{p.apiConfig.CityCode}}},
+func (p *StackpathProvider) getWorkloadTargetsFrom(pod *v1.Pod) (workload_models.V1TargetMapEntry, error) {
+	cityCodes := []string{p.apiConfig.CityCode}
+	if isMultiLocation(pod) {
+		var err error
+		if cityCodes, err = p.getPodCityCodes(pod); err != nil {
+			return nil, err
+		}
+	}
+
+	autoscaling, err := getAutoscalingSpecFrom(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	// creating one target per city code the pod runs in
+	// Only autoscaled pods run more than one instance per target
+	targets := workload_models.V1TargetMapEntry{}
+	for _, cityCode := range cityCodes {
+		targets[p.getTargetName(cityCode)] = workload_models.V1Target{
+			Spec: &workload_models.V1TargetSpec{
+				DeploymentScope: "cityCode",
+				Deployments:     autoscaling.getDeploymentSpec(cityCode),
 			},
-		},
+		}
 	}
-	targets := workload_models.V1TargetMapEntry{targetName: target}
-	return targets
+	return targets, nil
 }
 
 func (p *StackpathProvider) getWorkloadNetworkInterfacesFrom(pod *v1.Pod) []*workload_models.V1NetworkInterface {
@@ -166,12 +290,27 @@ func (p *StackpathProvider) getWorkloadNetworkInterfacesFrom(pod *v1.Pod) []*wor
 
 }
 
-func (p *StackpathProvider) getWorkloadContainerSpecFrom(k8sContainer *v1.Container) (*workload_models.V1ContainerSpec, error) {
+func (p *StackpathProvider) getWorkloadContainerSpecFrom(ctx context.Context, pod *v1.Pod, k8sContainer *v1.Container) (*workload_models.V1ContainerSpec, error) {
 	ports := p.getWorkloadContainerPortsFrom(k8sContainer.Ports)
 
-	env := p.getWorkloadContainerEnvFrom(k8sContainer.Env)
+	env, err := p.getWorkloadContainerEnvFromSources(pod, k8sContainer.EnvFrom)
+	if err != nil {
+		return nil, err
+	}
 
-	resources := p.getWorkloadContainerResourcesFrom(k8sContainer.Resources)
+	explicitEnv, err := p.getWorkloadContainerEnvFrom(pod, k8sContainer)
+	if err != nil {
+		return nil, err
+	}
+	// the variables set explicitly take precedence over the ones set from sources
+	for name, envVar := range explicitEnv {
+		env[name] = envVar
+	}
+
+	resources, err := p.getWorkloadContainerResourcesFrom(k8sContainer)
+	if err != nil {
+		return nil, err
+	}
 
 	volumeMounts := p.getWorkloadContainerVolumeMountsFrom(k8sContainer.VolumeMounts)
 
@@ -189,9 +328,14 @@ func (p *StackpathProvider) getWorkloadContainerSpecFrom(k8sContainer *v1.Contai
 	k8sArgs := k8sContainer.Args
 	if len(k8sArgs) != 0 {
 		if len(k8sCommand) == 0 {
-			return nil, fmt.Errorf("failed to create workload from pod. args not supported without command")
+			// StackPath has no args, so the command is the entrypoint of the image followed by the args
+			entrypoint, err := p.getImageEntrypoint(ctx, pod, k8sContainer.Image)
+			if err != nil {
+				return nil, err
+			}
+			k8sCommand = entrypoint
 		}
-		k8sCommand = append(k8sCommand, k8sArgs...)
+		k8sCommand = append(append([]string{}, k8sCommand...), k8sArgs...)
 	}
 
 	workloadContainerSpec := workload_models.V1ContainerSpec{
@@ -232,9 +376,9 @@ func (p *StackpathProvider) getWorkloadContainerPortsFrom(k8sPorts []v1.Containe
 	return portsToReturn
 }
 
-func (p *StackpathProvider) getWorkloadContainerEnvFrom(k8sEnv []v1.EnvVar) workload_models.V1EnvironmentVariableMapEntry {
+func (p *StackpathProvider) getWorkloadContainerEnvFrom(pod *v1.Pod, k8sContainer *v1.Container) (workload_models.V1EnvironmentVariableMapEntry, error) {
 	envToReturn := workload_models.V1EnvironmentVariableMapEntry{}
-	for _, k8sEnvVar := range k8sEnv {
+	for _, k8sEnvVar := range k8sContainer.Env {
 		if k8sEnvVar.ValueFrom == nil {
 			ignore := false
 			// k8s adds default environment variables that aren't useful in the stackpath environment, so don't use them
@@ -250,87 +394,18 @@ func (p *StackpathProvider) getWorkloadContainerEnvFrom(k8sEnv []v1.EnvVar) work
 				Value: k8sEnvVar.Value,
 			}
 		} else {
-			// TODO Handle environment variable from source
-			p.logger.Warnf("Value From is not supported for env var %s", k8sEnvVar.Name)
-		}
-	}
-
-	return envToReturn
-}
-
-func (p *StackpathProvider) getWorkloadContainerResourcesFrom(k8sResource v1.ResourceRequirements) *workload_models.V1ResourceRequirements {
-
-	// set default
-	resources := workload_models.V1ResourceRequirements{
-		Requests: containerResourcesSP1,
-		Limits:   containerResourcesSP1,
-	}
-
-	resources.Limits = toSPInstanceSize(k8sResource)
-	resources.Requests = toSPInstanceSize(k8sResource)
-	return &resources
-
-}
-
-// toSPInstanceSize replaces the resource allocation requests to one of the 5 supported instance sizes provided by SP
-func toSPInstanceSize(k8sResource v1.ResourceRequirements) workload_models.V1StringMapEntry {
-	var requestCPU, requestMEM, limitCPU, limitMEM *resource.Quantity
-
-	mem2Gi := resource.NewQuantity(2*oneGi, resource.BinarySI)
-	mem4Gi := resource.NewQuantity(4*oneGi, resource.BinarySI)
-	mem8Gi := resource.NewQuantity(8*oneGi, resource.BinarySI)
-	mem16Gi := resource.NewQuantity(16*oneGi, resource.BinarySI)
-
-	cpu1 := resource.NewQuantity(1, resource.DecimalSI)
-	cpu2 := resource.NewQuantity(2, resource.DecimalSI)
-	cpu4 := resource.NewQuantity(4, resource.DecimalSI)
-
-	if k8sResource.Requests != nil {
-		requestCPU = k8sResource.Requests.Cpu()
-		requestMEM = k8sResource.Requests.Memory()
-	} else {
-		// default values matching SP1
-		requestCPU = resource.NewQuantity(1, resource.DecimalSI)
-		requestMEM = mem2Gi
-	}
-
-	if k8sResource.Limits != nil {
-		limitCPU = k8sResource.Limits.Cpu()
-		limitMEM = k8sResource.Limits.Memory()
-	} else {
-		// default values matching SP1
-		limitCPU = resource.NewQuantity(1, resource.DecimalSI)
-		limitMEM = mem2Gi
-	}
-
-	cpu := maxResource(requestCPU, limitCPU)
-	mem := maxResource(requestMEM, limitMEM)
-
-	if cpu.Cmp(*cpu4) == 1 || mem.Cmp(*mem16Gi) == 1 {
-		return containerResourcesSP5
-	}
-
-	if (cpu.Cmp(*cpu2) == 1 && cpu.Cmp(*cpu4) != 1) || (mem.Cmp(*mem8Gi) == 1 && mem.Cmp(*mem16Gi) != 1) {
-		return containerResourcesSP4
-	}
-
-	if cpu.Cmp(*cpu1) == 1 && cpu.Cmp(*cpu2) != 1 {
-		if mem.Cmp(*mem4Gi) == 1 {
-			return containerResourcesSP3
-		}
-		return containerResourcesSP2
-	}
-
-	if cpu.Cmp(*cpu1) != 1 {
-		if mem.Cmp(*mem4Gi) == 1 && mem.Cmp(*mem8Gi) != 1 {
-			return containerResourcesSP3
-		}
-		if mem.Cmp(*mem2Gi) == 1 && mem.Cmp(*mem4Gi) != 1 {
-			return containerResourcesSP2
+			envVar, found, err := p.getEnvVarFromSource(pod, k8sContainer, k8sEnvVar.Name, k8sEnvVar.ValueFrom)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				continue
+			}
+			envToReturn[k8sEnvVar.Name] = *envVar
 		}
 	}
 
-	return containerResourcesSP1
+	return envToReturn, nil
 }
 
 func maxResource(x, y *resource.Quantity) *resource.Quantity {
@@ -370,12 +445,12 @@ func (p *StackpathProvider) getWorkloadContainerProbeFrom(k8sProbe *v1.Probe, co
 	}
 
 	if k8sProbe.GRPC != nil {
-		p.logger.Infof("probe of type GRPC is not supported, skipping")
+		// the gRPC probe strategy decides what replaces the probe
 		return nil, nil
 	}
 
 	if k8sProbe.Exec != nil {
-		p.logger.Info("probe of type Exec is not supported, skipping")
+		// the exec probe strategy decides what replaces the probe
 		return nil, nil
 	}
 
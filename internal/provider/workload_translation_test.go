@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
 	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stackpath/vk-stackpath-provider/internal/registry"
 
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
@@ -259,15 +264,44 @@ func TestVolumeMounts(t *testing.T) {
 
 func TestContainerEnv(t *testing.T) {
 	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
 
-	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	configMapListerMock := mocks.NewMockConfigMapLister(mockController)
+	configMapNamespaceListerMock := mocks.NewMockConfigMapNamespaceLister(mockController)
+	secretListerMock := mocks.NewMockSecretLister(mockController)
+	secretNamespaceListerMock := mocks.NewMockSecretNamespaceLister(mockController)
+
+	provider, err := createTestProvider(ctx, configMapListerMock, secretListerMock, nil, nil)
 	if err != nil {
 		t.Fatal("failed to create the test provider", err)
 	}
+
+	pod := &v1.Pod{}
+	pod.Name = "test-pod"
+	pod.Namespace = "test-ns"
+
+	optional := true
+	configMap := &v1.ConfigMap{Data: map[string]string{"log-level": "debug"}}
+	secret := &v1.Secret{Data: map[string][]byte{"password": []byte("s3cr3t")}}
+	configMapNotFound := k8serrors.NewNotFound(v1.Resource("configmaps"), "missing-config")
+	secretNotFound := k8serrors.NewNotFound(v1.Resource("secrets"), "missing-secret")
+
+	expectConfigMap := func(name string, configMap *v1.ConfigMap, err error) {
+		configMapListerMock.EXPECT().ConfigMaps("test-ns").Return(configMapNamespaceListerMock).Times(1)
+		configMapNamespaceListerMock.EXPECT().Get(name).Return(configMap, err).Times(1)
+	}
+	expectSecret := func(name string, secret *v1.Secret, err error) {
+		secretListerMock.EXPECT().Secrets("test-ns").Return(secretNamespaceListerMock).Times(1)
+		secretNamespaceListerMock.EXPECT().Get(name).Return(secret, err).Times(1)
+	}
+
 	var tests = []struct {
-		description   string
-		k8sEnv        []v1.EnvVar
-		expectedSPEnv workload_models.V1EnvironmentVariableMapEntry
+		description     string
+		k8sEnv          []v1.EnvVar
+		initMockedCalls func()
+		expectedSPEnv   workload_models.V1EnvironmentVariableMapEntry
+		expectedError   string
 	}{
 		{
 			description:   "happy case env vars",
@@ -318,11 +352,103 @@ func TestContainerEnv(t *testing.T) {
 			expectedSPEnv: workload_models.V1EnvironmentVariableMapEntry{},
 		},
 		{
-			description: "value from not supported is skipped",
+			description: "value from a config map key",
+			k8sEnv: []v1.EnvVar{
+				{
+					Name:      "LOG_LEVEL",
+					ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}, Key: "log-level"}},
+				},
+			},
+			initMockedCalls: func() { expectConfigMap("app-config", configMap, nil) },
+			expectedSPEnv:   workload_models.V1EnvironmentVariableMapEntry{"LOG_LEVEL": {Value: "debug"}},
+		},
+		{
+			description: "value from a secret key is set as a secret value",
+			k8sEnv: []v1.EnvVar{
+				{
+					Name:      "PASSWORD",
+					ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "app-secret"}, Key: "password"}},
+				},
+			},
+			initMockedCalls: func() { expectSecret("app-secret", secret, nil) },
+			expectedSPEnv:   workload_models.V1EnvironmentVariableMapEntry{"PASSWORD": {SecretValue: "s3cr3t"}},
+		},
+		{
+			description: "optional values from missing keys and objects are skipped",
+			k8sEnv: []v1.EnvVar{
+				{
+					Name:      "MISSING_KEY",
+					ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}, Key: "missing", Optional: &optional}},
+				},
+				{
+					Name:      "MISSING_CONFIG_MAP",
+					ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "missing-config"}, Key: "log-level", Optional: &optional}},
+				},
+				{
+					Name:      "MISSING_SECRET",
+					ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "missing-secret"}, Key: "password", Optional: &optional}},
+				},
+			},
+			initMockedCalls: func() {
+				expectConfigMap("app-config", configMap, nil)
+				expectConfigMap("missing-config", nil, configMapNotFound)
+				expectSecret("missing-secret", nil, secretNotFound)
+			},
+			expectedSPEnv: workload_models.V1EnvironmentVariableMapEntry{},
+		},
+		{
+			description: "fails on a missing required config map key",
+			k8sEnv: []v1.EnvVar{
+				{
+					Name:      "MISSING_KEY",
+					ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}, Key: "missing"}},
+				},
+			},
+			initMockedCalls: func() { expectConfigMap("app-config", configMap, nil) },
+			expectedError:   "couldn't find key missing in ConfigMap test-ns/app-config",
+		},
+		{
+			description: "fails on a missing required secret",
+			k8sEnv: []v1.EnvVar{
+				{
+					Name:      "MISSING_SECRET",
+					ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "missing-secret"}, Key: "password"}},
+				},
+			},
+			initMockedCalls: func() { expectSecret("missing-secret", nil, secretNotFound) },
+			expectedError:   "secret \"missing-secret\" not found",
+		},
+		{
+			description: "fails on a missing required secret key",
+			k8sEnv: []v1.EnvVar{
+				{
+					Name:      "MISSING_KEY",
+					ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "app-secret"}, Key: "token"}},
+				},
+			},
+			initMockedCalls: func() { expectSecret("app-secret", secret, nil) },
+			expectedError:   "couldn't find key token in Secret test-ns/app-secret",
+		},
+		{
+			description: "values from the downward API",
+			k8sEnv: []v1.EnvVar{
+				{
+					Name:      "POD_NAME",
+					ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+				},
+				{
+					Name:      "CPU_LIMIT",
+					ValueFrom: &v1.EnvVarSource{ResourceFieldRef: &v1.ResourceFieldSelector{Resource: "limits.cpu"}},
+				},
+			},
+			expectedSPEnv: workload_models.V1EnvironmentVariableMapEntry{"POD_NAME": {Value: "test-pod"}, "CPU_LIMIT": {Value: "1"}},
+		},
+		{
+			description: "value from an unsupported source is skipped",
 			k8sEnv: []v1.EnvVar{
 				{
 					Name:      "VALUE_FROM_ENV",
-					ValueFrom: &v1.EnvVarSource{ConfigMapKeyRef: &v1.ConfigMapKeySelector{Key: "reference-key"}},
+					ValueFrom: &v1.EnvVarSource{},
 				},
 			},
 			expectedSPEnv: workload_models.V1EnvironmentVariableMapEntry{},
@@ -331,10 +457,16 @@ func TestContainerEnv(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			workloadEnvs := provider.getWorkloadContainerEnvFrom(test.k8sEnv)
-			for index, env := range workloadEnvs {
-				assert.Equal(t, test.expectedSPEnv[index].Value, env.Value)
+			if test.initMockedCalls != nil {
+				test.initMockedCalls()
 			}
+			workloadEnvs, err := provider.getWorkloadContainerEnvFrom(pod, &v1.Container{Name: "app", Env: test.k8sEnv})
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedSPEnv, workloadEnvs)
 		})
 	}
 }
@@ -371,77 +503,77 @@ func TestInstanceSizes(t *testing.T) {
 	var tests = []struct {
 		description             string
 		k8sResourceRequirements v1.ResourceRequirements
-		expectedResources       workload_models.V1StringMapEntry
+		expectedSize            string
 	}{
 		{
 			description:             "no resource requirements result in sp-1",
 			k8sResourceRequirements: v1.ResourceRequirements{},
-			expectedResources:       containerResourcesSP1,
+			expectedSize:            "SP-1",
 		},
 		{
 			description:             "small cpu resource requirements without memory result in sp-1",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewMilliQuantity(100, resource.DecimalSI)}},
-			expectedResources:       containerResourcesSP1,
+			expectedSize:            "SP-1",
 		},
 		{
 			description:             "small cpu resource high memory result in sp-5",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewMilliQuantity(100, resource.DecimalSI), "memory": *resource.NewQuantity(24*1024*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP5,
+			expectedSize:            "SP-5",
 		},
 		{
 			description:             "small cpu resource memory fit for sp-4 result in sp-4",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewMilliQuantity(100, resource.DecimalSI), "memory": *resource.NewQuantity(10*1024*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP4,
+			expectedSize:            "SP-4",
 		},
 		{
 			description:             "small cpu resource memory fit for sp-3 result in sp-3",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewMilliQuantity(100, resource.DecimalSI), "memory": *resource.NewQuantity(8*1024*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP3,
+			expectedSize:            "SP-3",
 		},
 		{
 			description:             "small cpu resource memory fit for sp-2 result in sp-2",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewMilliQuantity(100, resource.DecimalSI), "memory": *resource.NewQuantity(4*1024*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP2,
+			expectedSize:            "SP-2",
 		},
 		{
 			description:             "small cpu resource memory fit for sp-1 result in sp-1",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewMilliQuantity(100, resource.DecimalSI), "memory": *resource.NewQuantity(2*1024*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP1,
+			expectedSize:            "SP-1",
 		},
 		{
 			description:             "small memory resource requirements without cpu result in sp-1",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"memory": *resource.NewQuantity(100*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP1,
+			expectedSize:            "SP-1",
 		},
 		{
 			description:             "small memory resource requirements with high cpu result in sp-5",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewQuantity(32, resource.DecimalSI), "memory": *resource.NewQuantity(100*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP5,
+			expectedSize:            "SP-5",
 		},
 		{
 			description:             "small memory resource requirements with with cpu fit for sp-4 result in sp-4",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewQuantity(4, resource.DecimalSI), "memory": *resource.NewQuantity(100*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP4,
+			expectedSize:            "SP-4",
 		},
 		{
 			description:             "small memory resource requirements with cpu fit for sp-2 and sp-3 result in sp-2",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewQuantity(2, resource.DecimalSI), "memory": *resource.NewQuantity(100*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP2,
+			expectedSize:            "SP-2",
 		},
 		{
 			description:             "small memory resource requirements with cpu fit for sp-1 result in sp-1",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewQuantity(1, resource.DecimalSI), "memory": *resource.NewQuantity(100*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP1,
+			expectedSize:            "SP-1",
 		},
 		{
 			description:             "cpu matching sp-2 and sp-3 with memory matching sp-3 results in sp-3",
 			k8sResourceRequirements: v1.ResourceRequirements{Requests: v1.ResourceList{"cpu": *resource.NewQuantity(2, resource.DecimalSI), "memory": *resource.NewQuantity(5*1024*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP3,
+			expectedSize:            "SP-3",
 		},
 		{
 			description:             "using limits instead of requests works as well",
 			k8sResourceRequirements: v1.ResourceRequirements{Limits: v1.ResourceList{"cpu": *resource.NewQuantity(2, resource.DecimalSI), "memory": *resource.NewQuantity(5*1024*1024*1024, resource.BinarySI)}},
-			expectedResources:       containerResourcesSP3,
+			expectedSize:            "SP-3",
 		},
 		{
 			description: "requests and limits maximum calculated correctly",
@@ -449,13 +581,20 @@ func TestInstanceSizes(t *testing.T) {
 				Limits:   v1.ResourceList{"cpu": *resource.NewQuantity(8, resource.DecimalSI), "memory": *resource.NewQuantity(5*1024*1024*1024, resource.BinarySI)},
 				Requests: v1.ResourceList{"cpu": *resource.NewQuantity(2, resource.DecimalSI), "memory": *resource.NewQuantity(5*1024*1024*1024, resource.BinarySI)},
 			},
-			expectedResources: containerResourcesSP5,
+			expectedSize: "SP-5",
 		},
 	}
+	ctx := context.Background()
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			result := toSPInstanceSize(test.k8sResourceRequirements)
-			assert.Equal(t, test.expectedResources, result)
+			selection, err := provider.getInstanceSizeFrom(&v1.Container{Name: "app", Resources: test.k8sResourceRequirements})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedSize, selection.size.Name)
 		})
 	}
 }
@@ -483,7 +622,7 @@ func TestWorkloadVolumes(t *testing.T) {
 			len:         0,
 		},
 		{
-			description: "pod with empty dir returns no volumes since it's not supported",
+			description: "pod with empty dir returns a volume sized from its size limit",
 			pod: v1.Pod{
 				Spec: v1.PodSpec{
 					Volumes: []v1.Volume{
@@ -491,7 +630,7 @@ func TestWorkloadVolumes(t *testing.T) {
 							Name: "empty-dir",
 							VolumeSource: v1.VolumeSource{
 								EmptyDir: &v1.EmptyDirVolumeSource{
-									SizeLimit: resource.NewQuantity(1*1024*1024*1024, resource.DecimalSI),
+									SizeLimit: resource.NewQuantity(5*1024*1024*1024, resource.DecimalSI),
 									Medium:    v1.StorageMediumDefault,
 								},
 							},
@@ -499,9 +638,91 @@ func TestWorkloadVolumes(t *testing.T) {
 					},
 				},
 			},
-			expected: []workload_models.V1VolumeClaim{},
-			err:      nil,
-			len:      0,
+			expected: []workload_models.V1VolumeClaim{
+				{
+					Metadata: &workload_models.V1Metadata{},
+					Name:     "empty-dir",
+					Slug:     "empty-dir",
+					Spec: &workload_models.V1VolumeClaimSpec{
+						Resources: &workload_models.V1ResourceRequirements{Requests: workload_models.V1StringMapEntry{"storage": "5Gi"}, Limits: workload_models.V1StringMapEntry{"storage": "5Gi"}},
+					},
+				},
+			},
+			err: nil,
+			len: 1,
+		},
+		{
+			description: "pod with empty dir rounds its size limit up to the next Gi",
+			pod: v1.Pod{
+				Spec: v1.PodSpec{
+					Volumes: []v1.Volume{
+						{
+							Name: "empty-dir",
+							VolumeSource: v1.VolumeSource{
+								EmptyDir: &v1.EmptyDirVolumeSource{
+									SizeLimit: resource.NewQuantity(500*1024*1024, resource.BinarySI),
+									Medium:    v1.StorageMediumMemory,
+								},
+							},
+						},
+					},
+				},
+			},
+			expected: []workload_models.V1VolumeClaim{
+				{
+					Metadata: &workload_models.V1Metadata{},
+					Name:     "empty-dir",
+					Slug:     "empty-dir",
+					Spec: &workload_models.V1VolumeClaimSpec{
+						Resources: &workload_models.V1ResourceRequirements{Requests: workload_models.V1StringMapEntry{"storage": "1Gi"}, Limits: workload_models.V1StringMapEntry{"storage": "1Gi"}},
+					},
+				},
+			},
+			err: nil,
+			len: 1,
+		},
+		{
+			description: "pod with empty dir without size limit returns a volume of the default size",
+			pod: v1.Pod{
+				Spec: v1.PodSpec{
+					Volumes: []v1.Volume{
+						{
+							Name:         "empty-dir",
+							VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+						},
+					},
+				},
+			},
+			expected: []workload_models.V1VolumeClaim{
+				{
+					Metadata: &workload_models.V1Metadata{},
+					Name:     "empty-dir",
+					Slug:     "empty-dir",
+					Spec: &workload_models.V1VolumeClaimSpec{
+						Resources: &workload_models.V1ResourceRequirements{Requests: workload_models.V1StringMapEntry{"storage": "1Gi"}, Limits: workload_models.V1StringMapEntry{"storage": "1Gi"}},
+					},
+				},
+			},
+			err: nil,
+			len: 1,
+		},
+		{
+			description: "pod with empty dir larger than the StackPath limit fails",
+			pod: v1.Pod{
+				Spec: v1.PodSpec{
+					Volumes: []v1.Volume{
+						{
+							Name: "empty-dir",
+							VolumeSource: v1.VolumeSource{
+								EmptyDir: &v1.EmptyDirVolumeSource{
+									SizeLimit: resource.NewQuantity(2000*1024*1024*1024, resource.BinarySI),
+								},
+							},
+						},
+					},
+				},
+			},
+			err: fmt.Errorf("the size 2000Gi of the emptyDir volume empty-dir exceeds the 1000Gi limit of StackPath volumes"),
 		},
 		{
 			description: "pod with invalid csi driver returns 0 volumes",
@@ -736,7 +957,7 @@ func TestWorkloadVolumes(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
 			volumes, err := provider.getWorkloadVolumesFrom(&test.pod)
-			if err != nil {
+			if test.err != nil || err != nil {
 				assert.Equal(t, test.err, err)
 			} else {
 				assert.Len(t, volumes, test.len)
@@ -773,7 +994,7 @@ func TestGetWorkloadFromErrorsWithInvalidVolumeSize(t *testing.T) {
 		},
 	}
 
-	_, err = provider.getWorkloadFrom(&pod)
+	_, err = provider.getWorkloadFrom(ctx, &pod)
 	assert.ErrorContains(t, err, "quantities must match the regular expression")
 }
 
@@ -819,7 +1040,7 @@ func TestGetWorkloadFromErrorsWithInvalidLivenessProbe(t *testing.T) {
 		},
 	}
 
-	_, err = provider.getWorkloadFrom(&pod)
+	_, err = provider.getWorkloadFrom(ctx, &pod)
 	assert.ErrorContains(t, err, "unable to find named port")
 }
 
@@ -865,7 +1086,7 @@ func TestGetWorkloadFromErrorsWithInvalidReadinessProbe(t *testing.T) {
 		},
 	}
 
-	_, err = provider.getWorkloadFrom(&pod)
+	_, err = provider.getWorkloadFrom(ctx, &pod)
 	assert.ErrorContains(t, err, "unable to find named port")
 }
 
@@ -940,7 +1161,7 @@ func TestGetWorkloadFromErrorsWithImagePullSecret(t *testing.T) {
 		t.Fatal("failed to create the test provider", err)
 	}
 
-	_, err = provider.getWorkloadFrom(&pod)
+	_, err = provider.getWorkloadFrom(ctx, &pod)
 	assert.ErrorContains(t, err, "legacy format kubernetes.io/dockercfg is not supported")
 }
 
@@ -952,6 +1173,28 @@ func TestContainerWithCommand(t *testing.T) {
 		t.Fatal("failed to create the test provider", err)
 	}
 
+	// a local registry serving the image app:1.0, whose entrypoint is /docker-entrypoint.sh, and the image tools:1.0 without entrypoint
+	imageConfigs := map[string]string{
+		"app":   `{"config": {"Entrypoint": ["/docker-entrypoint.sh"], "Cmd": ["nginx"]}}`,
+		"tools": `{"config": {"Cmd": ["sh"]}}`,
+	}
+	registryServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for image, imageConfig := range imageConfigs {
+			switch r.URL.Path {
+			case "/v2/" + image + "/manifests/1.0":
+				fmt.Fprintf(w, `{"mediaType": "application/vnd.oci.image.manifest.v1+json", "config": {"digest": "sha256:%s"}}`, image)
+				return
+			case "/v2/" + image + "/blobs/sha256:" + image:
+				fmt.Fprint(w, imageConfig)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer registryServer.Close()
+	registryHost := strings.TrimPrefix(registryServer.URL, "https://")
+	provider.entrypointResolver = registry.NewResolver(registryServer.Client())
+
 	var tests = []struct {
 		description string
 		container   v1.Container
@@ -996,26 +1239,301 @@ func TestContainerWithCommand(t *testing.T) {
 			},
 		},
 		{
-			description: "args and no command return error",
+			description: "args and no command follow the entrypoint of the image",
 			container: v1.Container{
+				Image: registryHost + "/app:1.0",
 				Args: []string{
 					"test",
-					"command",
+					"args",
 				},
 			},
 			expected: workload_models.V1ContainerSpec{
-				Command: ([]string)(nil),
+				Command: []string{
+					"/docker-entrypoint.sh",
+					"test",
+					"args",
+				},
+			},
+		},
+		{
+			description: "args and no command are the command of images without entrypoint",
+			container: v1.Container{
+				Image: registryHost + "/tools:1.0",
+				Args: []string{
+					"test",
+					"args",
+				},
+			},
+			expected: workload_models.V1ContainerSpec{
+				Command: []string{
+					"test",
+					"args",
+				},
 			},
-			err: "args not supported without command",
+		},
+		{
+			description: "args and no command return error when the image isn't found",
+			container: v1.Container{
+				Image: registryHost + "/missing:1.0",
+				Args: []string{
+					"test",
+					"args",
+				},
+			},
+			err: "failed to read the manifest of the image " + registryHost + "/missing:1.0",
 		},
 	}
 
 	for _, test := range tests {
-		containerSpec, err := provider.getWorkloadContainerSpecFrom(&test.container)
-		if err != nil {
+		containerSpec, err := provider.getWorkloadContainerSpecFrom(ctx, &v1.Pod{}, &test.container)
+		if test.err != "" || err != nil {
 			assert.ErrorContains(t, err, test.err, test.description)
 		} else {
 			assert.Equal(t, test.expected.Command, containerSpec.Command, test.description)
 		}
 	}
+
+	t.Run("args and no command follow the entrypoint of the new image when it's updated", func(t *testing.T) {
+		pod := createTestPodWithContainers(nil, v1.Container{Name: "app", Image: registryHost + "/app:1.0", Args: []string{"test", "args"}})
+		live, err := provider.getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+
+		pod.Spec.Containers[0].Image = registryHost + "/tools:1.0"
+		desired, err := provider.getWorkloadFrom(ctx, pod)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"spec.containers.app.image"}, getWorkloadChanges(live, desired))
+		updated := applyWorkloadChanges(live, desired)
+		assert.Equal(t, registryHost+"/tools:1.0", updated.Spec.Containers["app"].Image)
+		assert.Equal(t, []string{"test", "args"}, updated.Spec.Containers["app"].Command)
+	})
+}
+
+func TestWorkloadMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := &v1.Pod{}
+	pod.Name = "test-pod"
+	pod.Namespace = "test-ns"
+	pod.Labels = map[string]string{"app": "nginx", nodeNameLabelKey: "another-node"}
+	pod.Annotations = map[string]string{
+		"example.com/owner":            "team",
+		v1.LastAppliedConfigAnnotation: "{}",
+	}
+
+	metadata := provider.getWorkloadMetadataFrom(pod)
+
+	assert.Equal(t, workload_models.V1StringMapEntry{
+		"app":                "nginx",
+		podNameLabelKey:      "test-pod",
+		podNamespaceLabelKey: "test-ns",
+		nodeNameLabelKey:     provider.nodeName,
+	}, metadata.Labels)
+	assert.Equal(t, workload_models.V1StringMapEntry{"example.com/owner": "team"}, metadata.Annotations)
+}
+
+func TestStartupProbe(t *testing.T) {
+	ctx := context.Background()
+
+	provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	newPod := func(ready bool) *v1.Pod {
+		pod := &v1.Pod{}
+		pod.Name = "test-pod"
+		pod.Namespace = "test-ns"
+		pod.Spec.Containers = []v1.Container{
+			{
+				Name:  "app",
+				Image: "app:latest",
+				StartupProbe: &v1.Probe{
+					ProbeHandler:        v1.ProbeHandler{HTTPGet: &v1.HTTPGetAction{Path: "/started", Port: intstr.FromInt(8080)}},
+					InitialDelaySeconds: 5,
+					PeriodSeconds:       10,
+					FailureThreshold:    30,
+				},
+				LivenessProbe: &v1.Probe{
+					ProbeHandler:        v1.ProbeHandler{HTTPGet: &v1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(8080)}},
+					InitialDelaySeconds: 10,
+				},
+			},
+			{
+				Name:  "sidecar",
+				Image: "sidecar:latest",
+				LivenessProbe: &v1.Probe{
+					ProbeHandler:        v1.ProbeHandler{TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(9090)}},
+					InitialDelaySeconds: 10,
+				},
+			},
+		}
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "app", Ready: ready}, {Name: "sidecar", Ready: ready}}
+		return pod
+	}
+
+	t.Run("delays the liveness probe by the budget of the startup probe", func(t *testing.T) {
+		spec, err := provider.getWorkloadSpecFrom(ctx, newPod(false))
+		assert.NoError(t, err)
+		// 10s of initial delay, plus the 5s of initial delay and 30 x 10s of failures the startup probe allows
+		assert.Equal(t, int32(315), spec.Containers["app"].LivenessProbe.InitialDelaySeconds)
+		assert.Equal(t, int32(10), spec.Containers["sidecar"].LivenessProbe.InitialDelaySeconds)
+	})
+
+	t.Run("uses the default timings of the startup probe", func(t *testing.T) {
+		pod := newPod(false)
+		pod.Spec.Containers[0].StartupProbe = &v1.Probe{
+			ProbeHandler: v1.ProbeHandler{TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(8080)}},
+		}
+		spec, err := provider.getWorkloadSpecFrom(ctx, pod)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(40), spec.Containers["app"].LivenessProbe.InitialDelaySeconds)
+	})
+
+	t.Run("keeps the workload of the started containers", func(t *testing.T) {
+		starting, err := provider.getWorkloadFrom(ctx, newPod(false))
+		assert.NoError(t, err)
+		started, err := provider.getWorkloadFrom(ctx, newPod(true))
+		assert.NoError(t, err)
+
+		// the liveness probe is part of the workload from the start, so it isn't updated once the containers
+		// started, which would replace its instance
+		assert.Equal(t, starting.Spec.Containers["app"].LivenessProbe, started.Spec.Containers["app"].LivenessProbe)
+		assert.Empty(t, getWorkloadChanges(starting, started))
+	})
+}
+
+func TestContainerEnvFromSources(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	configMapListerMock := mocks.NewMockConfigMapLister(mockController)
+	configMapNamespaceListerMock := mocks.NewMockConfigMapNamespaceLister(mockController)
+	secretListerMock := mocks.NewMockSecretLister(mockController)
+	secretNamespaceListerMock := mocks.NewMockSecretNamespaceLister(mockController)
+
+	provider, err := createTestProvider(ctx, configMapListerMock, secretListerMock, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := &v1.Pod{}
+	pod.Name = "test-pod"
+	pod.Namespace = "test-ns"
+
+	optional := true
+	configMap := &v1.ConfigMap{Data: map[string]string{"LOG_LEVEL": "debug", "PORT": "8080", "not valid": "skipped"}}
+	secret := &v1.Secret{Data: map[string][]byte{"PASSWORD": []byte("s3cr3t"), "PORT": []byte("9090")}}
+
+	expectConfigMap := func(name string, configMap *v1.ConfigMap, err error) {
+		configMapListerMock.EXPECT().ConfigMaps("test-ns").Return(configMapNamespaceListerMock).Times(1)
+		configMapNamespaceListerMock.EXPECT().Get(name).Return(configMap, err).Times(1)
+	}
+	expectSecret := func(name string, secret *v1.Secret, err error) {
+		secretListerMock.EXPECT().Secrets("test-ns").Return(secretNamespaceListerMock).Times(1)
+		secretNamespaceListerMock.EXPECT().Get(name).Return(secret, err).Times(1)
+	}
+
+	var tests = []struct {
+		description     string
+		k8sEnvFrom      []v1.EnvFromSource
+		initMockedCalls func()
+		expectedSPEnv   workload_models.V1EnvironmentVariableMapEntry
+		expectedError   string
+	}{
+		{
+			description: "expands every key of the sources, the later sources taking precedence",
+			k8sEnvFrom: []v1.EnvFromSource{
+				{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}}},
+				{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "app-secret"}}},
+			},
+			initMockedCalls: func() {
+				expectConfigMap("app-config", configMap, nil)
+				expectSecret("app-secret", secret, nil)
+			},
+			expectedSPEnv: workload_models.V1EnvironmentVariableMapEntry{
+				"LOG_LEVEL": {Value: "debug"},
+				"PASSWORD":  {SecretValue: "s3cr3t"},
+				"PORT":      {SecretValue: "9090"},
+			},
+		},
+		{
+			description: "prefixes the keys of the sources",
+			k8sEnvFrom: []v1.EnvFromSource{
+				{Prefix: "APP_", ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}}},
+			},
+			initMockedCalls: func() { expectConfigMap("app-config", configMap, nil) },
+			expectedSPEnv: workload_models.V1EnvironmentVariableMapEntry{
+				"APP_LOG_LEVEL": {Value: "debug"},
+				"APP_PORT":      {Value: "8080"},
+			},
+		},
+		{
+			description: "skips missing optional sources",
+			k8sEnvFrom: []v1.EnvFromSource{
+				{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "missing-config"}, Optional: &optional}},
+				{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "missing-secret"}, Optional: &optional}},
+			},
+			initMockedCalls: func() {
+				expectConfigMap("missing-config", nil, k8serrors.NewNotFound(v1.Resource("configmaps"), "missing-config"))
+				expectSecret("missing-secret", nil, k8serrors.NewNotFound(v1.Resource("secrets"), "missing-secret"))
+			},
+			expectedSPEnv: workload_models.V1EnvironmentVariableMapEntry{},
+		},
+		{
+			description: "fails on a missing required config map",
+			k8sEnvFrom: []v1.EnvFromSource{
+				{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "missing-config"}}},
+			},
+			initMockedCalls: func() {
+				expectConfigMap("missing-config", nil, k8serrors.NewNotFound(v1.Resource("configmaps"), "missing-config"))
+			},
+			expectedError: "configmap \"missing-config\" not found",
+		},
+		{
+			description: "fails on a missing required secret",
+			k8sEnvFrom: []v1.EnvFromSource{
+				{SecretRef: &v1.SecretEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "missing-secret"}}},
+			},
+			initMockedCalls: func() {
+				expectSecret("missing-secret", nil, k8serrors.NewNotFound(v1.Resource("secrets"), "missing-secret"))
+			},
+			expectedError: "secret \"missing-secret\" not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			test.initMockedCalls()
+			workloadEnvs, err := provider.getWorkloadContainerEnvFromSources(pod, test.k8sEnvFrom)
+			if test.expectedError != "" {
+				assert.EqualError(t, err, test.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedSPEnv, workloadEnvs)
+		})
+	}
+
+	t.Run("explicit env vars take precedence over envFrom", func(t *testing.T) {
+		expectConfigMap("app-config", configMap, nil)
+		container := &v1.Container{
+			Name:    "app",
+			EnvFrom: []v1.EnvFromSource{{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "app-config"}}}},
+			Env:     []v1.EnvVar{{Name: "LOG_LEVEL", Value: "info"}},
+		}
+
+		containerSpec, err := provider.getWorkloadContainerSpecFrom(ctx, pod, container)
+		assert.NoError(t, err)
+		assert.Equal(t, workload_models.V1EnvironmentVariableMapEntry{
+			"LOG_LEVEL": {Value: "info"},
+			"PORT":      {Value: "8080"},
+		}, containerSpec.Env)
+	})
 }
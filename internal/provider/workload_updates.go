@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Define how many times a workload update is attempted when it conflicts with
+// a concurrent modification of the workload
+var workloadUpdateMaxAttempts = 5
+
+// updatePod applies the changes made to the mutable fields of a pod to its workload.
+// Kubernetes only allows changing the image of the containers and the metadata of a running pod,
+// so those are the only fields compared between the translated workload and the live one. The command
+// of a container whose image changed is updated as well, since it may be the entrypoint of its image.
+// The files of the volumes written by the volume writer are updated along with the metadata, whose
+// annotations hold their checksum, so the changes to the ConfigMaps and Secrets of the pod are applied.
+func (p *StackpathProvider) updatePod(ctx context.Context, pod *v1.Pod) error {
+	desired, err := p.getWorkloadFrom(ctx, pod)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		live, err := p.getWorkload(ctx, pod.Namespace, pod.Name)
+		if err != nil {
+			return err
+		}
+
+		changes := getWorkloadChanges(live, desired)
+		if len(changes) == 0 {
+			log.G(ctx).Debugf("the workload of the pod %s/%s is up to date", pod.Namespace, pod.Name)
+			return nil
+		}
+
+		log.G(ctx).WithField("changes", changes).Infof("updating the workload of the pod %s/%s", pod.Namespace, pod.Name)
+
+		// The live workload carries the version it was read at, so StackPath
+		// rejects the update if the workload was modified in the meantime
+		err = p.updateWorkload(ctx, applyWorkloadChanges(live, desired))
+		if err == nil {
+			return nil
+		}
+
+		var apiError *APIError
+		if !errors.As(err, &apiError) || !apiError.Conflict() || attempt >= workloadUpdateMaxAttempts {
+			return err
+		}
+
+		log.G(ctx).WithError(err).Debugf("the workload of the pod %s/%s was modified concurrently, retrying the update", pod.Namespace, pod.Name)
+	}
+}
+
+// getWorkloadChanges returns the mutable fields of the live workload that differ from the desired workload.
+func getWorkloadChanges(live, desired *workload_models.V1Workload) []string {
+	changes := []string{}
+
+	liveMetadata := live.Metadata
+	if liveMetadata == nil {
+		liveMetadata = &workload_models.V1Metadata{}
+	}
+	if !stringMapsEqual(liveMetadata.Labels, desired.Metadata.Labels) {
+		changes = append(changes, "metadata.labels")
+	}
+	if !stringMapsEqual(liveMetadata.Annotations, desired.Metadata.Annotations) {
+		changes = append(changes, "metadata.annotations")
+	}
+
+	if live.Spec == nil {
+		return changes
+	}
+	for name, container := range desired.Spec.Containers {
+		liveContainer, ok := live.Spec.Containers[name]
+		if !ok {
+			continue
+		}
+		if liveContainer.Image != container.Image {
+			changes = append(changes, fmt.Sprintf("spec.containers.%s.image", name))
+		}
+	}
+
+	return changes
+}
+
+// applyWorkloadChanges returns a copy of the live workload updated with the mutable fields of the desired workload.
+func applyWorkloadChanges(live, desired *workload_models.V1Workload) *workload_models.V1Workload {
+	updated := *live
+
+	metadata := workload_models.V1Metadata{}
+	if live.Metadata != nil {
+		metadata = *live.Metadata
+	}
+	metadata.Labels = desired.Metadata.Labels
+	metadata.Annotations = desired.Metadata.Annotations
+	updated.Metadata = &metadata
+
+	if live.Spec != nil {
+		spec := *live.Spec
+		spec.Containers = workload_models.V1ContainerSpecMapEntry{}
+		for name, container := range live.Spec.Containers {
+			if desiredContainer, ok := desired.Spec.Containers[name]; ok {
+				if container.Image != desiredContainer.Image {
+					// the command of the containers without one was read from the registry of their image,
+					// so it's the one the desired workload read for the new image
+					container.Command = desiredContainer.Command
+				}
+				container.Image = desiredContainer.Image
+				if name == volumeWriterContainerName {
+					container.Env = desiredContainer.Env
+				}
+			}
+			spec.Containers[name] = container
+		}
+		updated.Spec = &spec
+	}
+
+	return &updated
+}
+
+// stringMapsEqual compares two string maps, treating nil and empty maps as equal.
+func stringMapsEqual(a, b workload_models.V1StringMapEntry) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
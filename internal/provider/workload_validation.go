@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	v1 "k8s.io/api/core/v1"
+)
+
+// The reason of the event recorded for the read-only volume mounts StackPath doesn't enforce
+const readOnlyMountNotEnforcedReason = "ReadOnlyMountNotEnforced"
+
+// The characters StackPath allows in slugs
+var slugRegexp = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+
+const invalidSlugMessage = "it must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character"
+
+// The largest environment variable, name and value, a container can be started with, which is Linux's MAX_ARG_STRLEN.
+// The files of the volumes written by the volume writer are passed on in environment variables, so they're bound by it too.
+const maxEnvironmentVariableSize = 128 * 1024
+
+// validateWorkload checks the workload translated from the pod before it's sent to StackPath, so the pod fails
+// with a message describing each problem rather than with the error StackPath returns for the first one.
+func (p *StackpathProvider) validateWorkload(pod *v1.Pod, workload *workload_models.V1Workload) error {
+	problems := []string{}
+
+	if !slugRegexp.MatchString(workload.Slug) {
+		problems = append(problems, fmt.Sprintf("the workload slug %s is invalid, %s", workload.Slug, invalidSlugMessage))
+	}
+
+	volumeSlugs := map[string]bool{}
+	for _, volumeClaim := range workload.Spec.VolumeClaimTemplates {
+		if !slugRegexp.MatchString(volumeClaim.Slug) {
+			problems = append(problems, fmt.Sprintf("the volume slug %s is invalid, %s", volumeClaim.Slug, invalidSlugMessage))
+		}
+		if volumeSlugs[volumeClaim.Slug] {
+			problems = append(problems, fmt.Sprintf("the volume slug %s is used by several volumes", volumeClaim.Slug))
+		}
+		volumeSlugs[volumeClaim.Slug] = true
+	}
+
+	containerNames := make([]string, 0, len(workload.Spec.Containers))
+	for name := range workload.Spec.Containers {
+		containerNames = append(containerNames, name)
+	}
+	sort.Strings(containerNames)
+
+	for _, name := range containerNames {
+		mountPaths := map[string]bool{}
+		for _, volumeMount := range workload.Spec.Containers[name].VolumeMounts {
+			if !volumeSlugs[volumeMount.Slug] {
+				problems = append(problems, fmt.Sprintf("the volume mount %s of the container %s references the volume %s, %s", volumeMount.MountPath, name, volumeMount.Slug, getMissingVolumeReason(pod, volumeMount.Slug)))
+			}
+			if !path.IsAbs(volumeMount.MountPath) {
+				problems = append(problems, fmt.Sprintf("the volume mount %s of the container %s must be an absolute path", volumeMount.MountPath, name))
+			}
+			if mountPaths[volumeMount.MountPath] {
+				problems = append(problems, fmt.Sprintf("the container %s mounts several volumes at %s", name, volumeMount.MountPath))
+			}
+			mountPaths[volumeMount.MountPath] = true
+		}
+
+		env := workload.Spec.Containers[name].Env
+		envNames := make([]string, 0, len(env))
+		for envName := range env {
+			envNames = append(envNames, envName)
+		}
+		sort.Strings(envNames)
+		for _, envName := range envNames {
+			variable := env[envName]
+			if size := len(envName) + 1 + len(variable.Value) + len(variable.SecretValue); size > maxEnvironmentVariableSize {
+				problems = append(problems, fmt.Sprintf("the environment variable %s of the container %s is %d bytes, more than the %d bytes a container can be started with", envName, name, size, maxEnvironmentVariableSize))
+			}
+		}
+	}
+
+	for _, container := range getPodContainers(pod) {
+		for _, volumeMount := range container.VolumeMounts {
+			if volumeMount.MountPath == defaultK8sServiceAccountMountPath {
+				continue
+			}
+			if volumeMount.SubPath != "" || volumeMount.SubPathExpr != "" {
+				problems = append(problems, fmt.Sprintf("the volume mount %s of the container %s uses a subPath, which StackPath doesn't support", volumeMount.MountPath, container.Name))
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("the workload of the pod %s/%s is invalid: %s", pod.Namespace, pod.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// recordReadOnlyMounts records a Warning event for each read-only volume mount of the pod, since StackPath volumes
+// are mounted read-write. It's called once the workload is created, so updating the workload doesn't record them again.
+func (p *StackpathProvider) recordReadOnlyMounts(pod *v1.Pod) {
+	for _, container := range getPodContainers(pod) {
+		for _, volumeMount := range container.VolumeMounts {
+			if volumeMount.MountPath == defaultK8sServiceAccountMountPath || !volumeMount.ReadOnly {
+				continue
+			}
+			// ConfigMap, Secret, projected and downward API volumes are only written by the volume writer
+			if !isFileVolumeOf(pod, volumeMount.Name) {
+				p.eventRecorder.Eventf(pod, v1.EventTypeWarning, readOnlyMountNotEnforcedReason, "StackPath volumes are mounted read-write, the volume mount %s of the container %s is writable", volumeMount.MountPath, container.Name)
+			}
+		}
+	}
+}
+
+// getMissingVolumeReason explains why a volume mounted by a container isn't a volume of the workload
+func getMissingVolumeReason(pod *v1.Pod, name string) string {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name != name {
+			continue
+		}
+		if isFileVolume(&volume) {
+			return "which is only supported when the volume writer image is set"
+		}
+		return "whose type StackPath doesn't support"
+	}
+	return "which isn't a volume of the pod"
+}
+
+// isFileVolumeOf returns whether the volume of the pod is a ConfigMap, Secret, projected or downward API volume
+func isFileVolumeOf(pod *v1.Pod, name string) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == name {
+			return isFileVolume(&volume)
+		}
+	}
+	return false
+}
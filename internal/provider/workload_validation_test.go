@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_client/workloads"
+	"github.com/stackpath/vk-stackpath-provider/internal/api/workload/workload_models"
+	"github.com/stackpath/vk-stackpath-provider/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestValidateWorkload(t *testing.T) {
+	ctx := context.Background()
+
+	emptyDir := func(name string) v1.Volume {
+		return v1.Volume{Name: name, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}
+	}
+
+	testCases := []struct {
+		description    string
+		pod            *v1.Pod
+		expectedError  string
+		expectedEvents []string
+	}{
+		{
+			description: "accepts mounts of translated volumes",
+			pod:         createTestPodWithVolumes([]v1.Volume{emptyDir("cache")}, v1.VolumeMount{Name: "cache", MountPath: "/cache"}),
+		},
+		{
+			description: "skips the service account mount",
+			pod: createTestPodWithVolumes([]v1.Volume{{Name: "kube-api-access", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{}}}},
+				v1.VolumeMount{Name: "kube-api-access", MountPath: defaultK8sServiceAccountMountPath, ReadOnly: true}),
+		},
+		{
+			description:   "fails with mounts of volumes StackPath doesn't support",
+			pod:           createTestPodWithVolumes([]v1.Volume{{Name: "host", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/log"}}}}, v1.VolumeMount{Name: "host", MountPath: "/logs"}),
+			expectedError: "the workload of the pod test-ns/test-pod is invalid: the volume mount /logs of the container nginx references the volume host, whose type StackPath doesn't support",
+		},
+		{
+			description:   "fails with mounts of missing volumes",
+			pod:           createTestPodWithVolumes(nil, v1.VolumeMount{Name: "data", MountPath: "/data"}),
+			expectedError: "the workload of the pod test-ns/test-pod is invalid: the volume mount /data of the container nginx references the volume data, which isn't a volume of the pod",
+		},
+		{
+			description: "fails with several volumes mounted at the same path",
+			pod: createTestPodWithVolumes([]v1.Volume{emptyDir("cache"), emptyDir("tmp")},
+				v1.VolumeMount{Name: "cache", MountPath: "/data"}, v1.VolumeMount{Name: "tmp", MountPath: "/data"}),
+			expectedError: "the workload of the pod test-ns/test-pod is invalid: the container nginx mounts several volumes at /data",
+		},
+		{
+			description:   "fails with relative mount paths",
+			pod:           createTestPodWithVolumes([]v1.Volume{emptyDir("cache")}, v1.VolumeMount{Name: "cache", MountPath: "cache"}),
+			expectedError: "the workload of the pod test-ns/test-pod is invalid: the volume mount cache of the container nginx must be an absolute path",
+		},
+		{
+			description:   "fails with subPath mounts",
+			pod:           createTestPodWithVolumes([]v1.Volume{emptyDir("cache")}, v1.VolumeMount{Name: "cache", MountPath: "/cache", SubPath: "app"}),
+			expectedError: "the workload of the pod test-ns/test-pod is invalid: the volume mount /cache of the container nginx uses a subPath, which StackPath doesn't support",
+		},
+		{
+			description:   "fails with invalid volume slugs",
+			pod:           createTestPodWithVolumes([]v1.Volume{emptyDir("cache_dir")}, v1.VolumeMount{Name: "cache_dir", MountPath: "/cache"}),
+			expectedError: "the workload of the pod test-ns/test-pod is invalid: the volume slug cache_dir is invalid, it must consist of lower case alphanumeric characters or '-', and must start and end with an alphanumeric character",
+		},
+		{
+			description: "reports every problem",
+			pod: createTestPodWithVolumes([]v1.Volume{emptyDir("cache")},
+				v1.VolumeMount{Name: "cache", MountPath: "/cache", SubPath: "app"}, v1.VolumeMount{Name: "data", MountPath: "/cache"}),
+			expectedError: "the workload of the pod test-ns/test-pod is invalid: the volume mount /cache of the container nginx references the volume data, which isn't a volume of the pod; the container nginx mounts several volumes at /cache; the volume mount /cache of the container nginx uses a subPath, which StackPath doesn't support",
+		},
+		{
+			description:    "records read-only mounts StackPath doesn't enforce",
+			pod:            createTestPodWithVolumes([]v1.Volume{emptyDir("cache")}, v1.VolumeMount{Name: "cache", MountPath: "/cache", ReadOnly: true}),
+			expectedEvents: []string{"Warning ReadOnlyMountNotEnforced StackPath volumes are mounted read-write, the volume mount /cache of the container nginx is writable"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.description, func(t *testing.T) {
+			provider, err := createTestProvider(ctx, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatal("failed to create the test provider", err)
+			}
+			provider.apiConfig.VolumeWriterImage = "stackpath/volume-writer:latest"
+
+			workload, err := provider.getWorkloadFrom(ctx, c.pod)
+			if c.expectedError != "" {
+				assert.EqualError(t, err, c.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotContains(t, workload.Spec.Containers, volumeWriterContainerName)
+
+			// the events are recorded when the workload is created rather than on each translation
+			events := provider.eventRecorder.(*record.FakeRecorder).Events
+			assert.Empty(t, events)
+			provider.recordReadOnlyMounts(c.pod)
+			assert.Len(t, events, len(c.expectedEvents))
+			for _, expectedEvent := range c.expectedEvents {
+				assert.Equal(t, expectedEvent, <-events)
+			}
+		})
+	}
+}
+
+func TestRecordReadOnlyMountsOnCreate(t *testing.T) {
+	ctx := context.Background()
+	mockController := gomock.NewController(t)
+	defer mockController.Finish()
+
+	wsc := mocks.NewWorkloadsClientService(mockController)
+	provider, err := createTestProvider(ctx, nil, nil, nil, &workload_client.EdgeCompute{Workloads: wsc})
+	if err != nil {
+		t.Fatal("failed to create the test provider", err)
+	}
+
+	pod := createTestPodWithVolumes([]v1.Volume{{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}},
+		v1.VolumeMount{Name: "cache", MountPath: "/cache", ReadOnly: true})
+	live, err := provider.getWorkloadFrom(ctx, pod)
+	assert.NoError(t, err)
+	live.Status = workload_models.V1WorkloadStatusACTIVE.Pointer()
+
+	wsc.EXPECT().CreateWorkload(gomock.Any(), nil).Return(nil, nil).Times(1)
+	wsc.EXPECT().GetWorkload(gomock.Any(), nil).Return(&workloads.GetWorkloadOK{Payload: &workload_models.V1GetWorkloadResponse{Workload: live}}, nil).Times(1)
+
+	// the event is recorded once the workload is created, and not again when it's updated
+	events := provider.eventRecorder.(*record.FakeRecorder).Events
+	assert.NoError(t, provider.CreatePod(ctx, pod))
+	assert.NoError(t, provider.UpdatePod(ctx, pod))
+	assert.Len(t, events, 1)
+	assert.Equal(t, "Warning ReadOnlyMountNotEnforced StackPath volumes are mounted read-write, the volume mount /cache of the container nginx is writable", <-events)
+}
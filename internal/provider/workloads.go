@@ -76,6 +76,12 @@ func (p *StackpathProvider) getPodFromListerByInstance(ctx context.Context, inst
 	updatedPod := pod.DeepCopy()
 
 	podState := p.getK8SPodStatusFrom(ctx, instance)
+	if hasSeveralInstances(pod) {
+		if podState, err = p.getPodStatus(ctx, pod); err != nil {
+			return nil, err
+		}
+	}
+	setPodStatus(pod, podState, p.apiConfig.InitGateImage, p.apiConfig.GRPCProbeStrategy)
 
 	updatedPod.Status = *podState
 
@@ -96,6 +102,21 @@ func (p *StackpathProvider) createWorkload(ctx context.Context, w *workload_mode
 	return nil
 }
 
+func (p *StackpathProvider) updateWorkload(ctx context.Context, w *workload_models.V1Workload) error {
+	params := workloads.UpdateWorkloadParams{
+		Body:       &workload_models.V1UpdateWorkloadRequest{Workload: w},
+		StackID:    p.apiConfig.StackID,
+		WorkloadID: w.Slug,
+		Context:    ctx,
+	}
+
+	_, err := p.stackpathClient.Workloads.UpdateWorkload(&params, nil)
+	if err != nil {
+		return NewStackPathError(err)
+	}
+	return nil
+}
+
 func (p *StackpathProvider) deleteWorkload(ctx context.Context, podNamespace, podName string) error {
 	params := workloads.DeleteWorkloadParams{
 		StackID:    p.apiConfig.StackID,
@@ -111,7 +132,9 @@ func (p *StackpathProvider) deleteWorkload(ctx context.Context, podNamespace, po
 	return nil
 }
 
-// getInstanceName returns the name of the first instance running in a workload.
+// getInstanceName returns the name of the primary instance of a workload, which logs, exec and stats are read from.
+// The workloads of the pods running in several locations or autoscaled have a variable number of instances, which
+// are listed with getWorkloadInstances and served from with getPodInstance.
 //
 // The instance name is formatted as follows:
 // <workload-slug>-<target-name>-<deployment-city-code>-<ordinal>
@@ -0,0 +1,416 @@
+// Package registry reads the configuration of container images from registries implementing the Docker Registry HTTP API V2
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the registry of the images whose name has no registry
+	dockerHubDomain = "docker.io"
+	dockerHubHost   = "registry-1.docker.io"
+
+	// the platform of the StackPath instances, whose image is picked from multi-platform images
+	platformOS           = "linux"
+	platformArchitecture = "amd64"
+
+	// the largest manifest or configuration read from a registry
+	maxDocumentSize = 4 * 1024 * 1024
+
+	// how long the digest a tag references is cached for, since tags may be moved to other images
+	tagCacheTTL = 5 * time.Minute
+)
+
+// the media types of the manifests the resolver reads
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+var challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Credential is the username and password of a registry, as set in a dockerconfigjson image pull secret
+type Credential struct {
+	Server   string
+	Username string
+	Password string
+}
+
+// Resolver reads the entrypoint and the command of images from their registry, caching them by image digest
+// and caching the digest of the tags for tagCacheTTL
+type Resolver struct {
+	client *http.Client
+	now    func() time.Time
+
+	mu      sync.Mutex
+	configs map[string]*containerConfig
+	tags    map[string]taggedDigest
+}
+
+// taggedDigest is the digest a tag referenced when its manifest was read
+type taggedDigest struct {
+	digest  string
+	expires time.Time
+}
+
+// NewResolver returns a resolver sending its requests through the client
+func NewResolver(client *http.Client) *Resolver {
+	return &Resolver{
+		client:  client,
+		now:     time.Now,
+		configs: map[string]*containerConfig{},
+		tags:    map[string]taggedDigest{},
+	}
+}
+
+// reference is an image reference, split into the domain of its registry, its repository and its tag or digest
+type reference struct {
+	domain     string
+	repository string
+	reference  string
+}
+
+// manifest holds the fields of image manifests and of image indexes the resolver reads
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// containerConfig holds the fields of the container configuration of an image the resolver reads
+type containerConfig struct {
+	Entrypoint []string `json:"Entrypoint"`
+	Cmd        []string `json:"Cmd"`
+}
+
+// imageConfig is the configuration of an image
+type imageConfig struct {
+	Config containerConfig `json:"config"`
+}
+
+// Entrypoint returns the entrypoint of the image, authenticating with the credential of its registry when there is one
+func (r *Resolver) Entrypoint(ctx context.Context, image string, credentials []Credential) ([]string, error) {
+	config, err := r.getContainerConfig(ctx, image, credentials)
+	if err != nil {
+		return nil, err
+	}
+	return config.Entrypoint, nil
+}
+
+// Command returns the command the image runs when it's run without command nor args, which is its entrypoint
+// followed by its cmd, authenticating with the credential of its registry when there is one
+func (r *Resolver) Command(ctx context.Context, image string, credentials []Credential) ([]string, error) {
+	config, err := r.getContainerConfig(ctx, image, credentials)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]string{}, config.Entrypoint...), config.Cmd...), nil
+}
+
+func (r *Resolver) getContainerConfig(ctx context.Context, image string, credentials []Credential) (*containerConfig, error) {
+	ref, err := parseReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := ref.reference
+	if !strings.Contains(digest, ":") {
+		digest = r.getCachedDigest(ref)
+	}
+	if config, ok := r.getCachedConfig(digest); ok {
+		return config, nil
+	}
+
+	s := &session{resolver: r, ref: ref, credential: findCredential(ref.domain, credentials)}
+
+	m, digest, err := s.getManifest(ctx, ref.reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of the image %s: %w", image, err)
+	}
+	r.setCachedDigest(ref, digest)
+	if config, ok := r.getCachedConfig(digest); ok {
+		return config, nil
+	}
+
+	if len(m.Manifests) != 0 {
+		platformDigest := ""
+		for _, platformManifest := range m.Manifests {
+			if platformManifest.Platform.OS == platformOS && platformManifest.Platform.Architecture == platformArchitecture {
+				platformDigest = platformManifest.Digest
+				break
+			}
+		}
+		if platformDigest == "" {
+			return nil, fmt.Errorf("the image %s has no %s/%s variant", image, platformOS, platformArchitecture)
+		}
+		if m, _, err = s.getManifest(ctx, platformDigest); err != nil {
+			return nil, fmt.Errorf("failed to read the %s/%s manifest of the image %s: %w", platformOS, platformArchitecture, image, err)
+		}
+	}
+
+	if m.Config.Digest == "" {
+		return nil, fmt.Errorf("the manifest of the image %s has no configuration", image)
+	}
+
+	body, err := s.get(ctx, "blobs/"+m.Config.Digest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the configuration of the image %s: %w", image, err)
+	}
+	config := imageConfig{}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the configuration of the image %s: %w", image, err)
+	}
+
+	r.mu.Lock()
+	r.configs[digest] = &config.Config
+	r.mu.Unlock()
+
+	return &config.Config, nil
+}
+
+func (r *Resolver) getCachedConfig(digest string) (*containerConfig, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	config, ok := r.configs[digest]
+	return config, ok
+}
+
+// getCachedDigest returns the digest the tag of the reference was last read to reference,
+// or an empty string when it wasn't read or was read more than tagCacheTTL ago
+func (r *Resolver) getCachedDigest(ref reference) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := ref.domain + "/" + ref.repository + ":" + ref.reference
+	tagged, ok := r.tags[key]
+	if !ok || !r.now().Before(tagged.expires) {
+		delete(r.tags, key)
+		return ""
+	}
+	return tagged.digest
+}
+
+func (r *Resolver) setCachedDigest(ref reference, digest string) {
+	if strings.Contains(ref.reference, ":") {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tags[ref.domain+"/"+ref.repository+":"+ref.reference] = taggedDigest{digest: digest, expires: r.now().Add(tagCacheTTL)}
+}
+
+// session sends the requests reading an image, reusing the authorization obtained for the first one
+type session struct {
+	resolver      *Resolver
+	ref           reference
+	credential    *Credential
+	authorization string
+}
+
+// getManifest returns the manifest the tag or digest references, along with its digest
+func (s *session) getManifest(ctx context.Context, tagOrDigest string) (*manifest, string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	body, err := s.get(ctx, "manifests/"+tagOrDigest, header)
+	if err != nil {
+		return nil, "", err
+	}
+
+	m := manifest{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(body)
+	return &m, "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// get returns the body of the resource of the repository, authorizing the request when the registry requires it
+func (s *session) get(ctx context.Context, resource string, header http.Header) ([]byte, error) {
+	resourceURL := fmt.Sprintf("https://%s/v2/%s/%s", registryHost(s.ref.domain), s.ref.repository, resource)
+
+	resp, err := s.do(ctx, resourceURL, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && s.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if s.authorization, err = s.authorize(ctx, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = s.do(ctx, resourceURL, header); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", resourceURL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+}
+
+func (s *session) do(ctx context.Context, resourceURL string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if s.authorization != "" {
+		req.Header.Set("Authorization", s.authorization)
+	}
+	return s.resolver.client.Do(req)
+}
+
+// authorize returns the Authorization header answering the challenge of the registry, which is
+// either a basic challenge or a bearer challenge requiring a token from the registry's token service
+func (s *session) authorize(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if s.credential == nil {
+			return "", fmt.Errorf("the registry %s requires credentials", s.ref.domain)
+		}
+		return "Basic " + basicAuth(s.credential), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("the registry %s requires an unsupported authentication %q", s.ref.domain, challenge)
+	}
+
+	values := map[string]string{}
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(params, -1) {
+		values[strings.ToLower(match[1])] = match[2]
+	}
+	if values["realm"] == "" {
+		return "", fmt.Errorf("the registry %s sent a bearer challenge without realm", s.ref.domain)
+	}
+
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil {
+		return "", err
+	}
+	query := tokenURL.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", s.ref.repository)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if s.credential != nil {
+		req.Header.Set("Authorization", "Basic "+basicAuth(s.credential))
+	}
+	resp, err := s.resolver.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the token service of the registry %s returned %s", s.ref.domain, resp.Status)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+func basicAuth(credential *Credential) string {
+	return base64.StdEncoding.EncodeToString([]byte(credential.Username + ":" + credential.Password))
+}
+
+// parseReference splits an image reference the way the container runtimes do: the first component of
+// the name is the domain of the registry when it looks like a host, otherwise the image is on Docker Hub
+func parseReference(image string) (reference, error) {
+	ref := reference{reference: "latest"}
+
+	// the digest takes precedence over the tag when the reference has both
+	name, digest, hasDigest := strings.Cut(image, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.reference = name[i+1:]
+		name = name[:i]
+	}
+	if hasDigest {
+		ref.reference = digest
+	}
+	if name == "" {
+		return ref, fmt.Errorf("the image reference %q is invalid", image)
+	}
+
+	domain, repository, ok := strings.Cut(name, "/")
+	if !ok || (!strings.ContainsAny(domain, ".:") && domain != "localhost") {
+		domain, repository = dockerHubDomain, name
+	}
+	if domain == dockerHubDomain && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+
+	ref.domain = domain
+	ref.repository = repository
+	return ref, nil
+}
+
+// registryHost returns the host serving the registry API of the domain
+func registryHost(domain string) string {
+	if domain == dockerHubDomain {
+		return dockerHubHost
+	}
+	return domain
+}
+
+// findCredential returns the credential of the registry, whose server may be set as a host or as a URL
+func findCredential(domain string, credentials []Credential) *Credential {
+	for i := range credentials {
+		server := credentials[i].Server
+		if u, err := url.Parse(server); err == nil && u.Host != "" {
+			server = u.Host
+		}
+		server, _, _ = strings.Cut(server, "/")
+		if server == "index.docker.io" || server == dockerHubHost {
+			server = dockerHubDomain
+		}
+		if server == domain {
+			return &credentials[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func digestOf(document string) string {
+	sum := sha256.Sum256([]byte(document))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newTestRegistry starts a registry serving the multi-platform image team/app:1.0, whose index digest is
+// returned, the image team/tools:1.0, and the image team/private:1.0, which requires a bearer token obtained
+// with the user:password credential. The requests the registry receives are counted by path.
+func newTestRegistry(t *testing.T) (*httptest.Server, map[string]int, string) {
+	config := `{"architecture": "amd64", "os": "linux", "config": {"Entrypoint": ["/docker-entrypoint.sh"], "Cmd": ["nginx"]}}`
+	imageManifest := fmt.Sprintf(`{"mediaType": "application/vnd.oci.image.manifest.v1+json", "config": {"digest": %q}}`, digestOf(config))
+	index := fmt.Sprintf(`{"mediaType": "application/vnd.oci.image.index.v1+json", "manifests": [
+		{"digest": "sha256:arm64", "platform": {"architecture": "arm64", "os": "linux"}},
+		{"digest": %q, "platform": {"architecture": "amd64", "os": "linux"}}
+	]}`, digestOf(imageManifest))
+	toolsConfig := `{"config": {"Cmd": ["sh"]}}`
+	toolsManifest := fmt.Sprintf(`{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "config": {"digest": %q}}`, digestOf(toolsConfig))
+
+	documents := map[string]string{
+		"/v2/team/app/manifests/1.0":                        index,
+		"/v2/team/app/manifests/" + digestOf(index):         index,
+		"/v2/team/app/manifests/" + digestOf(imageManifest): imageManifest,
+		"/v2/team/app/blobs/" + digestOf(config):            config,
+		"/v2/team/tools/manifests/1.0":                      toolsManifest,
+		"/v2/team/tools/blobs/" + digestOf(toolsConfig):     toolsConfig,
+		"/v2/team/private/manifests/1.0":                    toolsManifest,
+		"/v2/team/private/blobs/" + digestOf(toolsConfig):   toolsConfig,
+		"/v2/team/arm/manifests/1.0":                        strings.Replace(index, `"amd64"`, `"s390x"`, 1),
+	}
+
+	requests := map[string]int{}
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		if r.URL.Path == "/token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "user" || password != "password" || r.URL.Query().Get("scope") != "repository:team/private:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token": "t0k3n"}`)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/v2/team/private/") && r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:team/private:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		document, ok := documents[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, document)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests, digestOf(index)
+}
+
+func TestEntrypoint(t *testing.T) {
+	ctx := context.Background()
+	server, requests, indexDigest := newTestRegistry(t)
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	t.Run("reads the entrypoint of the amd64 variant of a multi-platform image", func(t *testing.T) {
+		resolver := NewResolver(server.Client())
+
+		entrypoint, err := resolver.Entrypoint(ctx, host+"/team/app:1.0", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/docker-entrypoint.sh"}, entrypoint)
+	})
+
+	t.Run("caches the entrypoint by image digest", func(t *testing.T) {
+		resolver := NewResolver(server.Client())
+		for path := range requests {
+			delete(requests, path)
+		}
+
+		now := time.Now()
+		resolver.now = func() time.Time { return now }
+
+		_, err := resolver.Entrypoint(ctx, host+"/team/app:1.0", nil)
+		assert.NoError(t, err)
+		_, err = resolver.Entrypoint(ctx, host+"/team/app:1.0", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, requests["/v2/team/app/manifests/1.0"], "the digest of the tag must be read from the cache")
+		assert.Equal(t, 3, len(requests), "the image manifest and configuration must only be read once")
+
+		// the tag is read again once its digest expired, while its configuration is still read from the cache
+		now = now.Add(tagCacheTTL)
+		_, err = resolver.Entrypoint(ctx, host+"/team/app:1.0", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, requests["/v2/team/app/manifests/1.0"])
+		assert.Equal(t, 3, len(requests))
+
+		entrypoint, err := resolver.Entrypoint(ctx, host+"/team/app@"+indexDigest, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/docker-entrypoint.sh"}, entrypoint)
+		assert.Zero(t, requests["/v2/team/app/manifests/"+indexDigest], "images referenced by digest must be read from the cache")
+	})
+
+	t.Run("returns no entrypoint for images without one", func(t *testing.T) {
+		entrypoint, err := NewResolver(server.Client()).Entrypoint(ctx, host+"/team/tools:1.0", nil)
+		assert.NoError(t, err)
+		assert.Empty(t, entrypoint)
+	})
+
+	t.Run("returns the entrypoint followed by the cmd as the command of the image", func(t *testing.T) {
+		resolver := NewResolver(server.Client())
+
+		command, err := resolver.Command(ctx, host+"/team/app:1.0", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/docker-entrypoint.sh", "nginx"}, command)
+
+		command, err = resolver.Command(ctx, host+"/team/tools:1.0", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"sh"}, command)
+	})
+
+	t.Run("authenticates with the credential of the registry", func(t *testing.T) {
+		credentials := []Credential{
+			{Server: "registry.example.com", Username: "other", Password: "other"},
+			{Server: "https://" + host, Username: "user", Password: "password"},
+		}
+		entrypoint, err := NewResolver(server.Client()).Entrypoint(ctx, host+"/team/private:1.0", credentials)
+		assert.NoError(t, err)
+		assert.Empty(t, entrypoint)
+	})
+
+	t.Run("fails without the credential of the registry", func(t *testing.T) {
+		_, err := NewResolver(server.Client()).Entrypoint(ctx, host+"/team/private:1.0", nil)
+		assert.EqualError(t, err, fmt.Sprintf("failed to read the manifest of the image %s/team/private:1.0: the token service of the registry %s returned 401 Unauthorized", host, host))
+	})
+
+	t.Run("fails for missing images", func(t *testing.T) {
+		_, err := NewResolver(server.Client()).Entrypoint(ctx, host+"/team/missing:1.0", nil)
+		assert.EqualError(t, err, fmt.Sprintf("failed to read the manifest of the image %s/team/missing:1.0: GET https://%s/v2/team/missing/manifests/1.0 returned 404 Not Found", host, host))
+	})
+
+	t.Run("fails for images without an amd64 variant", func(t *testing.T) {
+		_, err := NewResolver(server.Client()).Entrypoint(ctx, host+"/team/arm:1.0", nil)
+		assert.EqualError(t, err, fmt.Sprintf("the image %s/team/arm:1.0 has no linux/amd64 variant", host))
+	})
+}
+
+func TestParseReference(t *testing.T) {
+	var tests = []struct {
+		image    string
+		expected reference
+	}{
+		{image: "nginx", expected: reference{domain: "docker.io", repository: "library/nginx", reference: "latest"}},
+		{image: "nginx:1.25", expected: reference{domain: "docker.io", repository: "library/nginx", reference: "1.25"}},
+		{image: "bitnami/redis:7.0", expected: reference{domain: "docker.io", repository: "bitnami/redis", reference: "7.0"}},
+		{image: "ghcr.io/team/app:1.0", expected: reference{domain: "ghcr.io", repository: "team/app", reference: "1.0"}},
+		{image: "localhost/app", expected: reference{domain: "localhost", repository: "app", reference: "latest"}},
+		{image: "registry:5000/team/app", expected: reference{domain: "registry:5000", repository: "team/app", reference: "latest"}},
+		{image: "nginx:1.25@sha256:abc", expected: reference{domain: "docker.io", repository: "library/nginx", reference: "sha256:abc"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			ref, err := parseReference(test.image)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, ref)
+		})
+	}
+}
+
+func TestFindCredential(t *testing.T) {
+	credentials := []Credential{
+		{Server: "https://index.docker.io/v1/", Username: "hub"},
+		{Server: "ghcr.io", Username: "github"},
+	}
+
+	assert.Equal(t, "hub", findCredential("docker.io", credentials).Username)
+	assert.Equal(t, "github", findCredential("ghcr.io", credentials).Username)
+	assert.Nil(t, findCredential("quay.io", credentials))
+}